@@ -0,0 +1,45 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/otaviokr/spacetraders-ship/backtest"
+	"github.com/otaviokr/spacetraders-ship/component"
+)
+
+// runBacktest replays the route against the recorded market data, without connecting to the game.
+func runBacktest(args []string) error {
+	flags := flag.NewFlagSet("backtest", flag.ContinueOnError)
+	snapshotPath := flags.String("snapshot", "", "path to the recorded market data")
+	cycles := flags.Int("cycles", 10, "how many times to go through the route")
+	cfg, err := loadConfig(flags, args)
+	if err != nil {
+		return err
+	}
+
+	if len(*snapshotPath) < 1 {
+		return fmt.Errorf("backtest: the snapshot file is required")
+	}
+	if *cycles < 1 {
+		return fmt.Errorf("backtest: cycles must be at least 1, got %d", *cycles)
+	}
+
+	route, err := component.ReadRouteFile(cfg.RouteFile)
+	if err != nil {
+		return fmt.Errorf("backtest: reading route: %w", err)
+	}
+	if err = route.Validate(); err != nil {
+		return fmt.Errorf("backtest: %w", err)
+	}
+
+	snapshot, err := backtest.ReadSnapshotFile(*snapshotPath)
+	if err != nil {
+		return fmt.Errorf("backtest: reading snapshot: %w", err)
+	}
+
+	results := backtest.NewSimulator(snapshot, route).Run(*cycles)
+	backtest.Print(os.Stdout, results)
+	return nil
+}
@@ -0,0 +1,275 @@
+package backtest
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/otaviokr/spacetraders-ship/component"
+	"github.com/otaviokr/spacetraders-ship/navigation"
+)
+
+// CycleResult is the outcome of one cycle of the route in the simulation.
+type CycleResult struct {
+	Cycle int
+	// Route is the candidate chosen for the cycle, if the route has candidates, and why.
+	Route     string
+	Reason    string
+	Profit    int
+	FuelSpent int
+	Duration  time.Duration
+	Failures  []Failure
+	// Skipped are the stops not visited because of their conditions.
+	Skipped []Failure
+	// Stranded is set when the ship could not continue the route (e.g., no fuel to fly), ending the simulation.
+	Stranded bool
+}
+
+// Failure is something that would go wrong in the game.
+type Failure struct {
+	Station string
+	Reason  string
+}
+
+// Simulator replays a route through the commerce logic of the ship, against the recorded data, with a simulated clock.
+type Simulator struct {
+	snapshot *Snapshot
+	route    *component.Route
+	explorer *Explorer
+	details  component.ShipDetails
+	credits  int
+	clock    time.Time
+}
+
+// NewSimulator creates a new instance of Simulator, with the ship as recorded in the snapshot.
+func NewSimulator(snapshot *Snapshot, route *component.Route) *Simulator {
+	details := snapshot.Ship
+	details.Cargo = append([]component.ShipCargo{}, snapshot.Ship.Cargo...)
+
+	clock := snapshot.StartAt
+	if clock.IsZero() && len(snapshot.Markets) > 0 {
+		clock = snapshot.Markets[0].RecordedAt
+	}
+
+	return &Simulator{
+		snapshot: snapshot,
+		route:    route,
+		explorer: NewExplorer(DefaultExploreEvery),
+		details:  details,
+		credits:  snapshot.Credits,
+		clock:    clock,
+	}
+}
+
+// Run simulates the route for the given number of cycles, stopping earlier if the ship gets stranded or the route is
+// finished (see component.Route.Finished). Outside the time windows of the route, the simulated clock jumps to the next
+// one; the time waiting is not part of any cycle. The route to follow next, if any, is not simulated.
+func (sim *Simulator) Run(cycles int) []CycleResult {
+	results := []CycleResult{}
+	for i := 1; i <= cycles; i++ {
+		sim.clock = sim.route.NextWindow(sim.clock)
+		if finished, _ := sim.route.Finished(i-1, sim.clock); finished {
+			break
+		}
+
+		result := sim.cycle(i)
+		results = append(results, result)
+		if result.Stranded {
+			break
+		}
+	}
+	return results
+}
+
+// cycle goes once through all the stops of the route.
+func (sim *Simulator) cycle(number int) CycleResult {
+	result := CycleResult{Cycle: number}
+	startCredits := sim.credits
+	startClock := sim.clock
+
+	stops := sim.route.Route
+	if len(sim.route.Candidates) > 0 {
+		snapshot := *sim.snapshot
+		snapshot.Ship = sim.details
+		snapshot.Credits = sim.credits
+		snapshot.StartAt = sim.clock
+		selection := sim.explorer.SelectRoute(&snapshot, sim.route.Candidates)
+		stops = selection.Chosen.Route
+		result.Route = selection.Chosen.Name
+		result.Reason = selection.Reason
+	}
+
+	for _, stop := range stops {
+		if visit, reason := stop.ShouldVisit(number, sim.details, sim.knownPrice); !visit {
+			result.Skipped = append(result.Skipped, Failure{Station: stop.Station, Reason: reason})
+			continue
+		}
+
+		if sim.details.Location != stop.Station {
+			fuel, err := sim.fly(stop.Station)
+			result.FuelSpent += fuel
+			if err != nil {
+				result.Failures = append(result.Failures, Failure{Station: stop.Station, Reason: err.Error()})
+				result.Stranded = true
+				break
+			}
+		}
+
+		products, ok := sim.snapshot.Marketplace(stop.Station, sim.clock)
+		if !ok {
+			result.Failures = append(result.Failures, Failure{Station: stop.Station, Reason: "no marketplace data"})
+			continue
+		}
+
+		plan := component.PlanCommerce(sim.details, products, stop)
+		for _, order := range plan.Orders {
+			if err := sim.execute(order, products[order.Good]); err != nil {
+				result.Failures = append(result.Failures, Failure{Station: stop.Station, Reason: err.Error()})
+			}
+		}
+	}
+
+	result.Profit = sim.credits - startCredits
+	result.Duration = sim.clock.Sub(startClock)
+	return result
+}
+
+// knownPrice is the price of the good in the last market data recorded at the station, up to the simulated clock.
+func (sim *Simulator) knownPrice(station, good string) (component.Product, bool) {
+	products, ok := sim.snapshot.Marketplace(station, sim.clock)
+	if !ok {
+		return component.Product{}, false
+	}
+	product, ok := products[good]
+	return product, ok
+}
+
+// fly moves the ship to the destination, buying the missing fuel at the current location if possible, like
+// component.Ship.NewFlightPlan does. It returns the fuel spent.
+func (sim *Simulator) fly(destination string) (int, error) {
+	from, ok := sim.snapshot.Locations[sim.details.Location]
+	if !ok {
+		return 0, fmt.Errorf("unknown location %s", sim.details.Location)
+	}
+	to, ok := sim.snapshot.Locations[destination]
+	if !ok {
+		return 0, fmt.Errorf("unknown location %s", destination)
+	}
+
+	distance := navigation.Distance(component.Coordinates{X: from.X, Y: from.Y}, component.Coordinates{X: to.X, Y: to.Y})
+	fuel := sim.snapshot.Flight.Fuel(distance)
+
+	if missing := fuel - sim.quantity("FUEL"); missing > 0 {
+		products, ok := sim.snapshot.Marketplace(sim.details.Location, sim.clock)
+		if !ok {
+			return 0, fmt.Errorf("insufficient fuel to fly to %s: %d more required", destination, missing)
+		}
+		if err := sim.execute(component.Order{Action: "buy", Good: "FUEL", Quantity: missing}, products["FUEL"]); err != nil {
+			return 0, fmt.Errorf("insufficient fuel to fly to %s: %v", destination, err)
+		}
+	}
+
+	sim.move("FUEL", -fuel, 1)
+	sim.details.Location = destination
+	sim.clock = sim.clock.Add(sim.snapshot.Flight.Duration(distance, sim.details.Speed))
+	return fuel, nil
+}
+
+// execute applies the order to the simulated ship, checking credits, cargo and what the marketplace trades.
+func (sim *Simulator) execute(order component.Order, product component.Product) error {
+	if len(product.Symbol) < 1 {
+		return fmt.Errorf("%s %d %s: not traded in marketplace", order.Action, order.Quantity, order.Good)
+	}
+
+	switch order.Action {
+	case "sell":
+		if held := sim.quantity(order.Good); order.Quantity > held {
+			return fmt.Errorf("sell %d %s: only %d in cargo", order.Quantity, order.Good, held)
+		}
+		sim.credits += order.Quantity * product.SellPricePerUnit
+		sim.move(order.Good, -order.Quantity, product.VolumePerUnit)
+	case "buy":
+		if volume := order.Quantity * product.VolumePerUnit; volume > sim.details.SpaceAvailable {
+			return fmt.Errorf("buy %d %s: insufficient cargo space (%d required, %d available)",
+				order.Quantity, order.Good, volume, sim.details.SpaceAvailable)
+		}
+		if total := order.Quantity * product.PurchasePricePerUnit; total > sim.credits {
+			return fmt.Errorf("buy %d %s: insufficient credits (%d required, %d available)",
+				order.Quantity, order.Good, total, sim.credits)
+		}
+		sim.credits -= order.Quantity * product.PurchasePricePerUnit
+		sim.move(order.Good, order.Quantity, product.VolumePerUnit)
+	}
+	return nil
+}
+
+// quantity returns how many units of the good are in the cargo.
+func (sim *Simulator) quantity(good string) int {
+	for _, c := range sim.details.Cargo {
+		if c.Good == good {
+			return c.Quantity
+		}
+	}
+	return 0
+}
+
+// move adds (or removes, if quantity is negative) the good to the cargo.
+func (sim *Simulator) move(good string, quantity, volumePerUnit int) {
+	found := false
+	cargo := []component.ShipCargo{}
+	for _, c := range sim.details.Cargo {
+		if c.Good == good {
+			found = true
+			c.Quantity += quantity
+			c.TotalVolume += quantity * volumePerUnit
+		}
+		if c.Quantity > 0 {
+			cargo = append(cargo, c)
+		}
+	}
+	if !found && quantity > 0 {
+		cargo = append(cargo, component.ShipCargo{Good: good, Quantity: quantity, TotalVolume: quantity * volumePerUnit})
+	}
+
+	sim.details.Cargo = cargo
+	sim.details.SpaceAvailable -= quantity * volumePerUnit
+}
+
+// Print writes the results as a table, with the totals at the end.
+func Print(w io.Writer, results []CycleResult) {
+	fmt.Fprintf(w, "%-6s %10s %6s %8s %12s %s\n", "cycle", "profit", "fuel", "hours", "profit/hour", "failures")
+
+	totalProfit := 0
+	totalFuel := 0
+	var totalDuration time.Duration
+	for _, r := range results {
+		fmt.Fprintf(w, "%-6d %10d %6d %8.2f %12.1f %d\n",
+			r.Cycle, r.Profit, r.FuelSpent, r.Duration.Hours(), perHour(r.Profit, r.Duration), len(r.Failures))
+		if len(r.Route) > 0 {
+			fmt.Fprintf(w, "         route %s: %s\n", r.Route, r.Reason)
+		}
+		for _, f := range r.Failures {
+			fmt.Fprintf(w, "         %s: %s\n", f.Station, f.Reason)
+		}
+		for _, f := range r.Skipped {
+			fmt.Fprintf(w, "         %s: skipped, %s\n", f.Station, f.Reason)
+		}
+		if r.Stranded {
+			fmt.Fprintln(w, "         ship stranded, simulation stopped")
+		}
+		totalProfit += r.Profit
+		totalFuel += r.FuelSpent
+		totalDuration += r.Duration
+	}
+
+	fmt.Fprintf(w, "%-6s %10d %6d %8.2f %12.1f\n",
+		"total", totalProfit, totalFuel, totalDuration.Hours(), perHour(totalProfit, totalDuration))
+}
+
+// perHour returns the profit per hour, or zero if no time has passed.
+func perHour(profit int, duration time.Duration) float64 {
+	if duration <= 0 {
+		return 0
+	}
+	return float64(profit) / duration.Hours()
+}
@@ -0,0 +1,152 @@
+package backtest_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/otaviokr/spacetraders-ship/backtest"
+	"github.com/otaviokr/spacetraders-ship/component"
+)
+
+const snapshotYaml = `
+ship:
+  id: id0001
+  location: A
+  cargo:
+    - good: FUEL
+      quantity: 20
+      totalVolume: 20
+  spaceAvailable: 80
+  maxCargo: 100
+  speed: 1
+credits: 1000
+locations:
+  A: {x: 0, y: 0}
+  B: {x: 0, y: 40}
+markets:
+  - location: A
+    recordedAt: 2022-07-01T10:00:00Z
+    marketplace:
+      - {symbol: FUEL, purchasePricePerUnit: 2, sellPricePerUnit: 1, volumePerUnit: 1}
+      - {symbol: GOOD, purchasePricePerUnit: 10, sellPricePerUnit: 8, volumePerUnit: 1}
+  - location: B
+    recordedAt: 2022-07-01T10:00:00Z
+    marketplace:
+      - {symbol: FUEL, purchasePricePerUnit: 3, sellPricePerUnit: 2, volumePerUnit: 1}
+      - {symbol: GOOD, purchasePricePerUnit: 25, sellPricePerUnit: 20, volumePerUnit: 1}
+`
+
+const routeYaml = `
+route:
+  - station: A
+    buy:
+      FUEL: 30
+      GOOD: 50
+  - station: B
+    sell:
+      GOOD: -1
+`
+
+func TestSimulatorRun(t *testing.T) {
+	snapshot, err := backtest.ReadSnapshot(strings.NewReader(snapshotYaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	route, err := component.ReadRouteDescription(strings.NewReader(routeYaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []backtest.CycleResult{
+		{Cycle: 1, Profit: 480, FuelSpent: 11, Duration: 110 * time.Second},
+		{Cycle: 2, Profit: 456, FuelSpent: 22, Duration: 220 * time.Second}}
+
+	actual := backtest.NewSimulator(snapshot, route).Run(2)
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("\nACTUAL: %+v\nEXPECT: %+v\n", actual, expected)
+	}
+}
+
+func TestSimulatorStranded(t *testing.T) {
+	snapshot, err := backtest.ReadSnapshot(strings.NewReader(snapshotYaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshot.Ship.Cargo = nil
+	snapshot.Credits = 0
+
+	route, err := component.ReadRouteDescription(strings.NewReader(routeYaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	route.Route = route.Route[1:]
+
+	actual := backtest.NewSimulator(snapshot, route).Run(3)
+	if len(actual) != 1 || !actual[0].Stranded || len(actual[0].Failures) != 1 {
+		t.Fatalf("expected the ship to be stranded in the first cycle: %+v", actual)
+	}
+}
+
+func TestSnapshotMarketplace(t *testing.T) {
+	snapshot := &backtest.Snapshot{
+		Markets: []backtest.MarketSnapshot{
+			{Location: "A", RecordedAt: time.Date(2022, 7, 1, 10, 0, 0, 0, time.UTC), Marketplace: []component.Product{{Symbol: "GOOD", SellPricePerUnit: 1}}},
+			{Location: "A", RecordedAt: time.Date(2022, 7, 1, 12, 0, 0, 0, time.UTC), Marketplace: []component.Product{{Symbol: "GOOD", SellPricePerUnit: 2}}}}}
+
+	useCases := map[string]map[string]interface{}{
+		"before all":  {"at": time.Date(2022, 7, 1, 9, 0, 0, 0, time.UTC), "expected": 1},
+		"in between":  {"at": time.Date(2022, 7, 1, 11, 0, 0, 0, time.UTC), "expected": 1},
+		"after all":   {"at": time.Date(2022, 7, 1, 13, 0, 0, 0, time.UTC), "expected": 2},
+		"exact match": {"at": time.Date(2022, 7, 1, 12, 0, 0, 0, time.UTC), "expected": 2}}
+
+	for name, uc := range useCases {
+		products, ok := snapshot.Marketplace("A", uc["at"].(time.Time))
+		if !ok || products["GOOD"].SellPricePerUnit != uc["expected"].(int) {
+			t.Fatalf("%s\nACTUAL: %+v\nEXPECT: %d\n", name, products, uc["expected"])
+		}
+	}
+
+	if _, ok := snapshot.Marketplace("B", time.Now()); ok {
+		t.Fatal("expected no marketplace for B")
+	}
+}
+
+func TestSimulatorConditions(t *testing.T) {
+	snapshot, err := backtest.ReadSnapshot(strings.NewReader(snapshotYaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	route, err := component.ReadRouteDescription(strings.NewReader(routeYaml + "    when:\n      every: 2\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := [][]backtest.Failure{
+		nil,
+		{{Station: "B", Reason: "only visited every 2 cycles"}},
+		nil}
+
+	results := backtest.NewSimulator(snapshot, route).Run(3)
+	for i, result := range results {
+		if !reflect.DeepEqual(result.Skipped, expected[i]) {
+			t.Fatalf("\nACTUAL: cycle %d skipped %+v\nEXPECT: %+v\n", result.Cycle, result.Skipped, expected[i])
+		}
+	}
+}
+
+func TestSimulatorCycleLimit(t *testing.T) {
+	snapshot, err := backtest.ReadSnapshot(strings.NewReader(snapshotYaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	route, err := component.ReadRouteDescription(strings.NewReader("cycles: 1\n" + routeYaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if actual := backtest.NewSimulator(snapshot, route).Run(5); len(actual) != 1 {
+		t.Fatalf("\nACTUAL: %d cycles\nEXPECT: 1 cycle\n", len(actual))
+	}
+}
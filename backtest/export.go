@@ -0,0 +1,117 @@
+package backtest
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/otaviokr/spacetraders-ship/component"
+	"github.com/otaviokr/spacetraders-ship/gameerror"
+	"github.com/otaviokr/spacetraders-ship/kafka"
+	"gopkg.in/yaml.v3"
+)
+
+// SnapshotFromCassette builds the recorded data for a backtest from the interactions recorded by the ship (see
+// kafka.Recorder): the ship as first seen, its credits before the first trade, where each visited location is, every
+// marketplace consulted and, if any flight was recorded, the fuel spent per distance.
+func SnapshotFromCassette(interactions []kafka.Interaction) (*Snapshot, error) {
+	snapshot := Snapshot{
+		Flight:    DefaultFlightModel(),
+		Locations: map[string]Location{},
+	}
+	foundShip := false
+	foundCredits := false
+	var flights, fuel, distance int
+
+	for _, interaction := range interactions {
+		if len(interaction.Error) > 0 {
+			continue
+		}
+		if snapshot.StartAt.IsZero() {
+			snapshot.StartAt = interaction.Time
+		}
+
+		switch interaction.Method {
+		case "GetShipInfo":
+			var ship component.Ship
+			if !decode(interaction, &ship) || len(ship.Details.Id) < 1 {
+				continue
+			}
+			if !foundShip {
+				snapshot.Ship = ship.Details
+				foundShip = true
+			}
+			if len(ship.Details.Location) > 0 {
+				snapshot.Locations[ship.Details.Location] = Location{X: ship.Details.X, Y: ship.Details.Y}
+			}
+
+		case "GetMarketplaceProducts":
+			var marketplace component.Marketplace
+			if len(interaction.Args) < 1 || !decode(interaction, &marketplace) || len(marketplace.Products) < 1 {
+				continue
+			}
+			snapshot.Markets = append(snapshot.Markets, MarketSnapshot{
+				Location:    interaction.Args[0],
+				RecordedAt:  interaction.Time,
+				Marketplace: marketplace.Products,
+			})
+
+		case "SetNewFlightPlan":
+			var flightPlan component.FlightPlan
+			if !decode(interaction, &flightPlan) || flightPlan.Details.Distance < 1 {
+				continue
+			}
+			flights++
+			fuel += flightPlan.Details.FuelConsumed
+			distance += flightPlan.Details.Distance
+
+		case "BuyGood", "SellGood":
+			var trade component.Trade
+			if foundCredits || !decode(interaction, &trade) || len(trade.Order.Good) < 1 {
+				continue
+			}
+			// The response has the credits after the trade.
+			snapshot.Credits = trade.Credits + trade.Order.Total
+			if interaction.Method == "SellGood" {
+				snapshot.Credits = trade.Credits - trade.Order.Total
+			}
+			foundCredits = true
+		}
+	}
+
+	if len(snapshot.Markets) < 1 {
+		return nil, fmt.Errorf("backtest: no marketplace recorded in the cassette")
+	}
+	if !foundShip {
+		return nil, fmt.Errorf("backtest: no ship details recorded in the cassette")
+	}
+	if distance > 0 {
+		// Each flight spends FuelBase plus FuelPerDistance for each unit of distance.
+		perDistance := (float64(fuel) - float64(flights)*snapshot.Flight.FuelBase) / float64(distance)
+		if perDistance > 0 {
+			snapshot.Flight.FuelPerDistance = math.Round(perDistance*1000) / 1000
+		}
+	}
+
+	return &snapshot, nil
+}
+
+// decode reads the response of the interaction, telling if it is valid and not an error from the game.
+func decode(interaction kafka.Interaction, out interface{}) bool {
+	data := []byte(interaction.Response)
+	if gameerror.Parse(data) != nil {
+		return false
+	}
+	return yaml.NewDecoder(bytes.NewReader(data)).Decode(out) == nil
+}
+
+// WriteSnapshot writes the snapshot in the same format ReadSnapshot reads.
+func WriteSnapshot(w io.Writer, snapshot *Snapshot) error {
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(snapshot); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
@@ -0,0 +1,115 @@
+package backtest_test
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/otaviokr/spacetraders-ship/backtest"
+	"github.com/otaviokr/spacetraders-ship/kafka"
+)
+
+const cassetteYaml = `
+---
+time: 2022-07-01T10:00:00Z
+method: GetShipInfo
+response: '{"ship":{"id":"id0001","location":"A","x":0,"y":0,"cargo":[{"good":"FUEL","quantity":20,"totalVolume":20}],"spaceAvailable":80,"maxCargo":100,"speed":1}}'
+---
+time: 2022-07-01T10:00:01Z
+method: GetMarketplaceProducts
+args: [A]
+response: '{"marketplace":[{"purchasePricePerUnit":12,"sellPricePerUnit":10,"symbol":"Good0001","volumePerUnit":1,"quantityAvailable":500}]}'
+---
+time: 2022-07-01T10:00:02Z
+method: BuyGood
+args: [Good0001, "50"]
+response: '{"credits":400,"order":{"good":"Good0001","pricePerUnit":12,"quantity":50,"total":600}}'
+---
+time: 2022-07-01T10:00:03Z
+method: SetNewFlightPlan
+args: [B]
+response: '{"flightPlan":{"departure":"A","destination":"B","distance":40,"fuelConsumed":11,"timeRemainingInSeconds":110}}'
+---
+time: 2022-07-01T10:02:00Z
+method: GetShipInfo
+response: '{"ship":{"id":"id0001","location":"B","x":30,"y":40,"cargo":[],"spaceAvailable":100,"maxCargo":100,"speed":1}}'
+---
+time: 2022-07-01T10:02:01Z
+method: GetMarketplaceProducts
+args: [B]
+error: no reply from the gateway
+---
+time: 2022-07-01T10:02:02Z
+method: GetMarketplaceProducts
+args: [B]
+response: '{"error":{"message":"Service unavailable","code":503}}'
+---
+time: 2022-07-01T10:02:03Z
+method: GetMarketplaceProducts
+args: [B]
+response: '{"marketplace":[{"purchasePricePerUnit":22,"sellPricePerUnit":20,"symbol":"Good0001","volumePerUnit":1,"quantityAvailable":300}]}'
+`
+
+func TestSnapshotFromCassette(t *testing.T) {
+	replay, err := kafka.ReadCassette(strings.NewReader(cassetteYaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot, err := backtest.SnapshotFromCassette(replay.Interactions())
+	if err != nil {
+		t.Fatalf("\nACTUAL: %v\nEXPECT: no error\n", err)
+	}
+
+	if snapshot.Ship.Id != "id0001" || snapshot.Ship.Location != "A" || snapshot.Ship.SpaceAvailable != 80 {
+		t.Fatalf("\nACTUAL: %+v\nEXPECT: ship id0001 at A, as first seen\n", snapshot.Ship)
+	}
+	if snapshot.Credits != 1000 {
+		t.Fatalf("\nACTUAL: %d\nEXPECT: 1000 credits before the first trade\n", snapshot.Credits)
+	}
+	if !snapshot.StartAt.Equal(time.Date(2022, 7, 1, 10, 0, 0, 0, time.UTC)) {
+		t.Fatalf("\nACTUAL: %s\nEXPECT: time of the first interaction\n", snapshot.StartAt)
+	}
+
+	expectedLocations := map[string]backtest.Location{"A": {X: 0, Y: 0}, "B": {X: 30, Y: 40}}
+	if !reflect.DeepEqual(snapshot.Locations, expectedLocations) {
+		t.Fatalf("\nACTUAL: %+v\nEXPECT: %+v\n", snapshot.Locations, expectedLocations)
+	}
+
+	// The failed requests are not recorded.
+	if len(snapshot.Markets) != 2 || snapshot.Markets[0].Location != "A" || snapshot.Markets[1].Location != "B" ||
+		snapshot.Markets[1].Marketplace[0].PurchasePricePerUnit != 22 {
+		t.Fatalf("\nACTUAL: %+v\nEXPECT: markets at A and B\n", snapshot.Markets)
+	}
+
+	// (11 - 1) / 40
+	if snapshot.Flight.FuelPerDistance != 0.25 {
+		t.Fatalf("\nACTUAL: %v\nEXPECT: 0.25\n", snapshot.Flight.FuelPerDistance)
+	}
+
+	// The snapshot can be read back for the backtest.
+	var out bytes.Buffer
+	if err = backtest.WriteSnapshot(&out, snapshot); err != nil {
+		t.Fatalf("\nACTUAL: %v\nEXPECT: no error\n", err)
+	}
+	read, err := backtest.ReadSnapshot(&out)
+	if err != nil {
+		t.Fatalf("\nACTUAL: %v\nEXPECT: no error\n", err)
+	}
+	if !reflect.DeepEqual(read, snapshot) {
+		t.Fatalf("\nACTUAL: %+v\nEXPECT: %+v\n", read, snapshot)
+	}
+}
+
+func TestSnapshotFromCassetteWithoutMarkets(t *testing.T) {
+	replay, err := kafka.ReadCassette(strings.NewReader(strings.Split(cassetteYaml, "---")[1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = backtest.SnapshotFromCassette(replay.Interactions()); err == nil {
+		t.Fatalf("\nACTUAL: no error\nEXPECT: no marketplace recorded\n")
+	}
+}
@@ -0,0 +1,208 @@
+package backtest
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/otaviokr/spacetraders-ship/component"
+	"github.com/otaviokr/spacetraders-ship/navigation"
+	"github.com/otaviokr/spacetraders-ship/web"
+)
+
+// estimateCycles is how many cycles are simulated to estimate a route. The first one includes flying to the route, so
+// only the last one is used, as what the route yields once the ship is on it.
+const estimateCycles = 2
+
+// Estimate is the expected outcome of one cycle of a candidate route, simulated against the recorded data.
+type Estimate struct {
+	Name          string
+	Profit        int
+	Duration      time.Duration
+	ProfitPerHour float64
+	// Unknown lists what the data lacks to estimate the route (e.g., a station never visited). If not empty, the other
+	// fields are meaningless.
+	Unknown []string
+}
+
+// Selection is the candidate chosen, why it was chosen, and the estimates of all the candidates, in their order.
+type Selection struct {
+	Chosen    component.Candidate
+	Reason    string
+	Estimates []Estimate
+	// Stranded is set when every candidate that can be estimated strands the ship, and none is left to explore; the
+	// first of them is chosen anyway, since the ship must follow some route.
+	Stranded bool
+}
+
+// DefaultExploreEvery is how many cycles pass before a candidate that could not be estimated is explored again.
+const DefaultExploreEvery = 10
+
+// Explorer chooses the candidate of each cycle, remembering which ones it chose to learn about them.
+type Explorer struct {
+	every    int
+	cycle    int
+	explored map[string]int
+}
+
+// NewExplorer creates a new instance of Explorer, exploring a candidate again after the given number of cycles if the
+// ship still cannot estimate it (e.g., its station is a typo, or its stops were skipped).
+func NewExplorer(every int) *Explorer {
+	if every < 1 {
+		every = 1
+	}
+	return &Explorer{every: every, explored: map[string]int{}}
+}
+
+// SelectRoute chooses the candidate for the first cycle of a ship with no history (see Explorer.SelectRoute).
+func SelectRoute(snapshot *Snapshot, candidates []component.Candidate) Selection {
+	return NewExplorer(DefaultExploreEvery).SelectRoute(snapshot, candidates)
+}
+
+// SelectRoute chooses the candidate for the next cycle, with the best expected profit per hour, simulating each one
+// against the snapshot; a cycle with failures still counts, with what it would yield despite them. A candidate that
+// cannot be estimated yet is chosen instead (the first one in the list, if there are many), so the ship learns what is
+// missing; if it still cannot be estimated after that, it is only explored again after some cycles. A candidate that
+// strands the ship is never the best one: if they all do, it is reported (see Selection.Stranded). If no candidate can
+// be estimated, the first one is chosen anyway.
+func (e *Explorer) SelectRoute(snapshot *Snapshot, candidates []component.Candidate) Selection {
+	e.cycle++
+
+	selection := Selection{}
+	best, explore, stranded := -1, -1, -1
+	for i, candidate := range candidates {
+		estimate := EstimateRoute(snapshot, candidate)
+		selection.Estimates = append(selection.Estimates, estimate)
+
+		if len(estimate.Unknown) > 0 {
+			if last, ok := e.explored[candidate.Name]; explore < 0 && (!ok || e.cycle-last >= e.every) {
+				explore = i
+			}
+			continue
+		}
+		if math.IsInf(estimate.ProfitPerHour, -1) {
+			if stranded < 0 {
+				stranded = i
+			}
+			continue
+		}
+		if best < 0 || estimate.ProfitPerHour > selection.Estimates[best].ProfitPerHour {
+			best = i
+		}
+	}
+
+	switch {
+	case explore >= 0:
+		e.explored[candidates[explore].Name] = e.cycle
+		selection.Chosen = candidates[explore]
+		selection.Reason = fmt.Sprintf("not estimated yet, unknown %s",
+			strings.Join(selection.Estimates[explore].Unknown, ", "))
+	case best >= 0:
+		selection.Chosen = candidates[best]
+		selection.Reason = fmt.Sprintf("best expected profit per hour (%.1f)", selection.Estimates[best].ProfitPerHour)
+	case stranded >= 0:
+		selection.Chosen = candidates[stranded]
+		selection.Reason = "all candidates strand the ship"
+		selection.Stranded = true
+	case len(candidates) > 0:
+		selection.Chosen = candidates[0]
+		selection.Reason = fmt.Sprintf("no candidate can be estimated, unknown %s",
+			strings.Join(selection.Estimates[0].Unknown, ", "))
+	}
+	return selection
+}
+
+// ReportEstimates exposes the expected profit per hour of the candidates in the metrics. A candidate that cannot be
+// estimated or strands the ship has no expected profit, so what was exposed for it before is removed.
+func ReportEstimates(shipId string, estimates []Estimate) {
+	for _, estimate := range estimates {
+		if len(estimate.Unknown) > 0 || math.IsInf(estimate.ProfitPerHour, 0) {
+			web.RouteExpectedProfitPerHour.DeleteLabelValues(shipId, estimate.Name)
+			continue
+		}
+		web.RouteExpectedProfitPerHour.WithLabelValues(shipId, estimate.Name).Set(estimate.ProfitPerHour)
+	}
+}
+
+// EstimateRoute simulates the candidate against the snapshot, returning what one cycle is expected to yield.
+func EstimateRoute(snapshot *Snapshot, candidate component.Candidate) Estimate {
+	estimate := Estimate{Name: candidate.Name}
+
+	if _, ok := snapshot.Locations[snapshot.Ship.Location]; !ok {
+		estimate.Unknown = append(estimate.Unknown, "location of "+snapshot.Ship.Location)
+	}
+	for _, station := range stations(candidate.Route) {
+		if _, ok := snapshot.Locations[station]; !ok && station != snapshot.Ship.Location {
+			estimate.Unknown = append(estimate.Unknown, "location of "+station)
+		}
+		if _, ok := snapshot.Marketplace(station, snapshot.StartAt); !ok {
+			estimate.Unknown = append(estimate.Unknown, "marketplace of "+station)
+		}
+	}
+	if len(estimate.Unknown) > 0 {
+		return estimate
+	}
+
+	results := NewSimulator(snapshot, &component.Route{Route: candidate.Route}).Run(estimateCycles)
+	last := results[len(results)-1]
+	if last.Stranded {
+		// The ship would not even complete the route, which is as bad as it gets.
+		estimate.ProfitPerHour = math.Inf(-1)
+		return estimate
+	}
+
+	estimate.Profit = last.Profit
+	estimate.Duration = last.Duration
+	estimate.ProfitPerHour = perHour(last.Profit, last.Duration)
+	return estimate
+}
+
+// stations lists the stations of the stops, in order, without repeating them.
+func stations(stops []component.RouteStop) []string {
+	seen := map[string]bool{}
+	list := []string{}
+	for _, stop := range stops {
+		if !seen[stop.Station] {
+			seen[stop.Station] = true
+			list = append(list, stop.Station)
+		}
+	}
+	return list
+}
+
+// SnapshotFromObservations builds the data to estimate routes from what the ship learned while flying (see
+// component.Ship.Observations), starting now, with the flight model calibrated with its flights (see
+// navigation.Calibrate). The credits are not known to the ship, so they never limit the purchases.
+func SnapshotFromObservations(details component.ShipDetails, observations component.Observations,
+	now time.Time) *Snapshot {
+	snapshot := &Snapshot{
+		Ship:      details,
+		Credits:   math.MaxInt32,
+		StartAt:   now,
+		Flight:    navigation.FromObservations(observations).Model(details.Type),
+		Locations: map[string]Location{},
+	}
+
+	for station, coordinates := range observations.Locations {
+		snapshot.Locations[station] = Location{X: coordinates.X, Y: coordinates.Y}
+	}
+	for station, market := range observations.Markets {
+		products := make([]component.Product, 0, len(market.Products))
+		for _, product := range market.Products {
+			products = append(products, product)
+		}
+		sort.Slice(products, func(i, j int) bool { return products[i].Symbol < products[j].Symbol })
+		snapshot.Markets = append(snapshot.Markets, MarketSnapshot{
+			Location:    station,
+			RecordedAt:  market.SeenAt,
+			Marketplace: products,
+		})
+	}
+	sort.SliceStable(snapshot.Markets, func(i, j int) bool {
+		return snapshot.Markets[i].RecordedAt.Before(snapshot.Markets[j].RecordedAt)
+	})
+
+	return snapshot
+}
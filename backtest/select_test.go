@@ -0,0 +1,197 @@
+package backtest_test
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/otaviokr/spacetraders-ship/backtest"
+	"github.com/otaviokr/spacetraders-ship/component"
+	"github.com/otaviokr/spacetraders-ship/web"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+const candidatesYaml = `
+candidates:
+  - name: cheap
+    route:
+      - station: A
+        buy:
+          FUEL: 30
+          GOOD: 10
+      - station: B
+        sell:
+          GOOD: -1
+  - name: full
+    route:
+      - station: A
+        buy:
+          FUEL: 30
+          GOOD: 50
+      - station: B
+        sell:
+          GOOD: -1
+  - name: unknown
+    route:
+      - station: C
+`
+
+func TestSelectRoute(t *testing.T) {
+	snapshot, err := backtest.ReadSnapshot(strings.NewReader(snapshotYaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	route, err := component.ReadRouteDescription(strings.NewReader(candidatesYaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	useCases := map[string]map[string]interface{}{
+		"best profit per hour": {
+			"candidates": route.Candidates[:2],
+			"chosen":     "full",
+			"reason":     "best expected profit per hour",
+		},
+		"unknown first": {
+			"candidates": route.Candidates,
+			"chosen":     "unknown",
+			"reason":     "not estimated yet, unknown location of C, marketplace of C",
+		},
+	}
+
+	for name, uc := range useCases {
+		t.Run(name, func(t *testing.T) {
+			selection := backtest.SelectRoute(snapshot, uc["candidates"].([]component.Candidate))
+			if selection.Chosen.Name != uc["chosen"].(string) || !strings.HasPrefix(selection.Reason, uc["reason"].(string)) {
+				t.Fatalf("\nACTUAL: %s (%s)\nEXPECT: %s (%s)\n",
+					selection.Chosen.Name, selection.Reason, uc["chosen"], uc["reason"])
+			}
+			if len(selection.Estimates) != len(uc["candidates"].([]component.Candidate)) {
+				t.Fatalf("\nACTUAL: %d estimates\nEXPECT: one per candidate\n", len(selection.Estimates))
+			}
+		})
+	}
+}
+
+func TestSelectRouteStranded(t *testing.T) {
+	snapshot, err := backtest.ReadSnapshot(strings.NewReader(snapshotYaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Too far to carry the fuel, and with nothing to buy there.
+	snapshot.Locations["FAR"] = backtest.Location{X: 0, Y: 4000}
+	snapshot.Markets = append(snapshot.Markets, backtest.MarketSnapshot{Location: "FAR",
+		RecordedAt: snapshot.Markets[0].RecordedAt})
+	route, err := component.ReadRouteDescription(strings.NewReader(candidatesYaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	far := component.Candidate{Name: "far", Route: []component.RouteStop{{Station: "A"}, {Station: "FAR"}}}
+
+	useCases := map[string]map[string]interface{}{
+		"stranding never best": {
+			"candidates": []component.Candidate{far, route.Candidates[0]},
+			"chosen":     "cheap",
+			"reason":     "best expected profit per hour",
+			"stranded":   false,
+		},
+		"all stranding": {
+			"candidates": []component.Candidate{far},
+			"chosen":     "far",
+			"reason":     "all candidates strand the ship",
+			"stranded":   true,
+		},
+	}
+
+	for name, uc := range useCases {
+		t.Run(name, func(t *testing.T) {
+			selection := backtest.SelectRoute(snapshot, uc["candidates"].([]component.Candidate))
+			if selection.Chosen.Name != uc["chosen"].(string) || !strings.HasPrefix(selection.Reason, uc["reason"].(string)) ||
+				selection.Stranded != uc["stranded"].(bool) {
+				t.Fatalf("\nACTUAL: %s (%s, stranded %t)\nEXPECT: %s (%s, stranded %t)\n", selection.Chosen.Name,
+					selection.Reason, selection.Stranded, uc["chosen"], uc["reason"], uc["stranded"])
+			}
+		})
+	}
+}
+
+func TestReportEstimates(t *testing.T) {
+	before := testutil.CollectAndCount(web.RouteExpectedProfitPerHour)
+	backtest.ReportEstimates("id0099", []backtest.Estimate{
+		{Name: "cheap", ProfitPerHour: 100}, {Name: "full", ProfitPerHour: 200}, {Name: "far", ProfitPerHour: 300}})
+	if count := testutil.CollectAndCount(web.RouteExpectedProfitPerHour); count != before+3 {
+		t.Fatalf("\nACTUAL: %d routes\nEXPECT: %d routes\n", count-before, 3)
+	}
+
+	// Neither the route now stranding the ship nor the one that cannot be estimated keep their last estimate.
+	backtest.ReportEstimates("id0099", []backtest.Estimate{
+		{Name: "cheap", ProfitPerHour: 150}, {Name: "full", Unknown: []string{"location of C"}},
+		{Name: "far", ProfitPerHour: math.Inf(-1)}})
+	if count := testutil.CollectAndCount(web.RouteExpectedProfitPerHour); count != before+1 {
+		t.Fatalf("\nACTUAL: %d routes\nEXPECT: %d routes\n", count-before, 1)
+	}
+	if value := testutil.ToFloat64(web.RouteExpectedProfitPerHour.WithLabelValues("id0099", "cheap")); value != 150 {
+		t.Fatalf("\nACTUAL: %f\nEXPECT: %f\n", value, 150.0)
+	}
+}
+
+func TestExplorer(t *testing.T) {
+	snapshot, err := backtest.ReadSnapshot(strings.NewReader(snapshotYaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	route, err := component.ReadRouteDescription(strings.NewReader(candidatesYaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	useCases := map[string]map[string]interface{}{
+		"unknown explored again later": {
+			"candidates": route.Candidates,
+			"chosen":     []string{"unknown", "full", "full", "unknown", "full"},
+		},
+		"only unknown": {
+			"candidates": route.Candidates[2:],
+			"chosen":     []string{"unknown", "unknown", "unknown"},
+		},
+	}
+
+	for name, uc := range useCases {
+		t.Run(name, func(t *testing.T) {
+			explorer := backtest.NewExplorer(3)
+			chosen := []string{}
+			for range uc["chosen"].([]string) {
+				chosen = append(chosen, explorer.SelectRoute(snapshot, uc["candidates"].([]component.Candidate)).Chosen.Name)
+			}
+			if !reflect.DeepEqual(chosen, uc["chosen"]) {
+				t.Fatalf("\nACTUAL: %v\nEXPECT: %v\n", chosen, uc["chosen"])
+			}
+		})
+	}
+}
+
+func TestSnapshotFromObservations(t *testing.T) {
+	now := time.Date(2022, 7, 1, 10, 0, 0, 0, time.UTC)
+	details := component.ShipDetails{Id: "id0001", Location: "A", Speed: 1, SpaceAvailable: 100}
+	observations := component.Observations{
+		Locations: map[string]component.Coordinates{"A": {X: 0, Y: 0}, "B": {X: 0, Y: 40}},
+		Markets: map[string]component.ObservedMarket{
+			"A": {SeenAt: now, Products: map[string]component.Product{
+				"FUEL": {Symbol: "FUEL", PurchasePricePerUnit: 2, VolumePerUnit: 1},
+				"GOOD": {Symbol: "GOOD", PurchasePricePerUnit: 10, VolumePerUnit: 1}}},
+			"B": {SeenAt: now, Products: map[string]component.Product{
+				"GOOD": {Symbol: "GOOD", SellPricePerUnit: 20, VolumePerUnit: 1}}}}}
+
+	snapshot := backtest.SnapshotFromObservations(details, observations, now)
+	estimate := backtest.EstimateRoute(snapshot, component.Candidate{
+		Name: "simple",
+		Route: []component.RouteStop{
+			{Station: "A", Buy: map[string]int{"FUEL": 30, "GOOD": 50}},
+			{Station: "B", Sell: map[string]int{"GOOD": component.SellEverything}}}})
+
+	if len(estimate.Unknown) > 0 || estimate.Profit <= 0 || estimate.ProfitPerHour <= 0 {
+		t.Fatalf("\nACTUAL: %+v\nEXPECT: a profitable estimate\n", estimate)
+	}
+}
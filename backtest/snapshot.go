@@ -0,0 +1,92 @@
+package backtest
+
+import (
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/otaviokr/spacetraders-ship/component"
+	"github.com/otaviokr/spacetraders-ship/navigation"
+	"gopkg.in/yaml.v3"
+)
+
+// Snapshot is the recorded data the route is replayed against: where the ship starts, where the locations are and
+// what the marketplaces traded over time.
+type Snapshot struct {
+	Ship      component.ShipDetails `yaml:"ship"`
+	Credits   int                   `yaml:"credits"`
+	StartAt   time.Time             `yaml:"startAt"`
+	Flight    FlightModel           `yaml:"flight"`
+	Locations map[string]Location   `yaml:"locations"`
+	Markets   []MarketSnapshot      `yaml:"markets"`
+}
+
+// Location is where a station is in the system.
+type Location struct {
+	X int `yaml:"x"`
+	Y int `yaml:"y"`
+}
+
+// MarketSnapshot is the marketplace of a location, as recorded at some point in time.
+type MarketSnapshot struct {
+	Location    string              `yaml:"location"`
+	RecordedAt  time.Time           `yaml:"recordedAt"`
+	Marketplace []component.Product `yaml:"marketplace"`
+}
+
+// FlightModel estimates how much fuel and time a flight takes, given its distance (see navigation.FlightModel).
+type FlightModel = navigation.FlightModel
+
+// DefaultFlightModel returns the values observed in the game for the most common ships.
+func DefaultFlightModel() FlightModel {
+	return navigation.DefaultFlightModel()
+}
+
+// ReadSnapshotFile will read the YAML file with the recorded data.
+func ReadSnapshotFile(path string) (*Snapshot, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadSnapshot(f)
+}
+
+// ReadSnapshot will generate the Snapshot instance from the data read from YAML file.
+func ReadSnapshot(data io.Reader) (*Snapshot, error) {
+	snapshot := Snapshot{Flight: DefaultFlightModel()}
+	decoder := yaml.NewDecoder(data)
+	if err := decoder.Decode(&snapshot); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(snapshot.Markets, func(i, j int) bool {
+		return snapshot.Markets[i].RecordedAt.Before(snapshot.Markets[j].RecordedAt)
+	})
+	return &snapshot, nil
+}
+
+// Marketplace returns the products traded at the location at the given time: the latest snapshot recorded before
+// that, or the earliest one if all were recorded later. The boolean is false if there is no snapshot for the location.
+func (s *Snapshot) Marketplace(location string, at time.Time) (map[string]component.Product, bool) {
+	var found *MarketSnapshot
+	for i, market := range s.Markets {
+		if market.Location != location {
+			continue
+		}
+		if found == nil || !market.RecordedAt.After(at) {
+			found = &s.Markets[i]
+		}
+	}
+
+	if found == nil {
+		return nil, false
+	}
+
+	products := map[string]component.Product{}
+	for _, product := range found.Marketplace {
+		products[product.Symbol] = product
+	}
+	return products, true
+}
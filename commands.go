@@ -0,0 +1,92 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/otaviokr/spacetraders-ship/config"
+	"github.com/otaviokr/spacetraders-ship/telemetry"
+)
+
+// command is a subcommand of the binary. All of them load the configuration the same way (see loadConfig), so the
+// same image and environment can be used to run the ship and the tooling.
+type command struct {
+	name        string
+	description string
+	run         func(args []string) error
+}
+
+// commands are listed in this order in the usage. It is filled by init, since help refers to it.
+var commands []command
+
+func init() {
+	commands = []command{
+		{"run", "follow the route forever (the default command)", runShip},
+		{"validate-route", "check the route files, without connecting to the game", runValidateRoute},
+		{"status", "show where the ship is, its cargo and flight plan", runStatus},
+		{"plan", "show what the ship would do at one stop, without sending any order", runPlan},
+		{"backtest", "replay the route against recorded market data", runBacktest},
+		{"export", "convert a record file into market data for the backtest", runExport},
+		{"config", "\"config print\" shows the effective configuration, with the secrets redacted", runConfig},
+		{"version", "show the version of the binary", runVersion},
+		{"help", "show this help", runHelp},
+	}
+}
+
+// dispatch runs the command named in the first argument. Without a command (or if it starts with flags), the ship is
+// run, as before the subcommands existed.
+func dispatch(args []string) error {
+	name := "run"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+
+	for _, c := range commands {
+		if c.name == name {
+			return c.run(args)
+		}
+	}
+
+	printUsage(os.Stderr)
+	return fmt.Errorf("unknown command %q", name)
+}
+
+// loadConfig adds the configuration flags to the flags of the command, parses the arguments and loads the
+// configuration, setting up the logging as configured. The configuration is not validated, since each command needs
+// a different part of it.
+func loadConfig(flags *flag.FlagSet, args []string) (config.Config, error) {
+	configFlags := config.RegisterFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return config.Config{}, err
+	}
+	cfg, err := configFlags.Load(os.Getenv)
+	if err != nil {
+		return cfg, err
+	}
+	// An invalid level or format keeps the default logger; the validation reports it.
+	setupLogging(cfg)
+	return cfg, nil
+}
+
+// printUsage lists the commands.
+func printUsage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: spacetraders-ship [command] [flags]\n\nCommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-15s %s\n", c.name, c.description)
+	}
+	fmt.Fprintf(w, "\nRun \"spacetraders-ship <command> -h\" to list the flags of the command.\n")
+}
+
+func runHelp(args []string) error {
+	printUsage(os.Stdout)
+	return nil
+}
+
+func runVersion(args []string) error {
+	fmt.Printf("spacetraders-ship %s (%s %s/%s)\n", telemetry.Version(), runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	return nil
+}
@@ -0,0 +1,57 @@
+package component_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/otaviokr/spacetraders-ship/component"
+	"github.com/otaviokr/spacetraders-ship/gameerror"
+	"github.com/otaviokr/spacetraders-ship/kafka"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TestCassettes replays the interactions recorded in production (see kafka.Recorder) against the ship, through the
+// same rate limit and retries (see kafka.NewResilientProxy), without waiting between attempts.
+func TestCassettes(t *testing.T) {
+	useCases := map[string]map[string]interface{}{
+		"commerce with insufficient credits": {
+			"cassette": "testdata/cassettes/commerce_insufficient_credits.yml",
+			"sell":     map[string]int{"Good0001": -1},
+			"buy":      map[string]int{"Good0002": 60},
+			"expected": gameerror.ErrInsufficientCredits,
+			"outcome":  component.CommercePartial},
+		"commerce after a lost reply": {
+			"cassette": "testdata/cassettes/commerce_after_lost_reply.yml",
+			"sell":     map[string]int{"Good0001": -1},
+			"buy":      map[string]int{},
+			"expected": nil,
+			"outcome":  component.CommerceSuccess}}
+
+	for name, uc := range useCases {
+		replay, err := kafka.ReadCassetteFile(uc["cassette"].(string))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ship, err := component.NewShipCustomProxy(
+			context.TODO(),
+			trace.NewNoopTracerProvider().Tracer(""),
+			kafka.NewResilientProxy(replay, "id0001", kafka.NewRateLimiter(0, 1), kafka.RetryPolicy{MaxAttempts: 3}),
+			"id0001")
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		result, err := ship.DoCommerce(context.TODO(), uc["sell"].(map[string]int), uc["buy"].(map[string]int))
+		if expected, _ := uc["expected"].(error); !errors.Is(err, expected) {
+			t.Fatalf("%s\nACTUAL: %v\nEXPECT: %v\n", name, err, uc["expected"])
+		}
+		if result.Outcome() != uc["outcome"].(string) {
+			t.Fatalf("%s\nACTUAL: %s\nEXPECT: %s\n", name, result.Outcome(), uc["outcome"])
+		}
+		if replay.Remaining() != 0 {
+			t.Fatalf("%s: %d interaction(s) not replayed", name, replay.Remaining())
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package component_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/otaviokr/spacetraders-ship/component"
+	"github.com/otaviokr/spacetraders-ship/gameerror"
+	"github.com/otaviokr/spacetraders-ship/kafka"
+	"github.com/otaviokr/spacetraders-ship/mocks"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TestChaos goes through the ship operations while the proxy injects faults in the responses: they may fail, but must
+// never panic nor hang.
+func TestChaos(t *testing.T) {
+	detailsResponse := "{\"ship\":{\"id\":\"id0001\",\"location\":\"Local0001\",\"cargo\":[{\"good\":\"FUEL\",\"quantity\":5,\"totalVolume\":5},{\"good\":\"Good0001\",\"quantity\":90,\"totalVolume\":90}],\"spaceAvailable\":5,\"maxCargo\":100}}"
+	marketResponse := "{\"marketplace\": [{\"purchasePricePerUnit\": 2,\"sellPricePerUnit\": 1,\"symbol\": \"FUEL\",\"volumePerUnit\": 1},{\"purchasePricePerUnit\": 5,\"sellPricePerUnit\": 4,\"symbol\": \"Good0001\",\"volumePerUnit\": 1}]}"
+	flightPlanResponse := "{\"flightPlan\": {\"departure\": \"Local0001\",\"destination\": \"Local0002\",\"fuelConsumed\": 3,\"id\": \"flightplanid0001\",\"shipId\": \"id0001\",\"timeRemainingInSeconds\": 1}}"
+	orderResponse := "{\"credits\": 100,\"order\": {\"good\": \"Good0001\",\"pricePerUnit\": 4,\"quantity\": 10,\"total\": 40}}"
+
+	useCases := map[string]map[string]interface{}{
+		"delay":        {"config": kafka.ChaosConfig{Delay: time.Millisecond, DelayRate: 1}},
+		"drop":         {"config": kafka.ChaosConfig{DropRate: 0.5}},
+		"malformed":    {"config": kafka.ChaosConfig{MalformedRate: 0.5}},
+		"server error": {"config": kafka.ChaosConfig{ErrorRate: 0.5, ErrorCodes: []int{503, 42901, 3001, 0}}},
+		"reorder":      {"config": kafka.ChaosConfig{ReorderRate: 0.5}},
+		"everything": {"config": kafka.ChaosConfig{
+			Delay: time.Millisecond, DelayRate: 0.2, DropRate: 0.2, MalformedRate: 0.2, ErrorRate: 0.2, ReorderRate: 0.2}}}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	proxy := mocks.NewMockProxy(ctrl)
+	proxy.EXPECT().GetShipInfo(gomock.Any()).Return([]byte(detailsResponse), nil).AnyTimes()
+	proxy.EXPECT().GetMarketplaceProducts(gomock.Any(), gomock.Any()).Return([]byte(marketResponse), nil).AnyTimes()
+	proxy.EXPECT().SetNewFlightPlan(gomock.Any(), gomock.Any()).Return([]byte(flightPlanResponse), nil).AnyTimes()
+	proxy.EXPECT().GetFlightPlan(gomock.Any(), gomock.Any()).Return([]byte(flightPlanResponse), nil).AnyTimes()
+	proxy.EXPECT().BuyGood(gomock.Any(), gomock.Any(), gomock.Any()).Return([]byte(orderResponse), nil).AnyTimes()
+	proxy.EXPECT().SellGood(gomock.Any(), gomock.Any(), gomock.Any()).Return([]byte(orderResponse), nil).AnyTimes()
+
+	for name, uc := range useCases {
+		for seed := int64(1); seed <= 20; seed++ {
+			config := uc["config"].(kafka.ChaosConfig)
+			config.Seed = seed
+			chaos := kafka.NewChaosProxy(proxy, "id0001", config)
+
+			func() {
+				defer func() {
+					if r := recover(); r != nil {
+						t.Fatalf("%s (seed %d): panic: %v", name, seed, r)
+					}
+				}()
+
+				ship, err := component.NewShipCustomProxy(
+					context.TODO(),
+					trace.NewNoopTracerProvider().Tracer(""),
+					chaos,
+					"id0001")
+				if err != nil {
+					// The ship could not even start, which is a graceful failure too.
+					return
+				}
+				component.WithoutSleep(ship)
+
+				operations := map[string]func() error{
+					"Fly": func() error {
+						return ship.Fly(context.TODO(), "Local0002")
+					},
+					"DoCommerce": func() error {
+						_, err := ship.DoCommerce(context.TODO(), map[string]int{"Good0001": -1}, map[string]int{"FUEL": 20, "Good0001": 50})
+						return err
+					},
+					"ForceBuyFuel": func() error {
+						return ship.ForceBuyFuel(context.TODO(), 30)
+					}}
+				for operation, f := range operations {
+					if err := f(); err != nil {
+						t.Logf("%s (seed %d): %s failed gracefully: %v", name, seed, operation, err)
+					}
+				}
+			}()
+		}
+	}
+}
+
+// switchingProxy sends the requests to a proxy that can be replaced while the ship is using it.
+type switchingProxy struct {
+	kafka.Proxy
+}
+
+// TestChaosFaults injects each fault in every response, through the same rate limit and retries as the ship, and
+// checks what the ship gets: the error it can act upon, after retrying if worth it, and never partial details.
+func TestChaosFaults(t *testing.T) {
+	detailsResponse := "{\"ship\":{\"id\":\"id0001\",\"location\":\"Local0001\",\"cargo\":[{\"good\":\"FUEL\",\"quantity\":5,\"totalVolume\":5}],\"spaceAvailable\":95,\"maxCargo\":100}}"
+
+	useCases := map[string]map[string]interface{}{
+		"drop": {
+			"config":   kafka.ChaosConfig{DropRate: 1},
+			"expected": kafka.ErrNoReply,
+			"attempts": 3,
+		},
+		"unavailable": {
+			"config":   kafka.ChaosConfig{ErrorRate: 1, ErrorCodes: []int{gameerror.CodeServiceUnavailable}},
+			"expected": gameerror.ErrUnavailable,
+			"attempts": 3,
+		},
+		"rate limited": {
+			"config":   kafka.ChaosConfig{ErrorRate: 1, ErrorCodes: []int{gameerror.CodeRateLimited}},
+			"expected": gameerror.ErrRateLimited,
+			"attempts": 3 * (1 + kafka.MaxRateLimitRequeues),
+		},
+		"insufficient fuel": {
+			"config":   kafka.ChaosConfig{ErrorRate: 1, ErrorCodes: []int{gameerror.CodeInsufficientFuel}},
+			"expected": gameerror.ErrInsufficientFuel,
+			"attempts": 1,
+		},
+		"malformed": {
+			"config":   kafka.ChaosConfig{MalformedRate: 1},
+			"attempts": 1,
+		},
+	}
+
+	for name, uc := range useCases {
+		t.Run(name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			proxy := mocks.NewMockProxy(ctrl)
+			proxy.EXPECT().GetShipInfo(gomock.Any()).Return([]byte(detailsResponse), nil).
+				Times(1 + uc["attempts"].(int))
+
+			switching := &switchingProxy{Proxy: proxy}
+			ship, err := component.NewShipCustomProxy(
+				context.TODO(),
+				trace.NewNoopTracerProvider().Tracer(""),
+				kafka.NewResilientProxy(switching, "id0001", kafka.NewRateLimiter(0, 1), kafka.RetryPolicy{MaxAttempts: 3}),
+				"id0001")
+			if err != nil {
+				t.Fatal(err)
+			}
+			before := ship.Details
+
+			switching.Proxy = kafka.NewChaosProxy(proxy, "id0001", uc["config"].(kafka.ChaosConfig))
+			err = ship.GetDetails(context.TODO())
+			if expected, ok := uc["expected"].(error); err == nil || (ok && !errors.Is(err, expected)) {
+				t.Fatalf("\nACTUAL: %v\nEXPECT: %v\n", err, uc["expected"])
+			}
+			if !reflect.DeepEqual(ship.Details, before) {
+				t.Fatalf("\nACTUAL: %+v\nEXPECT: %+v\n", ship.Details, before)
+			}
+		})
+	}
+}
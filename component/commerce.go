@@ -0,0 +1,144 @@
+package component
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// CommerceSuccess means every order placed at the stop was executed.
+	CommerceSuccess = "success"
+	// CommercePartial means some orders were executed, but others failed.
+	CommercePartial = "partial"
+	// CommerceFailed means no order could be executed.
+	CommerceFailed = "failed"
+	// CommerceIdle means there was nothing to trade at the stop.
+	CommerceIdle = "idle"
+)
+
+// CommerceResult summarizes what was planned and what was actually traded at a stop. MarketplaceErr is set when the
+// marketplace could not be read, so nothing could even be planned.
+type CommerceResult struct {
+	Location       string
+	Orders         []OrderResult
+	Skipped        []SkippedGood
+	CreditsDelta   int
+	MarketplaceErr error
+}
+
+// OrderResult is the outcome of a single buy or sell order.
+type OrderResult struct {
+	Action   string
+	Good     string
+	Planned  int
+	Executed int
+	Total    int
+	Err      error
+}
+
+// SkippedGood is a good in the route that was not traded, and why.
+type SkippedGood struct {
+	Good   string
+	Reason string
+}
+
+// CommerceError aggregates the orders that failed at a stop.
+type CommerceError struct {
+	Location string
+	Failures []OrderResult
+}
+
+// Error lists each failed order.
+func (e *CommerceError) Error() string {
+	failures := make([]string, 0, len(e.Failures))
+	for _, f := range e.Failures {
+		failures = append(failures, fmt.Sprintf("%s %d %s: %v", f.Action, f.Planned, f.Good, f.Err))
+	}
+	return fmt.Sprintf("%d order(s) failed at %s: %s", len(e.Failures), e.Location, strings.Join(failures, "; "))
+}
+
+// Is reports whether any of the failed orders matches the target, so errors.Is works with the gameerror classes.
+func (e *CommerceError) Is(target error) bool {
+	for _, f := range e.Failures {
+		if errors.Is(f.Err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// record adds the outcome of an order to the result.
+func (r *CommerceResult) record(action, good string, planned int, trade *Trade, err error) {
+	order := OrderResult{
+		Action:  action,
+		Good:    good,
+		Planned: planned,
+		Err:     err,
+	}
+
+	if err == nil && trade != nil {
+		order.Executed = trade.Order.Quantity
+		order.Total = trade.Order.Total
+		switch action {
+		case "sell":
+			r.CreditsDelta += trade.Order.Total
+		case "buy":
+			r.CreditsDelta -= trade.Order.Total
+		}
+	}
+	r.Orders = append(r.Orders, order)
+}
+
+// skip adds a good that was not traded to the result.
+func (r *CommerceResult) skip(good, reason string) {
+	r.Skipped = append(r.Skipped, SkippedGood{Good: good, Reason: reason})
+}
+
+// merge appends the orders and skipped goods from another result.
+func (r *CommerceResult) merge(other *CommerceResult) {
+	if other == nil {
+		return
+	}
+	r.Orders = append(r.Orders, other.Orders...)
+	r.Skipped = append(r.Skipped, other.Skipped...)
+	r.CreditsDelta += other.CreditsDelta
+}
+
+// Failures returns the orders that could not be executed.
+func (r *CommerceResult) Failures() []OrderResult {
+	failures := []OrderResult{}
+	for _, o := range r.Orders {
+		if o.Err != nil {
+			failures = append(failures, o)
+		}
+	}
+	return failures
+}
+
+// Outcome classifies the result as one of CommerceSuccess, CommercePartial, CommerceFailed or CommerceIdle. A stop whose
+// marketplace could not be read failed, rather than had nothing to trade.
+func (r *CommerceResult) Outcome() string {
+	failures := len(r.Failures())
+	switch {
+	case r.MarketplaceErr != nil:
+		return CommerceFailed
+	case len(r.Orders) < 1:
+		return CommerceIdle
+	case failures < 1:
+		return CommerceSuccess
+	case failures < len(r.Orders):
+		return CommercePartial
+	default:
+		return CommerceFailed
+	}
+}
+
+// Err returns a CommerceError with the failed orders, or nil if all orders succeeded.
+func (r *CommerceResult) Err() error {
+	failures := r.Failures()
+	if len(failures) < 1 {
+		return nil
+	}
+	return &CommerceError{Location: r.Location, Failures: failures}
+}
@@ -0,0 +1,102 @@
+package component
+
+import (
+	"fmt"
+	"strings"
+)
+
+// StopCondition tells when a stop of the route is worth visiting. It is evaluated before flying to the stop, and all
+// the conditions set must hold; the ones not set are ignored.
+type StopCondition struct {
+	// CargoContains lists the goods that must all be in the cargo, e.g., to visit a stop only to sell them.
+	CargoContains []string `yaml:"cargoContains,omitempty"`
+	// FuelBelow visits the stop only if there is less fuel than this in the cargo, e.g., to refuel.
+	FuelBelow int `yaml:"fuelBelow,omitempty"`
+	// PriceAbove visits the stop only if the last known sell price of each good at the station is above the value. If
+	// the price is not known yet, the stop is visited, so it becomes known.
+	PriceAbove map[string]int `yaml:"priceAbove,omitempty"`
+	// Every visits the stop once every this many cycles, starting on the first one (2 is every other cycle).
+	Every int `yaml:"every,omitempty"`
+}
+
+// KnownPrice returns the last known product (with its prices) of the good at the station, if there is any.
+type KnownPrice func(station, good string) (Product, bool)
+
+// ShouldVisit evaluates the conditions of the stop, if any, in the cycle of the route (starting at 1). If the stop
+// must be skipped, the reason is returned.
+func (stop RouteStop) ShouldVisit(cycle int, details ShipDetails, prices KnownPrice) (bool, string) {
+	if stop.When == nil {
+		return true, ""
+	}
+	return stop.When.evaluate(stop.Station, cycle, details, prices)
+}
+
+func (c *StopCondition) evaluate(station string, cycle int, details ShipDetails, prices KnownPrice) (bool, string) {
+	if c.Every > 1 && (cycle-1)%c.Every != 0 {
+		return false, fmt.Sprintf("only visited every %d cycles", c.Every)
+	}
+
+	for _, good := range c.CargoContains {
+		if cargoQuantity(details, good) < 1 {
+			return false, fmt.Sprintf("no %s in cargo", good)
+		}
+	}
+
+	if c.FuelBelow > 0 {
+		if fuel := cargoQuantity(details, "FUEL"); fuel >= c.FuelBelow {
+			return false, fmt.Sprintf("fuel is %d, not below %d", fuel, c.FuelBelow)
+		}
+	}
+
+	for _, good := range sortedGoods(c.PriceAbove) {
+		if prices == nil {
+			continue
+		}
+		product, ok := prices(station, good)
+		if !ok {
+			continue
+		}
+		if product.SellPricePerUnit <= c.PriceAbove[good] {
+			return false, fmt.Sprintf("last known price of %s is %d, not above %d",
+				good, product.SellPricePerUnit, c.PriceAbove[good])
+		}
+	}
+
+	return true, ""
+}
+
+// validate lists the problems of the conditions, prefixed by where they are in the route.
+func (c *StopCondition) validate(where string) []string {
+	var problems []string
+	if c.Every < 0 {
+		problems = append(problems, fmt.Sprintf("%s: when.every must not be negative, got %d", where, c.Every))
+	}
+	if c.FuelBelow < 0 {
+		problems = append(problems, fmt.Sprintf("%s: when.fuelBelow must not be negative, got %d", where, c.FuelBelow))
+	}
+	for _, good := range c.CargoContains {
+		if len(strings.TrimSpace(good)) < 1 {
+			problems = append(problems, fmt.Sprintf("%s: when.cargoContains has a good without name", where))
+		}
+	}
+	for _, good := range sortedGoods(c.PriceAbove) {
+		if len(strings.TrimSpace(good)) < 1 {
+			problems = append(problems, fmt.Sprintf("%s: when.priceAbove has a good without name", where))
+		} else if c.PriceAbove[good] < 0 {
+			problems = append(problems, fmt.Sprintf("%s: when.priceAbove %s must not be negative, got %d",
+				where, good, c.PriceAbove[good]))
+		}
+	}
+	return problems
+}
+
+// cargoQuantity returns how many units of the good are in the cargo.
+func cargoQuantity(details ShipDetails, good string) int {
+	quantity := 0
+	for _, cargo := range details.Cargo {
+		if cargo.Good == good {
+			quantity += cargo.Quantity
+		}
+	}
+	return quantity
+}
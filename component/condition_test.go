@@ -0,0 +1,94 @@
+package component_test
+
+import (
+	"testing"
+
+	"github.com/otaviokr/spacetraders-ship/component"
+)
+
+func TestShouldVisit(t *testing.T) {
+	details := component.ShipDetails{
+		Location: "OE-PM",
+		Cargo: []component.ShipCargo{
+			{Good: "FUEL", Quantity: 10, TotalVolume: 10},
+			{Good: "METALS", Quantity: 5, TotalVolume: 5}}}
+	prices := func(station, good string) (component.Product, bool) {
+		if station == "OE-CR" && good == "METALS" {
+			return component.Product{Symbol: good, SellPricePerUnit: 150}, true
+		}
+		return component.Product{}, false
+	}
+
+	useCases := map[string]map[string]interface{}{
+		"no conditions": {
+			"when":   (*component.StopCondition)(nil),
+			"cycle":  1,
+			"visit":  true,
+			"reason": "",
+		},
+		"cargo contains": {
+			"when":   &component.StopCondition{CargoContains: []string{"METALS"}},
+			"cycle":  1,
+			"visit":  true,
+			"reason": "",
+		},
+		"cargo does not contain": {
+			"when":   &component.StopCondition{CargoContains: []string{"METALS", "DRONES"}},
+			"cycle":  1,
+			"visit":  false,
+			"reason": "no DRONES in cargo",
+		},
+		"fuel below": {
+			"when":   &component.StopCondition{FuelBelow: 11},
+			"cycle":  1,
+			"visit":  true,
+			"reason": "",
+		},
+		"fuel not below": {
+			"when":   &component.StopCondition{FuelBelow: 10},
+			"cycle":  1,
+			"visit":  false,
+			"reason": "fuel is 10, not below 10",
+		},
+		"price above": {
+			"when":   &component.StopCondition{PriceAbove: map[string]int{"METALS": 149}},
+			"cycle":  1,
+			"visit":  true,
+			"reason": "",
+		},
+		"price not above": {
+			"when":   &component.StopCondition{PriceAbove: map[string]int{"METALS": 150}},
+			"cycle":  1,
+			"visit":  false,
+			"reason": "last known price of METALS is 150, not above 150",
+		},
+		"price unknown": {
+			"when":   &component.StopCondition{PriceAbove: map[string]int{"DRONES": 1000}},
+			"cycle":  1,
+			"visit":  true,
+			"reason": "",
+		},
+		"every other cycle, first": {
+			"when":   &component.StopCondition{Every: 2},
+			"cycle":  3,
+			"visit":  true,
+			"reason": "",
+		},
+		"every other cycle, skipped": {
+			"when":   &component.StopCondition{Every: 2},
+			"cycle":  4,
+			"visit":  false,
+			"reason": "only visited every 2 cycles",
+		},
+	}
+
+	for name, uc := range useCases {
+		t.Run(name, func(t *testing.T) {
+			stop := component.RouteStop{Station: "OE-CR", When: uc["when"].(*component.StopCondition)}
+			visit, reason := stop.ShouldVisit(uc["cycle"].(int), details, prices)
+			if visit != uc["visit"].(bool) || reason != uc["reason"].(string) {
+				t.Fatalf("\nACTUAL: %t %q\nEXPECT: %t %q\n", visit, reason, uc["visit"], uc["reason"])
+			}
+		})
+	}
+}
@@ -0,0 +1,276 @@
+package component
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/otaviokr/spacetraders-ship/kafka"
+	"go.opentelemetry.io/otel/trace"
+	"gopkg.in/yaml.v3"
+)
+
+// DryRun is a kafka.Proxy that sends the read requests (ship details, marketplace and flight plans) to the game, but
+// only records the buy, sell and flight plan orders. The ship details are patched with the location and cargo the ship
+// would have, so the rest of the ship logic works as if the orders were real.
+//
+// Fuel consumption and credits are not simulated.
+type DryRun struct {
+	proxy kafka.Proxy
+
+	mu       sync.Mutex
+	details  *ShipDetails
+	products map[string]Product
+	stops    []*DryRunStop
+}
+
+// DryRunStop is what the ship would do at one of the stops of the route.
+type DryRunStop struct {
+	Station       string
+	FlightFrom    string
+	Orders        []Order
+	Cost          int
+	Revenue       int
+	CargoUsed     int
+	CargoCapacity int
+}
+
+// NewDryRun creates a new instance of DryRun, sending the read requests to the proxy.
+func NewDryRun(proxy kafka.Proxy) *DryRun {
+	return &DryRun{
+		proxy:    proxy,
+		products: map[string]Product{},
+	}
+}
+
+// NewShipDryRun creates a new instance of component.Ship that does not send any order to the game.
+func NewShipDryRun(ctx context.Context, tracer trace.Tracer, proxy kafka.Proxy, id string) (*Ship, *DryRun, error) {
+	dryRun := NewDryRun(proxy)
+	ship, err := NewShipCustomProxy(ctx, tracer, dryRun, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	ship.dryRun = true
+	return ship, dryRun, nil
+}
+
+// BeginStop starts recording the orders for a new stop of the route.
+func (d *DryRun) BeginStop(station string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.stops = append(d.stops, &DryRunStop{Station: station})
+	d.updateCargo()
+}
+
+// Stops returns what was recorded for each stop so far.
+func (d *DryRun) Stops() []DryRunStop {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	stops := make([]DryRunStop, 0, len(d.stops))
+	for _, stop := range d.stops {
+		stops = append(stops, *stop)
+	}
+	return stops
+}
+
+// Print writes the report of the recorded stops.
+func (d *DryRun) Print(w io.Writer) {
+	totalCost := 0
+	totalRevenue := 0
+	for i, stop := range d.Stops() {
+		fmt.Fprintf(w, "Stop %d: %s\n", i+1, stop.Station)
+		if len(stop.FlightFrom) > 0 {
+			fmt.Fprintf(w, "  fly from %s\n", stop.FlightFrom)
+		}
+		for _, order := range stop.Orders {
+			fmt.Fprintf(w, "  %-4s %6d %s\n", order.Action, order.Quantity, order.Good)
+		}
+		fmt.Fprintf(w, "  estimated cost: %d / estimated revenue: %d / cargo: %d of %d\n",
+			stop.Cost, stop.Revenue, stop.CargoUsed, stop.CargoCapacity)
+		totalCost += stop.Cost
+		totalRevenue += stop.Revenue
+	}
+	fmt.Fprintf(w, "Total: estimated cost %d / estimated revenue %d / estimated profit %d\n",
+		totalCost, totalRevenue, totalRevenue-totalCost)
+}
+
+// GetShipInfo gets the real ship details, replacing the location and cargo with the simulated ones.
+func (d *DryRun) GetShipInfo(ctx context.Context) ([]byte, error) {
+	data, err := d.proxy.GetShipInfo(ctx)
+	if err != nil {
+		return data, err
+	}
+
+	var ship Ship
+	if err = yaml.NewDecoder(bytes.NewReader(data)).Decode(&ship); err != nil || len(ship.Error.Message) > 0 {
+		// Let the ship deal with it.
+		return data, nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.details == nil {
+		details := ship.Details
+		d.details = &details
+		return data, nil
+	}
+
+	ship.Details.Location = d.details.Location
+	ship.Details.FlightPlanId = ""
+	ship.Details.Cargo = d.details.Cargo
+	ship.Details.SpaceAvailable = d.details.SpaceAvailable
+	return d.marshal("ship", ship.Details)
+}
+
+// GetMarketplaceProducts gets the real marketplace, keeping the prices to estimate the orders.
+func (d *DryRun) GetMarketplaceProducts(ctx context.Context, location string) ([]byte, error) {
+	data, err := d.proxy.GetMarketplaceProducts(ctx, location)
+	if err != nil {
+		return data, err
+	}
+
+	var m Marketplace
+	if err = yaml.NewDecoder(bytes.NewReader(data)).Decode(&m); err == nil {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+
+		d.products = map[string]Product{}
+		for _, product := range m.Products {
+			d.products[product.Symbol] = product
+		}
+	}
+	return data, nil
+}
+
+// SetNewFlightPlan records the flight and moves the simulated ship to the destination immediately.
+func (d *DryRun) SetNewFlightPlan(ctx context.Context, destination string) ([]byte, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.details == nil {
+		return nil, fmt.Errorf("dry run: ship details unknown")
+	}
+
+	stop := d.currentStop()
+	stop.FlightFrom = d.details.Location
+	departure := d.details.Location
+	d.details.Location = destination
+
+	return d.marshal("flightPlan", FlightPlanDetails{
+		Departure:   departure,
+		Destination: destination,
+		Id:          "dry-run",
+		ShipId:      d.details.Id,
+	})
+}
+
+// GetFlightPlan gets the real flight plan.
+func (d *DryRun) GetFlightPlan(ctx context.Context, planId string) ([]byte, error) {
+	return d.proxy.GetFlightPlan(ctx, planId)
+}
+
+// BuyGood records the purchase, estimating its cost with the last marketplace prices.
+func (d *DryRun) BuyGood(ctx context.Context, good string, quantity int) ([]byte, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	product := d.products[good]
+	if d.details != nil && quantity*product.VolumePerUnit > d.details.SpaceAvailable {
+		return d.marshal("error", Error{Message: "Ship has insufficient cargo space for purchase.", Code: 0})
+	}
+
+	order := TradeOrder{
+		Good:         good,
+		PricePerUnit: product.PurchasePricePerUnit,
+		Quantity:     quantity,
+		Total:        quantity * product.PurchasePricePerUnit,
+	}
+
+	stop := d.currentStop()
+	stop.Orders = append(stop.Orders, Order{Action: "buy", Good: good, Quantity: quantity})
+	stop.Cost += order.Total
+	d.moveCargo(good, quantity, product.VolumePerUnit)
+
+	return d.marshal("order", order)
+}
+
+// SellGood records the sale, estimating its revenue with the last marketplace prices.
+func (d *DryRun) SellGood(ctx context.Context, good string, quantity int) ([]byte, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	product := d.products[good]
+	order := TradeOrder{
+		Good:         good,
+		PricePerUnit: product.SellPricePerUnit,
+		Quantity:     quantity,
+		Total:        quantity * product.SellPricePerUnit,
+	}
+
+	stop := d.currentStop()
+	stop.Orders = append(stop.Orders, Order{Action: "sell", Good: good, Quantity: quantity})
+	stop.Revenue += order.Total
+	d.moveCargo(good, -quantity, product.VolumePerUnit)
+
+	return d.marshal("order", order)
+}
+
+// currentStop returns the stop being recorded, starting one if BeginStop was never called.
+func (d *DryRun) currentStop() *DryRunStop {
+	if len(d.stops) < 1 {
+		station := ""
+		if d.details != nil {
+			station = d.details.Location
+		}
+		d.stops = append(d.stops, &DryRunStop{Station: station})
+	}
+	return d.stops[len(d.stops)-1]
+}
+
+// moveCargo adds (or removes, if quantity is negative) the good to the simulated cargo.
+func (d *DryRun) moveCargo(good string, quantity, volumePerUnit int) {
+	if d.details == nil {
+		return
+	}
+
+	found := false
+	cargo := []ShipCargo{}
+	for _, c := range d.details.Cargo {
+		if c.Good == good {
+			found = true
+			c.Quantity += quantity
+			c.TotalVolume += quantity * volumePerUnit
+		}
+		if c.Quantity > 0 {
+			cargo = append(cargo, c)
+		}
+	}
+	if !found && quantity > 0 {
+		cargo = append(cargo, ShipCargo{Good: good, Quantity: quantity, TotalVolume: quantity * volumePerUnit})
+	}
+
+	d.details.Cargo = cargo
+	d.details.SpaceAvailable -= quantity * volumePerUnit
+	d.updateCargo()
+}
+
+// updateCargo keeps the cargo usage of the current stop up to date.
+func (d *DryRun) updateCargo() {
+	if d.details == nil || len(d.stops) < 1 {
+		return
+	}
+
+	stop := d.stops[len(d.stops)-1]
+	stop.CargoCapacity = d.details.MaxCargo
+	stop.CargoUsed = d.details.MaxCargo - d.details.SpaceAvailable
+}
+
+// marshal encodes the value as the game would reply, under the given key.
+func (d *DryRun) marshal(key string, value interface{}) ([]byte, error) {
+	return yaml.Marshal(map[string]interface{}{key: value})
+}
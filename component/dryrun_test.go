@@ -0,0 +1,82 @@
+package component_test
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/otaviokr/spacetraders-ship/component"
+	"github.com/otaviokr/spacetraders-ship/mocks"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestDryRun(t *testing.T) {
+	detailsResponse := "{\"ship\":{\"id\":\"id0001\",\"location\":\"Local0001\",\"cargo\":[{\"good\":\"Good0001\",\"quantity\":5,\"totalVolume\":5}],\"spaceAvailable\":95,\"maxCargo\":100}}"
+	market1Response := "{\"marketplace\": [{\"purchasePricePerUnit\": 5,\"sellPricePerUnit\": 4,\"symbol\": \"Good0001\",\"volumePerUnit\": 1},{\"purchasePricePerUnit\": 3,\"sellPricePerUnit\": 2,\"symbol\": \"Good0002\",\"volumePerUnit\": 1}]}"
+	market2Response := "{\"marketplace\": [{\"purchasePricePerUnit\": 9,\"sellPricePerUnit\": 8,\"symbol\": \"Good0002\",\"volumePerUnit\": 1}]}"
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// Only read requests are expected: any order sent to the game fails the test.
+	proxy := mocks.NewMockProxy(ctrl)
+	proxy.EXPECT().GetShipInfo(gomock.Any()).Return([]byte(detailsResponse), nil).AnyTimes()
+	proxy.EXPECT().GetMarketplaceProducts(gomock.Any(), "Local0001").Return([]byte(market1Response), nil).AnyTimes()
+	proxy.EXPECT().GetMarketplaceProducts(gomock.Any(), "Local0002").Return([]byte(market2Response), nil).AnyTimes()
+
+	ship, dryRun, err := component.NewShipDryRun(
+		context.TODO(),
+		trace.NewNoopTracerProvider().Tracer(""),
+		proxy,
+		"id0001")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dryRun.BeginStop("Local0001")
+	if _, err = ship.DoCommerce(context.TODO(), map[string]int{"Good0001": -1}, map[string]int{"Good0002": 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	dryRun.BeginStop("Local0002")
+	if err = ship.Fly(context.TODO(), "Local0002"); err != nil {
+		t.Fatal(err)
+	}
+	if ship.Details.Location != "Local0002" {
+		t.Fatalf("\nACTUAL: %s\nEXPECT: %s\n", ship.Details.Location, "Local0002")
+	}
+	if _, err = ship.DoCommerce(context.TODO(), map[string]int{"Good0002": -1}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []component.DryRunStop{
+		{
+			Station: "Local0001",
+			Orders: []component.Order{
+				{Action: "sell", Good: "Good0001", Quantity: 5},
+				{Action: "buy", Good: "Good0002", Quantity: 10}},
+			Cost:          30,
+			Revenue:       20,
+			CargoUsed:     10,
+			CargoCapacity: 100},
+		{
+			Station:       "Local0002",
+			FlightFrom:    "Local0001",
+			Orders:        []component.Order{{Action: "sell", Good: "Good0002", Quantity: 10}},
+			Revenue:       80,
+			CargoUsed:     0,
+			CargoCapacity: 100}}
+
+	if actual := dryRun.Stops(); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("\nACTUAL: %+v\nEXPECT: %+v\n", actual, expected)
+	}
+
+	var report bytes.Buffer
+	dryRun.Print(&report)
+	if !strings.Contains(report.String(), "estimated profit 70") {
+		t.Fatalf("unexpected report:\n%s", report.String())
+	}
+}
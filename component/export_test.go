@@ -0,0 +1,9 @@
+package component
+
+import "time"
+
+// WithoutSleep makes the ship skip the wait for the flights to finish, so the tests don't take as long as the flights.
+func WithoutSleep(s *Ship) *Ship {
+	s.sleep = func(time.Duration) {}
+	return s
+}
@@ -1,12 +1,18 @@
 package component
 
-const (
-	InsufficientFuelRegex = "Ship has insufficient fuel for flight plan. You require ([0-9]+) more FUEL"
-)
+import "github.com/otaviokr/spacetraders-ship/gameerror"
 
 type Error struct {
 	Message string `json:"message"`
 	Code    int    `json:"code"`
 }
 
+// Err converts the error reported by the server into a gameerror.ServerError, or nil if there is no error.
+func (e Error) Err() error {
+	if len(e.Message) < 1 {
+		return nil
+	}
+	return gameerror.New(e.Code, e.Message)
+}
+
 // {"error":{"message":"Ship has insufficient fuel for flight plan. You require 13 more FUEL","code":3001}}
@@ -4,9 +4,12 @@ import (
 	"bytes"
 	"context"
 	"fmt"
-	"log"
+	"sort"
 	"strings"
+	"time"
 
+	"github.com/otaviokr/spacetraders-ship/gameerror"
+	"github.com/otaviokr/spacetraders-ship/logging"
 	"github.com/otaviokr/spacetraders-ship/web"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
@@ -29,7 +32,7 @@ func (s *Ship) GetMarketplaceProducts(ctx context.Context) (*Marketplace, *map[s
 		span.RecordError(err)
 	}
 
-	data, err := s.webProxy.GetMarketplaceProducts(s.Details.Location)
+	data, err := s.webProxy.GetMarketplaceProducts(newCtx, s.Details.Location)
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
@@ -44,9 +47,8 @@ func (s *Ship) GetMarketplaceProducts(ctx context.Context) (*Marketplace, *map[s
 		return nil, nil, err
 	}
 
-	if len(m.Error.Message) > 0 {
+	if err = m.Error.Err(); err != nil {
 		// Error from the server, we should still report it.
-		err = fmt.Errorf("ERROR FROM SERVER (%d): %s", s.Error.Code, s.Error.Message)
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
 		return nil, nil, err
@@ -56,62 +58,67 @@ func (s *Ship) GetMarketplaceProducts(ctx context.Context) (*Marketplace, *map[s
 	for _, product := range m.Products {
 		p[product.Symbol] = product
 	}
+	s.observed.observeMarket(s.Details.Location, p, time.Now())
 
 	return &m, &p, nil
 }
 
 // DoCommerce places the buy and sell orders to the game.
-func (s *Ship) DoCommerce(ctx context.Context, sell, buy map[string]int) error {
+//
+// The orders are planned by PlanCommerce (so the sell and buy lists are not changed) and then executed. The result is
+// never nil, so the caller can see what was traded even if something failed. If any order failed, the error is a
+// CommerceError listing them.
+func (s *Ship) DoCommerce(ctx context.Context, sell, buy map[string]int) (*CommerceResult, error) {
 	newCtx, span := s.tracer.Start(ctx, "Commerce")
 	defer span.End()
 
 	_, products, err := s.GetMarketplaceProducts(newCtx)
 	if err != nil {
+		// Without the marketplace we have no idea what can be traded here.
+		result := &CommerceResult{Location: s.Details.Location, MarketplaceErr: err}
 		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		s.reportCommerce(span, result)
+		return result, err
 	}
 
-	for _, good := range s.Details.Cargo {
-		if _, ok := (*products)[good.Good]; ok {
-			if sell[good.Good] == -1 {
-				log.Printf("Selling the whole lot of %s: %d", good.Good, good.Quantity)
-				sell[good.Good] = good.Quantity
-			} else {
-				log.Printf("Selling pre-defined lot of %s: %d", good.Good, sell[good.Good])
-			}
-		}
+	plan := PlanCommerce(s.Details, *products, RouteStop{Station: s.Details.Location, Sell: sell, Buy: buy})
+	for _, order := range plan.Orders {
+		logging.Debug(newCtx, "Order planned", "action", order.Action, "good", order.Good, "quantity", order.Quantity)
 	}
 
-	err = s.SellAll(newCtx, sell, *products)
+	result, err := s.ExecuteOrders(newCtx, plan)
+	s.reportCommerce(span, result)
 	if err != nil {
 		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
 	}
 
-	err = s.GetDetails(newCtx)
-	if err != nil {
-		span.RecordError(err)
+	// Leave the ship details up to date with the trades.
+	if detailsErr := s.GetDetails(newCtx); detailsErr != nil {
+		span.RecordError(detailsErr)
 	}
 
-	for _, good := range s.Details.Cargo {
-		if _, ok := (*products)[good.Good]; ok {
-			if _, ok := buy[good.Good]; ok {
-				log.Printf(
-					"Buying necessary to complete lot of %s: %d (total %d)",
-					good.Good, buy[good.Good]-good.Quantity, buy[good.Good])
-				buy[good.Good] -= good.Quantity
-			}
-		}
-	}
+	return result, err
+}
 
-	err = s.BuyAll(newCtx, buy, *products)
-	if err != nil {
-		span.RecordError(err)
+// reportCommerce adds the summary of the commerce to the span and to the metrics.
+func (s *Ship) reportCommerce(span trace.Span, result *CommerceResult) {
+	span.SetAttributes(
+		attribute.Key("commerce.outcome").String(result.Outcome()),
+		attribute.Key("commerce.orders").Int(len(result.Orders)),
+		attribute.Key("commerce.failures").Int(len(result.Failures())),
+		attribute.Key("commerce.skipped").Int(len(result.Skipped)),
+		attribute.Key("commerce.credits").Int(result.CreditsDelta))
+	if !s.dryRun {
+		web.CommerceStops.
+			WithLabelValues(s.Details.Id, result.Location, result.Outcome()).
+			Inc()
 	}
-
-	return nil
 }
 
 // SellAll is wrapper to sell all units of products in the provided list.
-func (s *Ship) SellAll(ctx context.Context, sell map[string]int, marketplace map[string]Product) error {
+func (s *Ship) SellAll(ctx context.Context, sell map[string]int, marketplace map[string]Product) (*CommerceResult, error) {
 	sellCtx, sellSpan := s.tracer.Start(
 		ctx,
 		"Sell goods",
@@ -119,28 +126,12 @@ func (s *Ship) SellAll(ctx context.Context, sell map[string]int, marketplace map
 			attribute.Key("Goods to sell").Int(len(sell))))
 	defer sellSpan.End()
 
-	for good, quantity := range sell {
-		if quantity > 0 {
-			if _, ok := marketplace[good]; ok {
-				log.Printf("Selling lot of %s: %d\n", good, quantity)
-
-				_, err := s.Sell(sellCtx, good, quantity)
-				if err != nil {
-					sellSpan.RecordError(err)
-				}
-			} else {
-				sellSpan.AddEvent(
-					"Cannot sell product",
-					trace.WithAttributes(
-						attribute.Key("product").String(good)))
-			}
-		}
-	}
-	return nil
+	plan := PlanCommerce(s.Details, marketplace, RouteStop{Station: s.Details.Location, Sell: sell})
+	return s.ExecuteOrders(sellCtx, plan)
 }
 
-// BuyAll is wrapper to buy the products in the provided list.
-func (s *Ship) BuyAll(ctx context.Context, buy map[string]int, marketplace map[string]Product) error {
+// BuyAll is wrapper to buy the products in the provided list, completing the lots with what is already in the cargo.
+func (s *Ship) BuyAll(ctx context.Context, buy map[string]int, marketplace map[string]Product) (*CommerceResult, error) {
 	buyCtx, buySpan := s.tracer.Start(
 		ctx,
 		"Buy goods",
@@ -148,38 +139,8 @@ func (s *Ship) BuyAll(ctx context.Context, buy map[string]int, marketplace map[s
 			attribute.Key("Goods to buy").Int(len(buy))))
 	defer buySpan.End()
 
-	for good, quantity := range buy {
-		if _, ok := marketplace[good]; ok {
-			if good == "FUEL" {
-				log.Printf("Priority purchase of %s: %d\n", good, quantity)
-				err := s.ForceBuyFuel(ctx, quantity)
-				if err != nil {
-					buySpan.RecordError(err)
-				}
-			} else if quantity > 0 {
-				log.Printf("Buying lot of %s: %d\n", good, quantity)
-				actualQuantity := quantity
-				if s.Details.SpaceAvailable < quantity*marketplace[good].VolumePerUnit {
-					actualQuantity = int(s.Details.SpaceAvailable / marketplace[good].VolumePerUnit)
-					log.Printf("Low cargo space! Available: %d / Wanted: %d (Volume Per Unit: %d)\n", s.Details.SpaceAvailable, actualQuantity, marketplace[good].VolumePerUnit)
-				} else {
-					for _, product := range s.Details.Cargo {
-						if product.Good == good {
-							actualQuantity = quantity - product.Quantity
-							log.Printf("Completing lot of %s: Original(%d) / Additional(%d)\n", good, product.Quantity, actualQuantity)
-						}
-					}
-				}
-
-				// FIXME
-				_, err := s.Buy(buyCtx, good, actualQuantity)
-				if err != nil {
-					buySpan.RecordError(err)
-				}
-			}
-		}
-	}
-	return nil
+	plan := PlanCommerce(s.Details, marketplace, RouteStop{Station: s.Details.Location, Buy: buy})
+	return s.ExecuteOrders(buyCtx, plan)
 }
 
 // Sell sends a sell order to the game.
@@ -194,6 +155,11 @@ func (s *Ship) Buy(ctx context.Context, good string, quantity int) (*Trade, erro
 
 // ForceBuyFuel will prioritize the purchase of fuel, selling goods if necessary.
 func (s *Ship) ForceBuyFuel(ctx context.Context, fuel int) error {
+	return s.forceBuyFuel(ctx, fuel, &CommerceResult{Location: s.Details.Location})
+}
+
+// forceBuyFuel is the implementation of ForceBuyFuel, recording the trades in the result.
+func (s *Ship) forceBuyFuel(ctx context.Context, fuel int, result *CommerceResult) error {
 	newCtx, span := s.tracer.Start(
 		ctx,
 		"Buy emergency fuel",
@@ -202,7 +168,9 @@ func (s *Ship) ForceBuyFuel(ctx context.Context, fuel int) error {
 	defer span.End()
 
 	if s.Details.SpaceAvailable > fuel {
-		if _, err := s.Buy(newCtx, "FUEL", fuel); err != nil {
+		trade, err := s.Buy(newCtx, "FUEL", fuel)
+		result.record("buy", "FUEL", fuel, trade, err)
+		if err != nil {
 			span.RecordError(err)
 			span.SetStatus(codes.Error, err.Error())
 			return err
@@ -218,11 +186,13 @@ func (s *Ship) ForceBuyFuel(ctx context.Context, fuel int) error {
 		return err
 	}
 
-	log.Printf("Priority purchase of %s issued: %d\n", "FUEL", fuel)
+	logging.Info(newCtx, "Priority purchase of fuel issued", "quantity", fuel)
 
 	if s.Details.SpaceAvailable > fuel {
-		log.Printf("Enough space in cargo bay. Buying fuel...")
-		if _, err = s.Buy(newCtx, "FUEL", fuel); err != nil {
+		logging.Debug(newCtx, "Enough space in the cargo bay, buying fuel", "space_available", s.Details.SpaceAvailable)
+		trade, err := s.Buy(newCtx, "FUEL", fuel)
+		result.record("buy", "FUEL", fuel, trade, err)
+		if err != nil {
 			span.RecordError(err)
 			span.SetStatus(codes.Error, err.Error())
 			return err
@@ -230,29 +200,38 @@ func (s *Ship) ForceBuyFuel(ctx context.Context, fuel int) error {
 		return nil
 	}
 
-	log.Printf("Not enough free room in cargo bay. Selling other goods to make room: %d", fuel)
+	logging.Info(newCtx, "Not enough room in the cargo bay, selling other goods to make room", "quantity", fuel,
+		"space_available", s.Details.SpaceAvailable)
 	remaining := fuel
 	for _, cargo := range s.Details.Cargo {
 		if _, ok := (*products)[cargo.Good]; ok {
-			log.Printf("Selling %v: max room to free (%d), need(%d)\n", cargo.Good, cargo.TotalVolume, remaining)
+			logging.Debug(newCtx, "Selling goods to make room", "good", cargo.Good, "volume", cargo.TotalVolume,
+				"needed", remaining)
 			if cargo.TotalVolume > remaining {
-				if _, err = s.Sell(newCtx, cargo.Good, remaining/(*products)[cargo.Good].VolumePerUnit); err != nil {
+				quantity := remaining / (*products)[cargo.Good].VolumePerUnit
+				trade, err := s.Sell(newCtx, cargo.Good, quantity)
+				result.record("sell", cargo.Good, quantity, trade, err)
+				if err != nil {
 					span.RecordError(err)
 					span.SetStatus(codes.Error, err.Error())
 					return err
 				}
 
-				if _, err = s.Buy(newCtx, "FUEL", fuel); err != nil {
+				trade, err = s.Buy(newCtx, "FUEL", fuel)
+				result.record("buy", "FUEL", fuel, trade, err)
+				if err != nil {
 					span.RecordError(err)
 					span.SetStatus(codes.Error, err.Error())
 					return err
 				}
 
-				log.Println("Ship is re-fueled.")
+				logging.Info(newCtx, "Ship is refueled", "quantity", fuel)
 				return nil
 			}
 
-			if _, err = s.Sell(newCtx, cargo.Good, cargo.Quantity); err != nil {
+			trade, err := s.Sell(newCtx, cargo.Good, cargo.Quantity)
+			result.record("sell", cargo.Good, cargo.Quantity, trade, err)
+			if err != nil {
 				span.RecordError(err)
 				span.SetStatus(codes.Error, err.Error())
 				return err
@@ -260,13 +239,15 @@ func (s *Ship) ForceBuyFuel(ctx context.Context, fuel int) error {
 			remaining -= cargo.Quantity
 		}
 	}
-	log.Println("ALERT! Not enough room to fuel!")
-	return fmt.Errorf("could not purchase fuel - impossible to sell products at location?")
+	logging.Warn(newCtx, "Not enough room to refuel", "quantity", fuel, "needed", remaining)
+	err = fmt.Errorf("%w: could not purchase fuel - impossible to sell products at location?", gameerror.ErrCargoFull)
+	result.record("buy", "FUEL", fuel, nil, err)
+	return err
 }
 
 // trade is generic call to buy and sell products in game.
 func (s *Ship) trade(ctx context.Context, action, good string, quantity int) (*Trade, error) {
-	_, span := s.tracer.Start(
+	tradeCtx, span := s.tracer.Start(
 		ctx,
 		"Trade goods",
 		trace.WithAttributes(
@@ -279,9 +260,9 @@ func (s *Ship) trade(ctx context.Context, action, good string, quantity int) (*T
 	var err error
 	switch strings.ToLower(action) {
 	case "sell":
-		data, err = s.webProxy.SellGood(good, quantity)
+		data, err = s.webProxy.SellGood(tradeCtx, good, quantity)
 	case "buy":
-		data, err = s.webProxy.BuyGood(good, quantity)
+		data, err = s.webProxy.BuyGood(tradeCtx, good, quantity)
 	}
 	if err != nil {
 		span.RecordError(err)
@@ -297,14 +278,17 @@ func (s *Ship) trade(ctx context.Context, action, good string, quantity int) (*T
 		return nil, err
 	}
 
-	if len(operation.Error.Message) > 0 {
+	if err = operation.Error.Err(); err != nil {
 		// Error from the server, we should still report it.
-		err = fmt.Errorf("ERROR FROM SERVER (%d): %s", operation.Error.Code, operation.Error.Message)
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
 		return nil, err
 	}
 
+	if s.dryRun {
+		return &operation, nil
+	}
+
 	switch strings.ToLower(action) {
 	case "sell":
 		web.MoneyEarned.
@@ -325,3 +309,13 @@ func (s *Ship) trade(ctx context.Context, action, good string, quantity int) (*T
 
 	return &operation, nil
 }
+
+// sortedGoods returns the goods in the list in alphabetical order, so the orders are always placed in the same order.
+func sortedGoods(goods map[string]int) []string {
+	sorted := make([]string, 0, len(goods))
+	for good := range goods {
+		sorted = append(sorted, good)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
@@ -2,13 +2,17 @@ package component_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"reflect"
 	"testing"
 
 	"github.com/golang/mock/gomock"
 	"github.com/otaviokr/spacetraders-ship/component"
+	"github.com/otaviokr/spacetraders-ship/gameerror"
 	"github.com/otaviokr/spacetraders-ship/mocks"
+	"github.com/otaviokr/spacetraders-ship/web"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"go.opentelemetry.io/otel/trace"
 )
 
@@ -47,10 +51,10 @@ func TestGetMarketplaceProducts(t *testing.T) {
 	proxy := mocks.NewMockProxy(ctrl)
 
 	for _, uc := range useCases {
-		proxy.EXPECT().GetShipInfo().Return([]byte(fmt.Sprintf("%v", uc["detailsResponse"])), nil)
-		proxy.EXPECT().GetShipInfo().Return([]byte(fmt.Sprintf("%v", uc["detailsResponse"])), nil)
+		proxy.EXPECT().GetShipInfo(gomock.Any()).Return([]byte(fmt.Sprintf("%v", uc["detailsResponse"])), nil)
+		proxy.EXPECT().GetShipInfo(gomock.Any()).Return([]byte(fmt.Sprintf("%v", uc["detailsResponse"])), nil)
 		proxy.EXPECT().
-			GetMarketplaceProducts(fmt.Sprintf("%v", uc["location"])).
+			GetMarketplaceProducts(gomock.Any(), fmt.Sprintf("%v", uc["location"])).
 			Return([]byte(fmt.Sprintf("%v", uc["marketResponse"])), nil)
 		ship, err := component.NewShipCustomProxy(
 			context.TODO(),
@@ -113,11 +117,11 @@ func TestDoCommerce(t *testing.T) {
 	proxy := mocks.NewMockProxy(ctrl)
 
 	for _, uc := range useCases {
-		proxy.EXPECT().GetShipInfo().Return([]byte(fmt.Sprintf("%v", uc["detailsResponse"])), nil)
-		proxy.EXPECT().GetShipInfo().Return([]byte(fmt.Sprintf("%v", uc["detailsResponse"])), nil)
-		proxy.EXPECT().GetShipInfo().Return([]byte(fmt.Sprintf("%v", uc["detailsResponse"])), nil)
+		proxy.EXPECT().GetShipInfo(gomock.Any()).Return([]byte(fmt.Sprintf("%v", uc["detailsResponse"])), nil)
+		proxy.EXPECT().GetShipInfo(gomock.Any()).Return([]byte(fmt.Sprintf("%v", uc["detailsResponse"])), nil)
+		proxy.EXPECT().GetShipInfo(gomock.Any()).Return([]byte(fmt.Sprintf("%v", uc["detailsResponse"])), nil)
 		proxy.EXPECT().
-			GetMarketplaceProducts(fmt.Sprintf("%v", uc["location"])).
+			GetMarketplaceProducts(gomock.Any(), fmt.Sprintf("%v", uc["location"])).
 			Return(
 				[]byte(fmt.Sprintf("%v", uc["marketResponse"])),
 				nil)
@@ -133,7 +137,7 @@ func TestDoCommerce(t *testing.T) {
 			t.Fail()
 		}
 
-		err = ship.DoCommerce(context.TODO(), uc["sell"].(map[string]int), uc["buy"].(map[string]int))
+		_, err = ship.DoCommerce(context.TODO(), uc["sell"].(map[string]int), uc["buy"].(map[string]int))
 		if err != nil {
 			t.Log(err)
 			t.Fail()
@@ -141,6 +145,95 @@ func TestDoCommerce(t *testing.T) {
 	}
 }
 
+func TestDoCommercePartialFailure(t *testing.T) {
+	detailsResponse := "{\"ship\":{\"id\":\"id0001\",\"location\":\"Local0001\",\"cargo\":[{\"good\":\"Good0001\",\"quantity\":5,\"totalVolume\":5}],\"spaceAvailable\":295,\"maxCargo\":300}}"
+	marketResponse := "{\"marketplace\": [{\"purchasePricePerUnit\": 2,\"sellPricePerUnit\": 4,\"symbol\": \"Good0001\",\"volumePerUnit\": 1},{\"purchasePricePerUnit\": 3,\"sellPricePerUnit\": 2,\"symbol\": \"Good0002\",\"volumePerUnit\": 1}]}"
+	sellResponse := "{\"credits\": 120, \"order\": {\"good\": \"Good0001\",\"pricePerUnit\": 4,\"quantity\": 5,\"total\": 20}}"
+	buyResponse := "{\"error\":{\"message\":\"User has insufficient funds to purchase the goods.\",\"code\":2004}}"
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	proxy := mocks.NewMockProxy(ctrl)
+	proxy.EXPECT().GetShipInfo(gomock.Any()).Return([]byte(detailsResponse), nil).Times(4)
+	proxy.EXPECT().GetMarketplaceProducts(gomock.Any(), "Local0001").Return([]byte(marketResponse), nil)
+	proxy.EXPECT().SellGood(gomock.Any(), "Good0001", 5).Return([]byte(sellResponse), nil)
+	proxy.EXPECT().BuyGood(gomock.Any(), "Good0002", 10).Return([]byte(buyResponse), nil)
+
+	ship, err := component.NewShipCustomProxy(
+		context.TODO(),
+		trace.NewNoopTracerProvider().Tracer(""),
+		proxy,
+		"id0001")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := ship.DoCommerce(context.TODO(), map[string]int{"Good0001": -1}, map[string]int{"Good0002": 10, "Good0003": 1})
+	if err == nil {
+		t.Fatal("expected error, got none")
+	}
+
+	var commerceErr *component.CommerceError
+	if !errors.As(err, &commerceErr) || len(commerceErr.Failures) != 1 {
+		t.Fatalf("expected one failure in a CommerceError, got %v", err)
+	}
+
+	if !errors.Is(err, gameerror.ErrInsufficientCredits) {
+		t.Fatalf("expected insufficient credits, got %v", err)
+	}
+
+	if result.Outcome() != component.CommercePartial {
+		t.Fatalf("\nACTUAL: %s\nEXPECT: %s\n", result.Outcome(), component.CommercePartial)
+	}
+
+	if result.CreditsDelta != 20 {
+		t.Fatalf("\nACTUAL: %d\nEXPECT: %d\n", result.CreditsDelta, 20)
+	}
+
+	expectedSkipped := []component.SkippedGood{{Good: "Good0003", Reason: "not traded in marketplace"}}
+	if !reflect.DeepEqual(result.Skipped, expectedSkipped) {
+		t.Fatalf("\nACTUAL: %+v\nEXPECT: %+v\n", result.Skipped, expectedSkipped)
+	}
+}
+
+func TestDoCommerceMarketplaceFailure(t *testing.T) {
+	detailsResponse := "{\"ship\":{\"id\":\"id0009\",\"location\":\"Local0009\",\"cargo\":[],\"spaceAvailable\":300,\"maxCargo\":300}}"
+	marketErr := errors.New("marketplace unavailable")
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	proxy := mocks.NewMockProxy(ctrl)
+	proxy.EXPECT().GetShipInfo(gomock.Any()).Return([]byte(detailsResponse), nil).Times(2)
+	proxy.EXPECT().GetMarketplaceProducts(gomock.Any(), "Local0009").Return(nil, marketErr)
+
+	ship, err := component.NewShipCustomProxy(
+		context.TODO(),
+		trace.NewNoopTracerProvider().Tracer(""),
+		proxy,
+		"id0009")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	failed := web.CommerceStops.WithLabelValues("id0009", "Local0009", component.CommerceFailed)
+	idle := web.CommerceStops.WithLabelValues("id0009", "Local0009", component.CommerceIdle)
+	failedBefore, idleBefore := testutil.ToFloat64(failed), testutil.ToFloat64(idle)
+
+	result, err := ship.DoCommerce(context.TODO(), map[string]int{"Good0001": -1}, nil)
+	if !errors.Is(err, marketErr) || !errors.Is(result.MarketplaceErr, marketErr) {
+		t.Fatalf("\nACTUAL: %v (%v)\nEXPECT: %v\n", err, result.MarketplaceErr, marketErr)
+	}
+	if result.Outcome() != component.CommerceFailed {
+		t.Fatalf("\nACTUAL: %s\nEXPECT: %s\n", result.Outcome(), component.CommerceFailed)
+	}
+	if testutil.ToFloat64(failed) != failedBefore+1 || testutil.ToFloat64(idle) != idleBefore {
+		t.Fatalf("\nACTUAL: failed %v, idle %v\nEXPECT: failed %v, idle %v\n",
+			testutil.ToFloat64(failed), testutil.ToFloat64(idle), failedBefore+1, idleBefore)
+	}
+}
+
 func TestSellAll(t *testing.T) {
 	useCases := map[string]map[string]interface{}{
 		"uc1": {
@@ -178,9 +271,9 @@ func TestSellAll(t *testing.T) {
 	proxy := mocks.NewMockProxy(ctrl)
 
 	for _, uc := range useCases {
-		proxy.EXPECT().GetShipInfo().Return([]byte(fmt.Sprintf("%v", uc["detailsResponse"])), nil)
-		// proxy.EXPECT().GetShipInfo().Return([]byte(fmt.Sprintf("%v", uc["detailsResponse"])), nil)
-		// proxy.EXPECT().GetShipInfo().Return([]byte(fmt.Sprintf("%v", uc["detailsResponse"])), nil)
+		proxy.EXPECT().GetShipInfo(gomock.Any()).Return([]byte(fmt.Sprintf("%v", uc["detailsResponse"])), nil)
+		// proxy.EXPECT().GetShipInfo(gomock.Any()).Return([]byte(fmt.Sprintf("%v", uc["detailsResponse"])), nil)
+		// proxy.EXPECT().GetShipInfo(gomock.Any()).Return([]byte(fmt.Sprintf("%v", uc["detailsResponse"])), nil)
 		// proxy.EXPECT().
 		// 	GetMarketplaceProducts(fmt.Sprintf("%v", uc["location"])).
 		// 	Return(
@@ -198,7 +291,7 @@ func TestSellAll(t *testing.T) {
 			t.Fail()
 		}
 
-		err = ship.SellAll(context.TODO(), uc["sell"].(map[string]int), uc["marketplace"].(map[string]component.Product))
+		_, err = ship.SellAll(context.TODO(), uc["sell"].(map[string]int), uc["marketplace"].(map[string]component.Product))
 		if err != nil {
 			t.Log(err)
 			t.Fail()
@@ -243,9 +336,9 @@ func TestBuyAll(t *testing.T) {
 	proxy := mocks.NewMockProxy(ctrl)
 
 	for _, uc := range useCases {
-		proxy.EXPECT().GetShipInfo().Return([]byte(fmt.Sprintf("%v", uc["detailsResponse"])), nil)
-		// proxy.EXPECT().GetShipInfo().Return([]byte(fmt.Sprintf("%v", uc["detailsResponse"])), nil)
-		// proxy.EXPECT().GetShipInfo().Return([]byte(fmt.Sprintf("%v", uc["detailsResponse"])), nil)
+		proxy.EXPECT().GetShipInfo(gomock.Any()).Return([]byte(fmt.Sprintf("%v", uc["detailsResponse"])), nil)
+		// proxy.EXPECT().GetShipInfo(gomock.Any()).Return([]byte(fmt.Sprintf("%v", uc["detailsResponse"])), nil)
+		// proxy.EXPECT().GetShipInfo(gomock.Any()).Return([]byte(fmt.Sprintf("%v", uc["detailsResponse"])), nil)
 		// proxy.EXPECT().
 		// 	GetMarketplaceProducts(fmt.Sprintf("%v", uc["location"])).
 		// 	Return(
@@ -263,7 +356,7 @@ func TestBuyAll(t *testing.T) {
 			t.Fail()
 		}
 
-		err = ship.BuyAll(context.TODO(), uc["sell"].(map[string]int), uc["marketplace"].(map[string]component.Product))
+		_, err = ship.BuyAll(context.TODO(), uc["sell"].(map[string]int), uc["marketplace"].(map[string]component.Product))
 		if err != nil {
 			t.Log(err)
 			t.Fail()
@@ -318,9 +411,9 @@ func TestSell(t *testing.T) {
 	proxy := mocks.NewMockProxy(ctrl)
 
 	for _, uc := range useCases {
-		proxy.EXPECT().GetShipInfo().Return([]byte(fmt.Sprintf("%v", uc["detailsResponse"])), nil)
-		// proxy.EXPECT().GetShipInfo().Return([]byte(fmt.Sprintf("%v", uc["detailsResponse"])), nil)
-		proxy.EXPECT().SellGood(fmt.Sprintf("%v", uc["good"]), uc["quantity"].(int)).
+		proxy.EXPECT().GetShipInfo(gomock.Any()).Return([]byte(fmt.Sprintf("%v", uc["detailsResponse"])), nil)
+		// proxy.EXPECT().GetShipInfo(gomock.Any()).Return([]byte(fmt.Sprintf("%v", uc["detailsResponse"])), nil)
+		proxy.EXPECT().SellGood(gomock.Any(), fmt.Sprintf("%v", uc["good"]), uc["quantity"].(int)).
 			Return([]byte(fmt.Sprintf("%v", uc["sellGoodResponse"])), nil)
 		ship, err := component.NewShipCustomProxy(
 			context.TODO(),
@@ -392,9 +485,9 @@ func TestBuy(t *testing.T) {
 	proxy := mocks.NewMockProxy(ctrl)
 
 	for _, uc := range useCases {
-		proxy.EXPECT().GetShipInfo().Return([]byte(fmt.Sprintf("%v", uc["detailsResponse"])), nil)
-		// proxy.EXPECT().GetShipInfo().Return([]byte(fmt.Sprintf("%v", uc["detailsResponse"])), nil)
-		proxy.EXPECT().BuyGood(fmt.Sprintf("%v", uc["good"]), uc["quantity"].(int)).
+		proxy.EXPECT().GetShipInfo(gomock.Any()).Return([]byte(fmt.Sprintf("%v", uc["detailsResponse"])), nil)
+		// proxy.EXPECT().GetShipInfo(gomock.Any()).Return([]byte(fmt.Sprintf("%v", uc["detailsResponse"])), nil)
+		proxy.EXPECT().BuyGood(gomock.Any(), fmt.Sprintf("%v", uc["good"]), uc["quantity"].(int)).
 			Return([]byte(fmt.Sprintf("%v", uc["buyGoodResponse"])), nil)
 		ship, err := component.NewShipCustomProxy(
 			context.TODO(),
@@ -447,8 +540,8 @@ func TestForceBuyFuel(t *testing.T) {
 	proxy := mocks.NewMockProxy(ctrl)
 
 	for _, uc := range useCases {
-		proxy.EXPECT().GetShipInfo().Return([]byte(fmt.Sprintf("%v", uc["detailsResponse"])), nil)
-		proxy.EXPECT().BuyGood(fmt.Sprintf("%v", uc["good"]), uc["quantity"].(int)).
+		proxy.EXPECT().GetShipInfo(gomock.Any()).Return([]byte(fmt.Sprintf("%v", uc["detailsResponse"])), nil)
+		proxy.EXPECT().BuyGood(gomock.Any(), fmt.Sprintf("%v", uc["good"]), uc["quantity"].(int)).
 			Return([]byte(fmt.Sprintf("%v", uc["buyGoodResponse"])), nil)
 		ship, err := component.NewShipCustomProxy(
 			context.TODO(),
@@ -518,13 +611,13 @@ func TestForceBuyFuelNoSpace(t *testing.T) {
 	proxy := mocks.NewMockProxy(ctrl)
 
 	for _, uc := range useCases {
-		proxy.EXPECT().GetShipInfo().Return([]byte(fmt.Sprintf("%v", uc["detailsResponse"])), nil)
-		proxy.EXPECT().GetShipInfo().Return([]byte(fmt.Sprintf("%v", uc["detailsResponse"])), nil)
-		proxy.EXPECT().GetMarketplaceProducts(uc["location"]).
+		proxy.EXPECT().GetShipInfo(gomock.Any()).Return([]byte(fmt.Sprintf("%v", uc["detailsResponse"])), nil)
+		proxy.EXPECT().GetShipInfo(gomock.Any()).Return([]byte(fmt.Sprintf("%v", uc["detailsResponse"])), nil)
+		proxy.EXPECT().GetMarketplaceProducts(gomock.Any(), uc["location"]).
 			Return([]byte(fmt.Sprintf("%v", uc["marketplaceResponse"])), nil)
-		proxy.EXPECT().SellGood(fmt.Sprintf("%v", "Good001"), uc["quantity"].(int)).
+		proxy.EXPECT().SellGood(gomock.Any(), fmt.Sprintf("%v", "Good001"), uc["quantity"].(int)).
 			Return([]byte(fmt.Sprintf("%v", uc["sellGoodResponse"])), nil)
-		proxy.EXPECT().BuyGood(fmt.Sprintf("%v", uc["good"]), uc["quantity"].(int)).
+		proxy.EXPECT().BuyGood(gomock.Any(), fmt.Sprintf("%v", uc["good"]), uc["quantity"].(int)).
 			Return([]byte(fmt.Sprintf("%v", uc["buyGoodResponse"])), nil)
 		ship, err := component.NewShipCustomProxy(
 			context.TODO(),
@@ -0,0 +1,118 @@
+package component
+
+import "time"
+
+// maxObservedFlights is how many of the latest flights are kept, enough to estimate the next ones.
+const maxObservedFlights = 50
+
+// Observations is what the ship learned about the game while following the route: where the stations it visited are
+// and when it was last there, what their marketplaces traded the last time it looked and how its latest flights went.
+// It is used to estimate routes it did not follow yet.
+type Observations struct {
+	Locations map[string]Coordinates
+	Visits    map[string]time.Time
+	Markets   map[string]ObservedMarket
+	Flights   []ObservedFlight
+}
+
+// Coordinates is where a station is in the system.
+type Coordinates struct {
+	X int
+	Y int
+}
+
+// ObservedMarket is the marketplace of a station, by good, and when it was seen.
+type ObservedMarket struct {
+	SeenAt   time.Time
+	Products map[string]Product
+}
+
+// ObservedFlight is a flight plan of the ship: how far it went, with which ship, and what it cost.
+type ObservedFlight struct {
+	Departure   string
+	Destination string
+	ShipType    string
+	Speed       int
+	Distance    int
+	Fuel        int
+	Duration    time.Duration
+}
+
+// observeLocation records where the ship is, if it is docked somewhere, and when.
+func (o *Observations) observeLocation(details ShipDetails, at time.Time) {
+	if len(details.Location) < 1 {
+		return
+	}
+	if o.Locations == nil {
+		o.Locations = map[string]Coordinates{}
+		o.Visits = map[string]time.Time{}
+	}
+	o.Locations[details.Location] = Coordinates{X: details.X, Y: details.Y}
+	o.Visits[details.Location] = at
+}
+
+// observeMarket records the products traded at the station.
+func (o *Observations) observeMarket(station string, products map[string]Product, at time.Time) {
+	if o.Markets == nil {
+		o.Markets = map[string]ObservedMarket{}
+	}
+	o.Markets[station] = ObservedMarket{SeenAt: at, Products: products}
+}
+
+// observeFlight records the flight plan the ship just got, unless it has no distance (e.g., in a dry run).
+func (o *Observations) observeFlight(details ShipDetails, plan FlightPlanDetails) {
+	if plan.Distance < 1 {
+		return
+	}
+
+	duration := time.Duration(plan.TimeRemainingInSeconds) * time.Second
+	createdAt, errCreated := time.Parse(time.RFC3339, plan.CreatedAt)
+	arrivesAt, errArrives := time.Parse(time.RFC3339, plan.ArrivesAt)
+	if errCreated == nil && errArrives == nil && arrivesAt.After(createdAt) {
+		duration = arrivesAt.Sub(createdAt)
+	}
+
+	o.Flights = append(o.Flights, ObservedFlight{
+		Departure:   plan.Departure,
+		Destination: plan.Destination,
+		ShipType:    details.Type,
+		Speed:       details.Speed,
+		Distance:    plan.Distance,
+		Fuel:        plan.FuelConsumed,
+		Duration:    duration,
+	})
+	if len(o.Flights) > maxObservedFlights {
+		o.Flights = o.Flights[len(o.Flights)-maxObservedFlights:]
+	}
+}
+
+// Observations returns a copy of what the ship learned so far.
+func (s *Ship) Observations() Observations {
+	observations := Observations{
+		Locations: make(map[string]Coordinates, len(s.observed.Locations)),
+		Visits:    make(map[string]time.Time, len(s.observed.Visits)),
+		Markets:   make(map[string]ObservedMarket, len(s.observed.Markets)),
+		Flights:   append([]ObservedFlight{}, s.observed.Flights...),
+	}
+	for station, coordinates := range s.observed.Locations {
+		observations.Locations[station] = coordinates
+	}
+	for station, at := range s.observed.Visits {
+		observations.Visits[station] = at
+	}
+	for station, market := range s.observed.Markets {
+		products := make(map[string]Product, len(market.Products))
+		for good, product := range market.Products {
+			products[good] = product
+		}
+		observations.Markets[station] = ObservedMarket{SeenAt: market.SeenAt, Products: products}
+	}
+	return observations
+}
+
+// KnownPrice returns the product (with its prices) of the good the last time the marketplace of the station was
+// seen by the ship, if it was.
+func (s *Ship) KnownPrice(station, good string) (Product, bool) {
+	product, ok := s.observed.Markets[station].Products[good]
+	return product, ok
+}
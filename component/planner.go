@@ -0,0 +1,193 @@
+package component
+
+import (
+	"context"
+	"errors"
+
+	"github.com/otaviokr/spacetraders-ship/gameerror"
+	"github.com/otaviokr/spacetraders-ship/logging"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SellEverything is the quantity used in the route to sell the whole lot of a good.
+const SellEverything = -1
+
+// Order is a buy or sell order planned for a marketplace.
+type Order struct {
+	Action   string
+	Good     string
+	Quantity int
+}
+
+// CommercePlan is the ordered list of orders to place at a stop, and the goods from the route that will not be traded.
+type CommercePlan struct {
+	Location string
+	Orders   []Order
+	Skipped  []SkippedGood
+}
+
+// PlanCommerce decides the orders to place at the marketplace, given the ship details, the products traded there and
+// what the route stop wants to sell and buy. It does not talk to the game nor change its arguments.
+//
+// All sales come first, to make room in the cargo. Then FUEL is bought, and then the other goods, completing the lots
+// defined in the route with what is already in the cargo.
+func PlanCommerce(details ShipDetails, products map[string]Product, stop RouteStop) *CommercePlan {
+	plan := &CommercePlan{Location: details.Location}
+
+	cargo := map[string]int{}
+	for _, c := range details.Cargo {
+		cargo[c.Good] += c.Quantity
+	}
+	space := details.SpaceAvailable
+
+	for _, good := range sortedGoods(stop.Sell) {
+		product, ok := products[good]
+		if !ok {
+			plan.skip(good, "not traded in marketplace")
+			continue
+		}
+
+		quantity := stop.Sell[good]
+		if quantity == SellEverything || quantity > cargo[good] {
+			quantity = cargo[good]
+		}
+		if quantity <= 0 {
+			plan.skip(good, "nothing to sell")
+			continue
+		}
+
+		plan.Orders = append(plan.Orders, Order{Action: "sell", Good: good, Quantity: quantity})
+		cargo[good] -= quantity
+		space += quantity * product.VolumePerUnit
+	}
+
+	// Fuel has priority over everything else.
+	goods := sortedGoods(stop.Buy)
+	for i, good := range goods {
+		if good == "FUEL" {
+			goods = append([]string{good}, append(goods[:i:i], goods[i+1:]...)...)
+			break
+		}
+	}
+
+	for _, good := range goods {
+		product, ok := products[good]
+		if !ok {
+			plan.skip(good, "not traded in marketplace")
+			continue
+		}
+
+		quantity := stop.Buy[good] - cargo[good]
+		if quantity <= 0 {
+			plan.skip(good, "lot already complete")
+			continue
+		}
+
+		// Fuel is bought even if other goods must be sold to make room for it (see Ship.ForceBuyFuel).
+		if good != "FUEL" {
+			if product.VolumePerUnit > 0 && quantity*product.VolumePerUnit > space {
+				quantity = space / product.VolumePerUnit
+			}
+			if product.QuantityAvailable > 0 && quantity > product.QuantityAvailable {
+				quantity = product.QuantityAvailable
+			}
+			if quantity <= 0 {
+				plan.skip(good, "cargo full")
+				continue
+			}
+		}
+
+		plan.Orders = append(plan.Orders, Order{Action: "buy", Good: good, Quantity: quantity})
+		cargo[good] += quantity
+		space -= quantity * product.VolumePerUnit
+		if space < 0 {
+			space = 0
+		}
+	}
+
+	return plan
+}
+
+// skip adds a good that will not be traded to the plan.
+func (p *CommercePlan) skip(good, reason string) {
+	p.Skipped = append(p.Skipped, SkippedGood{Good: good, Reason: reason})
+}
+
+// ExecuteOrders sends the orders in the plan to the game, in the same order.
+//
+// If the ship runs out of credits or leaves the marketplace, the remaining orders are skipped. If the cargo is full,
+// only fuel is still bought.
+func (s *Ship) ExecuteOrders(ctx context.Context, plan *CommercePlan) (*CommerceResult, error) {
+	execCtx, span := s.tracer.Start(
+		ctx,
+		"Execute orders",
+		trace.WithAttributes(
+			attribute.Key("location").String(plan.Location),
+			attribute.Key("orders").Int(len(plan.Orders)),
+			attribute.Key("skipped").Int(len(plan.Skipped))))
+	defer span.End()
+
+	result := &CommerceResult{Location: plan.Location}
+	result.Skipped = append(result.Skipped, plan.Skipped...)
+
+	sold := false
+	refreshed := false
+	cargoFull := false
+	for i, order := range plan.Orders {
+		var trade *Trade
+		var err error
+
+		switch {
+		case order.Action == "sell":
+			logging.Info(execCtx, "Selling goods", "good", order.Good, "quantity", order.Quantity)
+			trade, err = s.Sell(execCtx, order.Good, order.Quantity)
+			result.record(order.Action, order.Good, order.Quantity, trade, err)
+			sold = sold || err == nil
+		case cargoFull && order.Good != "FUEL":
+			result.skip(order.Good, "cargo full")
+			continue
+		default:
+			if sold && !refreshed {
+				// Buying fuel may need to sell goods, so it must know what is left in the cargo.
+				if err = s.GetDetails(execCtx); err != nil {
+					span.RecordError(err)
+				}
+				refreshed = true
+			}
+
+			if order.Good == "FUEL" {
+				logging.Info(execCtx, "Buying fuel first", "quantity", order.Quantity)
+				err = s.forceBuyFuel(execCtx, order.Quantity, result)
+			} else {
+				logging.Info(execCtx, "Buying goods", "good", order.Good, "quantity", order.Quantity)
+				trade, err = s.Buy(execCtx, order.Good, order.Quantity)
+				result.record(order.Action, order.Good, order.Quantity, trade, err)
+			}
+		}
+
+		switch {
+		case errors.Is(err, gameerror.ErrInsufficientCredits), errors.Is(err, gameerror.ErrShipInTransit):
+			// No point in trying the other orders.
+			span.RecordError(err)
+			for _, remaining := range plan.Orders[i+1:] {
+				result.skip(remaining.Good, err.Error())
+			}
+			err = result.Err()
+			span.SetStatus(codes.Error, err.Error())
+			return result, err
+		case errors.Is(err, gameerror.ErrCargoFull):
+			span.RecordError(err)
+			cargoFull = true
+		case err != nil:
+			span.RecordError(err)
+		}
+	}
+
+	if err := result.Err(); err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return result, err
+	}
+	return result, nil
+}
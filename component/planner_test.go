@@ -0,0 +1,120 @@
+package component_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/otaviokr/spacetraders-ship/component"
+)
+
+func TestPlanCommerce(t *testing.T) {
+	products := map[string]component.Product{
+		"FUEL":           {Symbol: "FUEL", VolumePerUnit: 1, PurchasePricePerUnit: 2, SellPricePerUnit: 1},
+		"DRONES":         {Symbol: "DRONES", VolumePerUnit: 2, PurchasePricePerUnit: 50, SellPricePerUnit: 45},
+		"CHEMICALS":      {Symbol: "CHEMICALS", VolumePerUnit: 1, PurchasePricePerUnit: 20, SellPricePerUnit: 18},
+		"CONSUMER_GOODS": {Symbol: "CONSUMER_GOODS", VolumePerUnit: 1, QuantityAvailable: 10, PurchasePricePerUnit: 5},
+	}
+
+	useCases := map[string]map[string]interface{}{
+		"sell everything": {
+			"details": component.ShipDetails{
+				Location:       "OE-PM",
+				Cargo:          []component.ShipCargo{{Good: "DRONES", Quantity: 10, TotalVolume: 20}},
+				SpaceAvailable: 80},
+			"stop": component.RouteStop{Sell: map[string]int{"DRONES": -1}},
+			"expected": &component.CommercePlan{
+				Location: "OE-PM",
+				Orders:   []component.Order{{Action: "sell", Good: "DRONES", Quantity: 10}}}},
+		"sell more than in cargo": {
+			"details": component.ShipDetails{
+				Location:       "OE-PM",
+				Cargo:          []component.ShipCargo{{Good: "DRONES", Quantity: 10, TotalVolume: 20}},
+				SpaceAvailable: 80},
+			"stop": component.RouteStop{Sell: map[string]int{"DRONES": 50}},
+			"expected": &component.CommercePlan{
+				Location: "OE-PM",
+				Orders:   []component.Order{{Action: "sell", Good: "DRONES", Quantity: 10}}}},
+		"sell what is not traded or not in cargo": {
+			"details": component.ShipDetails{
+				Location:       "OE-PM",
+				Cargo:          []component.ShipCargo{{Good: "METALS", Quantity: 10, TotalVolume: 10}},
+				SpaceAvailable: 90},
+			"stop": component.RouteStop{Sell: map[string]int{"METALS": -1, "CHEMICALS": -1}},
+			"expected": &component.CommercePlan{
+				Location: "OE-PM",
+				Skipped: []component.SkippedGood{
+					{Good: "CHEMICALS", Reason: "nothing to sell"},
+					{Good: "METALS", Reason: "not traded in marketplace"}}}},
+		"sell before buying, fuel first": {
+			"details": component.ShipDetails{
+				Location: "OE-PM",
+				Cargo: []component.ShipCargo{
+					{Good: "FUEL", Quantity: 5, TotalVolume: 5},
+					{Good: "DRONES", Quantity: 45, TotalVolume: 90}},
+				SpaceAvailable: 5},
+			"stop": component.RouteStop{
+				Sell: map[string]int{"DRONES": -1},
+				Buy:  map[string]int{"CHEMICALS": 80, "FUEL": 20}},
+			"expected": &component.CommercePlan{
+				Location: "OE-PM",
+				Orders: []component.Order{
+					{Action: "sell", Good: "DRONES", Quantity: 45},
+					{Action: "buy", Good: "FUEL", Quantity: 15},
+					{Action: "buy", Good: "CHEMICALS", Quantity: 80}}}},
+		"buy limited by cargo space": {
+			"details": component.ShipDetails{
+				Location:       "OE-PM",
+				Cargo:          []component.ShipCargo{{Good: "FUEL", Quantity: 20, TotalVolume: 20}},
+				SpaceAvailable: 15},
+			"stop": component.RouteStop{Buy: map[string]int{"DRONES": 100}},
+			"expected": &component.CommercePlan{
+				Location: "OE-PM",
+				Orders:   []component.Order{{Action: "buy", Good: "DRONES", Quantity: 7}}}},
+		"buy limited by the marketplace": {
+			"details": component.ShipDetails{
+				Location:       "OE-PM",
+				SpaceAvailable: 100},
+			"stop": component.RouteStop{Buy: map[string]int{"CONSUMER_GOODS": 50}},
+			"expected": &component.CommercePlan{
+				Location: "OE-PM",
+				Orders:   []component.Order{{Action: "buy", Good: "CONSUMER_GOODS", Quantity: 10}}}},
+		"complete lots": {
+			"details": component.ShipDetails{
+				Location: "OE-PM",
+				Cargo: []component.ShipCargo{
+					{Good: "FUEL", Quantity: 30, TotalVolume: 30},
+					{Good: "CHEMICALS", Quantity: 10, TotalVolume: 10}},
+				SpaceAvailable: 60},
+			"stop": component.RouteStop{Buy: map[string]int{"FUEL": 20, "CHEMICALS": 40}},
+			"expected": &component.CommercePlan{
+				Location: "OE-PM",
+				Orders:   []component.Order{{Action: "buy", Good: "CHEMICALS", Quantity: 30}},
+				Skipped:  []component.SkippedGood{{Good: "FUEL", Reason: "lot already complete"}}}},
+		"cargo full": {
+			"details": component.ShipDetails{
+				Location:       "OE-PM",
+				Cargo:          []component.ShipCargo{{Good: "CHEMICALS", Quantity: 100, TotalVolume: 100}},
+				SpaceAvailable: 0},
+			"stop": component.RouteStop{Buy: map[string]int{"DRONES": 10, "FUEL": 10}},
+			"expected": &component.CommercePlan{
+				Location: "OE-PM",
+				Orders:   []component.Order{{Action: "buy", Good: "FUEL", Quantity: 10}},
+				Skipped:  []component.SkippedGood{{Good: "DRONES", Reason: "cargo full"}}}}}
+
+	for name, uc := range useCases {
+		stop := uc["stop"].(component.RouteStop)
+		before := map[string]int{}
+		for good, quantity := range stop.Sell {
+			before[good] = quantity
+		}
+
+		actual := component.PlanCommerce(uc["details"].(component.ShipDetails), products, stop)
+		if !reflect.DeepEqual(actual, uc["expected"].(*component.CommercePlan)) {
+			t.Fatalf("%s\nACTUAL: %+v\nEXPECT: %+v\n", name, actual, uc["expected"])
+		}
+
+		if len(stop.Sell) > 0 && !reflect.DeepEqual(stop.Sell, before) {
+			t.Fatalf("%s: route stop was changed by the planner: %+v", name, stop.Sell)
+		}
+	}
+}
@@ -1,42 +1,136 @@
 package component
 
 import (
+	"fmt"
 	"io"
 	"os"
-
-	"gopkg.in/yaml.v3"
+	"strings"
+	"time"
 )
 
 // Route is the representation of the route file.
+//
+// By default, the route runs forever. Cycles and Until limit how long it runs, and Then names the route to follow
+// when it is finished; Windows limit when the cycles can start (see Finished, NextWindow and NextRouteFile).
+//
+// Instead of a single list of stops, the file can list Candidates; each cycle, the ship follows the one expected to be
+// the most profitable (see backtest.SelectRoute).
 type Route struct {
+	Route      []RouteStop  `yaml:"route"`
+	Candidates []Candidate  `yaml:"candidates,omitempty"`
+	Cycles     int          `yaml:"cycles,omitempty"`
+	Until      time.Time    `yaml:"until,omitempty"`
+	Then       string       `yaml:"then,omitempty"`
+	Windows    []TimeWindow `yaml:"windows,omitempty"`
+	Error      Error        `yaml:"error"`
+}
+
+// Candidate is one of the routes the ship can choose from, each cycle.
+type Candidate struct {
+	Name  string      `yaml:"name"`
 	Route []RouteStop `yaml:"route"`
-	Error Error       `yaml:"error"`
 }
 
-// RouteStop is the representation of each stop, its location, what to buy and what to sell.
+// RouteStop is the representation of each stop, its location, what to buy and what to sell. If When is set, the stop is
+// only visited when its conditions hold (see ShouldVisit). In the file, a stop can instead name a Segment, which is
+// replaced by the stops of that segment when the file is read.
 type RouteStop struct {
 	Station string         `yaml:"station"`
 	Buy     map[string]int `yaml:"buy"`
 	Sell    map[string]int `yaml:"sell"`
+	When    *StopCondition `yaml:"when,omitempty"`
+	Segment string         `yaml:"segment,omitempty"`
 }
 
-// ReadRouteFile will read the YAML file with the route definition.
+// ReadRouteFile will read the YAML file with the route definition. Included files are relative to its directory.
 func ReadRouteFile(path string) (*Route, error) {
-	// read yaml config (route)
-	f, err := os.Open(path)
+	return readRouteFile(path, os.ReadFile)
+}
+
+// ReadRouteDescription will generate the component.Route instance from the data read from YAML file. Besides the
+// route, the file can include other files, and define variables and segments (see routeTemplate); included files are
+// relative to the working directory.
+func ReadRouteDescription(data io.Reader) (*Route, error) {
+	content, err := io.ReadAll(data)
 	if err != nil {
 		return nil, err
 	}
-	defer f.Close()
-	return ReadRouteDescription(f)
+	return loadRoute(content, ".", os.ReadFile)
 }
 
-// ReadRouteDescription will generate the component.Route instance from the data read from YAML file.
-func ReadRouteDescription(data io.Reader) (*Route, error) {
-	var routes Route
-	decoder := yaml.NewDecoder(data)
-	if err := decoder.Decode(&routes); err != nil {
-		return nil, err
+// Validate checks the route before the ship goes through it, listing every problem found: a route without stops, stops
+// without a station, goods without a name or with a quantity that is not positive (except SellEverything) and
+// conditions that can never hold, as well as a negative cycle limit and time windows that cannot be read. Candidates
+// must have a unique name, and are checked the same way.
+func (r *Route) Validate() error {
+	var problems []string
+	switch {
+	case len(r.Candidates) > 0 && len(r.Route) > 0:
+		problems = append(problems, "the route has both stops and candidates, use only one of them")
+	case len(r.Candidates) > 0:
+		names := map[string]bool{}
+		for i, candidate := range r.Candidates {
+			where := fmt.Sprintf("candidate %d", i+1)
+			if len(strings.TrimSpace(candidate.Name)) < 1 {
+				problems = append(problems, fmt.Sprintf("%s: name is required", where))
+			} else if names[candidate.Name] {
+				problems = append(problems, fmt.Sprintf("%s: name %s is already used", where, candidate.Name))
+			} else {
+				where = fmt.Sprintf("candidate %s", candidate.Name)
+			}
+			names[candidate.Name] = true
+
+			if len(candidate.Route) < 1 {
+				problems = append(problems, fmt.Sprintf("%s: the route has no stops", where))
+			}
+			problems = append(problems, validateStops(where+", ", candidate.Route)...)
+		}
+	case len(r.Route) < 1:
+		problems = append(problems, "the route has no stops")
+	default:
+		problems = append(problems, validateStops("", r.Route)...)
+	}
+	problems = append(problems, r.validateSchedule()...)
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid route:\n  - %s", strings.Join(problems, "\n  - "))
+	}
+	return nil
+}
+
+// validateStops lists the problems of the stops, each one prefixed by where the stops are.
+func validateStops(prefix string, stops []RouteStop) []string {
+	var problems []string
+	for i, stop := range stops {
+		where := fmt.Sprintf("%sstop %d", prefix, i+1)
+		if len(stop.Station) < 1 {
+			problems = append(problems, fmt.Sprintf("%s: station is required", where))
+		} else {
+			where += fmt.Sprintf(" (%s)", stop.Station)
+		}
+
+		for _, orders := range []struct {
+			action string
+			goods  map[string]int
+		}{{"sell", stop.Sell}, {"buy", stop.Buy}} {
+			for _, good := range sortedGoods(orders.goods) {
+				if len(strings.TrimSpace(good)) < 1 {
+					problems = append(problems, fmt.Sprintf("%s: %s has a good without name", where, orders.action))
+				} else if orders.action == "sell" && orders.goods[good] == SellEverything {
+					continue
+				} else if orders.goods[good] < 1 {
+					problem := fmt.Sprintf("%s: %s %s must be at least 1", where, orders.action, good)
+					if orders.action == "sell" {
+						problem += fmt.Sprintf(" (or %d to sell everything)", SellEverything)
+					}
+					problems = append(problems, fmt.Sprintf("%s, got %d", problem, orders.goods[good]))
+				}
+			}
+		}
+
+		if stop.When != nil {
+			problems = append(problems, stop.When.validate(where)...)
+		}
 	}
-	return &routes, nil
+	return problems
 }
@@ -36,3 +36,77 @@ func TestReadRouteDescription(t *testing.T) {
 		}
 	}
 }
+
+func TestRouteValidate(t *testing.T) {
+	useCases := map[string]map[string]interface{}{
+		"valid": {
+			"yaml":     "route:\n  - station: OE-PM\n    sell:\n      METALS: -1\n    buy:\n      FUEL: 20\n  - station: OE-CR",
+			"problems": []string{},
+		},
+		"no stops": {
+			"yaml":     "route: []",
+			"problems": []string{"the route has no stops"},
+		},
+		"missing station": {
+			"yaml":     "route:\n  - station: OE-PM\n  - buy:\n      FUEL: 20",
+			"problems": []string{"stop 2: station is required"},
+		},
+		"bad quantities": {
+			"yaml": "route:\n  - station: OE-PM\n    sell:\n      METALS: 0\n    buy:\n      FUEL: -1",
+			"problems": []string{
+				"stop 1 (OE-PM): sell METALS must be at least 1 (or -1 to sell everything), got 0",
+				"stop 1 (OE-PM): buy FUEL must be at least 1, got -1"},
+		},
+		"bad schedule": {
+			"yaml": "cycles: -1\nwindows:\n  - from: \"8am\"\n    to: \"18:00\"\nroute:\n  - station: OE-PM",
+			"problems": []string{
+				"cycles must not be negative, got -1",
+				"window 1: from \"8am\" is not a time of the day like 08:30"},
+		},
+		"candidates": {
+			"yaml": "candidates:\n  - name: a\n    route:\n      - station: OE-PM\n  - name: a\n    route: []\n  - route:\n      - station: \"\"",
+			"problems": []string{
+				"candidate 2: name a is already used",
+				"candidate 2: the route has no stops",
+				"candidate 3: name is required",
+				"candidate 3, stop 1: station is required"},
+		},
+		"stops and candidates": {
+			"yaml":     "route:\n  - station: OE-PM\ncandidates:\n  - name: a\n    route:\n      - station: OE-PM",
+			"problems": []string{"the route has both stops and candidates, use only one of them"},
+		},
+		"bad conditions": {
+			"yaml": "route:\n  - station: OE-PM\n    when:\n      every: -2\n      fuelBelow: -1\n      priceAbove:\n        METALS: -5",
+			"problems": []string{
+				"stop 1 (OE-PM): when.every must not be negative, got -2",
+				"stop 1 (OE-PM): when.fuelBelow must not be negative, got -1",
+				"stop 1 (OE-PM): when.priceAbove METALS must not be negative, got -5"},
+		},
+	}
+
+	for name, uc := range useCases {
+		t.Run(name, func(t *testing.T) {
+			route, err := component.ReadRouteDescription(strings.NewReader(uc["yaml"].(string)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = route.Validate()
+			problems := uc["problems"].([]string)
+			if len(problems) < 1 {
+				if err != nil {
+					t.Fatalf("\nACTUAL: %v\nEXPECT: no error\n", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("\nACTUAL: no error\nEXPECT: %v\n", problems)
+			}
+			for _, problem := range problems {
+				if !strings.Contains(err.Error(), problem) {
+					t.Fatalf("\nACTUAL: %v\nEXPECT: %s\n", err, problem)
+				}
+			}
+		})
+	}
+}
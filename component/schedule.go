@@ -0,0 +1,122 @@
+package component
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+// TimeWindow is a time of the day when the route can run, from From to To (both as "15:04", in UTC). A window where To
+// is before From goes through midnight; if both are the same, it is the whole day.
+type TimeWindow struct {
+	From string `yaml:"from"`
+	To   string `yaml:"to"`
+}
+
+// clockLayout is how the times of the windows are written.
+const clockLayout = "15:04"
+
+// parseClock returns how long after midnight the time of the day is.
+func parseClock(value string) (time.Duration, error) {
+	t, err := time.Parse(clockLayout, value)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a time of the day like 08:30", value)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// next returns when the window is open next: now, if it is already open.
+func (w TimeWindow) next(now time.Time) (time.Time, error) {
+	from, err := parseClock(w.From)
+	if err != nil {
+		return now, err
+	}
+	to, err := parseClock(w.To)
+	if err != nil {
+		return now, err
+	}
+
+	now = now.UTC()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	clock := now.Sub(midnight)
+
+	switch {
+	case from == to:
+		return now, nil
+	case from < to && clock >= from && clock < to:
+		return now, nil
+	case from > to && (clock >= from || clock < to):
+		return now, nil
+	case clock < from:
+		return midnight.Add(from), nil
+	}
+	return midnight.Add(24 * time.Hour).Add(from), nil
+}
+
+// Finished tells if the route must not start another cycle, after the given number of cycles, and why: the cycle limit
+// was reached or it is past the time limit.
+func (r *Route) Finished(cycles int, now time.Time) (bool, string) {
+	if r.Cycles > 0 && cycles >= r.Cycles {
+		return true, fmt.Sprintf("%d cycles completed", cycles)
+	}
+	if !r.Until.IsZero() && !now.Before(r.Until) {
+		return true, fmt.Sprintf("past %s", r.Until.Format(time.RFC3339))
+	}
+	return false, ""
+}
+
+// NextWindow returns when the next cycle can start: now, if the route has no time windows or one of them is open, or
+// when the next window opens, but never after the time limit of the route (so it can finish instead).
+func (r *Route) NextWindow(now time.Time) time.Time {
+	if len(r.Windows) < 1 {
+		return now
+	}
+
+	var start time.Time
+	for _, window := range r.Windows {
+		next, err := window.next(now)
+		if err != nil {
+			// Invalid windows are reported by Validate, and ignored here.
+			continue
+		}
+		if next.Equal(now.UTC()) {
+			return now
+		}
+		if start.IsZero() || next.Before(start) {
+			start = next
+		}
+	}
+
+	if start.IsZero() {
+		return now
+	}
+	if !r.Until.IsZero() && start.After(r.Until) {
+		return r.Until
+	}
+	return start
+}
+
+// NextRouteFile returns the path of the route to follow when this one is finished, or empty if there is none. A
+// relative path is relative to the directory of the current route file.
+func (r *Route) NextRouteFile(current string) string {
+	if len(r.Then) < 1 || filepath.IsAbs(r.Then) {
+		return r.Then
+	}
+	return filepath.Join(filepath.Dir(current), r.Then)
+}
+
+// validateSchedule lists the problems of the cycle limit and of the time windows.
+func (r *Route) validateSchedule() []string {
+	var problems []string
+	if r.Cycles < 0 {
+		problems = append(problems, fmt.Sprintf("cycles must not be negative, got %d", r.Cycles))
+	}
+	for i, window := range r.Windows {
+		for _, clock := range []struct{ name, value string }{{"from", window.From}, {"to", window.To}} {
+			if _, err := parseClock(clock.value); err != nil {
+				problems = append(problems, fmt.Sprintf("window %d: %s %v", i+1, clock.name, err))
+			}
+		}
+	}
+	return problems
+}
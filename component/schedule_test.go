@@ -0,0 +1,135 @@
+package component_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/otaviokr/spacetraders-ship/component"
+)
+
+func TestRouteFinished(t *testing.T) {
+	until := time.Date(2022, 7, 1, 12, 0, 0, 0, time.UTC)
+	useCases := map[string]map[string]interface{}{
+		"forever": {
+			"route":    component.Route{},
+			"cycles":   100,
+			"now":      until,
+			"finished": false,
+			"reason":   "",
+		},
+		"cycles left": {
+			"route":    component.Route{Cycles: 10},
+			"cycles":   9,
+			"now":      until,
+			"finished": false,
+			"reason":   "",
+		},
+		"cycles completed": {
+			"route":    component.Route{Cycles: 10},
+			"cycles":   10,
+			"now":      until,
+			"finished": true,
+			"reason":   "10 cycles completed",
+		},
+		"before until": {
+			"route":    component.Route{Until: until},
+			"cycles":   1,
+			"now":      until.Add(-time.Second),
+			"finished": false,
+			"reason":   "",
+		},
+		"past until": {
+			"route":    component.Route{Until: until},
+			"cycles":   1,
+			"now":      until,
+			"finished": true,
+			"reason":   "past 2022-07-01T12:00:00Z",
+		},
+	}
+
+	for name, uc := range useCases {
+		t.Run(name, func(t *testing.T) {
+			route := uc["route"].(component.Route)
+			finished, reason := route.Finished(uc["cycles"].(int), uc["now"].(time.Time))
+			if finished != uc["finished"].(bool) || reason != uc["reason"].(string) {
+				t.Fatalf("\nACTUAL: %t %q\nEXPECT: %t %q\n", finished, reason, uc["finished"], uc["reason"])
+			}
+		})
+	}
+}
+
+func TestRouteNextWindow(t *testing.T) {
+	day := time.Date(2022, 7, 1, 0, 0, 0, 0, time.UTC)
+	office := []component.TimeWindow{{From: "08:00", To: "18:00"}}
+	night := []component.TimeWindow{{From: "22:00", To: "06:00"}}
+
+	useCases := map[string]map[string]interface{}{
+		"no windows": {
+			"route":    component.Route{},
+			"now":      day.Add(3 * time.Hour),
+			"expected": day.Add(3 * time.Hour),
+		},
+		"inside": {
+			"route":    component.Route{Windows: office},
+			"now":      day.Add(9 * time.Hour),
+			"expected": day.Add(9 * time.Hour),
+		},
+		"before": {
+			"route":    component.Route{Windows: office},
+			"now":      day.Add(7 * time.Hour),
+			"expected": day.Add(8 * time.Hour),
+		},
+		"after": {
+			"route":    component.Route{Windows: office},
+			"now":      day.Add(18 * time.Hour),
+			"expected": day.Add(32 * time.Hour),
+		},
+		"overnight, inside after midnight": {
+			"route":    component.Route{Windows: night},
+			"now":      day.Add(5 * time.Hour),
+			"expected": day.Add(5 * time.Hour),
+		},
+		"overnight, outside": {
+			"route":    component.Route{Windows: night},
+			"now":      day.Add(12 * time.Hour),
+			"expected": day.Add(22 * time.Hour),
+		},
+		"earliest of many": {
+			"route":    component.Route{Windows: append(append([]component.TimeWindow{}, night...), office...)},
+			"now":      day.Add(7 * time.Hour),
+			"expected": day.Add(8 * time.Hour),
+		},
+		"limited by until": {
+			"route":    component.Route{Windows: office, Until: day.Add(20 * time.Hour)},
+			"now":      day.Add(19 * time.Hour),
+			"expected": day.Add(20 * time.Hour),
+		},
+	}
+
+	for name, uc := range useCases {
+		t.Run(name, func(t *testing.T) {
+			route := uc["route"].(component.Route)
+			actual := route.NextWindow(uc["now"].(time.Time))
+			if !actual.Equal(uc["expected"].(time.Time)) {
+				t.Fatalf("\nACTUAL: %v\nEXPECT: %v\n", actual, uc["expected"])
+			}
+		})
+	}
+}
+
+func TestRouteNextRouteFile(t *testing.T) {
+	useCases := map[string]map[string]interface{}{
+		"none":     {"then": "", "expected": ""},
+		"relative": {"then": "route_b.yml", "expected": "etc/routes/route_b.yml"},
+		"absolute": {"then": "/routes/route_b.yml", "expected": "/routes/route_b.yml"},
+	}
+
+	for name, uc := range useCases {
+		t.Run(name, func(t *testing.T) {
+			route := component.Route{Then: uc["then"].(string)}
+			if actual := route.NextRouteFile("etc/routes/route_a.yml"); actual != uc["expected"].(string) {
+				t.Fatalf("\nACTUAL: %s\nEXPECT: %s\n", actual, uc["expected"])
+			}
+		})
+	}
+}
@@ -3,13 +3,12 @@ package component
 import (
 	"bytes"
 	"context"
-	"fmt"
-	"log"
-	"regexp"
-	"strconv"
+	"errors"
 	"time"
 
+	"github.com/otaviokr/spacetraders-ship/gameerror"
 	"github.com/otaviokr/spacetraders-ship/kafka"
+	"github.com/otaviokr/spacetraders-ship/logging"
 	"github.com/otaviokr/spacetraders-ship/web"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
@@ -22,6 +21,12 @@ type Ship struct {
 	tracer trace.Tracer
 	// webProxy web.Proxy
 	webProxy kafka.Proxy
+	// dryRun is set when the orders are only recorded (see DryRun), so nothing is reported nor waited for.
+	dryRun bool
+	// sleep waits for the flights to finish; replaced in tests.
+	sleep func(time.Duration)
+	// observed is what the ship learned about the stations it visited (see Observations).
+	observed Observations
 	Details  ShipDetails `yaml:"ship"`
 	Error    Error       `yaml:"error"`
 }
@@ -54,23 +59,13 @@ type ShipCargo struct {
 
 // NewShip creates a new instance of component.Ship.
 // func NewShip(ctx context.Context, tracer trace.Tracer, id, token string) (*Ship, error) {
-func NewShip(
-	ctx context.Context, tracer trace.Tracer,
-	id, connectionType, connectionString,
-	topicRead string, partitionRead int,
-	topicWrite string, partitionWrite int) (*Ship, error) {
+func NewShip(ctx context.Context, tracer trace.Tracer, id string, config kafka.Config) (*Ship, error) {
 	// return NewShipCustomProxy(ctx, tracer, web.NewWebProxy(id, token), id, token)
-	return NewShipCustomProxy(ctx, tracer,
-		kafka.NewKafkaProxy(
-			ctx,
-			id,
-			connectionType,
-			connectionString,
-			topicRead,
-			partitionRead,
-			topicWrite,
-			partitionWrite),
-		id)
+	proxy, err := kafka.NewKafkaProxy(ctx, id, config)
+	if err != nil {
+		return nil, err
+	}
+	return NewShipCustomProxy(ctx, tracer, proxy, id)
 }
 
 // NewShipCustomProxy creates a new instance of component.Ship, using a provided custom web.WebProxy.
@@ -81,6 +76,7 @@ func NewShipCustomProxy(ctx context.Context, tracer trace.Tracer, proxy kafka.Pr
 	ship := Ship{
 		tracer:   tracer,
 		webProxy: proxy,
+		sleep:    time.Sleep,
 		Details: ShipDetails{
 			Id: id}}
 	if err := ship.GetDetails(shipCtx); err != nil {
@@ -93,20 +89,20 @@ func NewShipCustomProxy(ctx context.Context, tracer trace.Tracer, proxy kafka.Pr
 
 // GetDetails will get the ship details from the game.
 func (s *Ship) GetDetails(ctx context.Context) error {
-	_, span := s.tracer.Start(
+	detailsCtx, span := s.tracer.Start(
 		ctx,
 		"Get Ship Details",
 		trace.WithAttributes(
 			attribute.Key("ship.id").String(s.Details.Id)))
 	defer span.End()
 
-	log.Println("Getting ship details...")
-	data, err := s.webProxy.GetShipInfo()
+	logging.Debug(detailsCtx, "Getting the ship details")
+	data, err := s.webProxy.GetShipInfo(detailsCtx)
 	if err != nil {
 		span.RecordError(err)
 		span.SetAttributes(attribute.Key("data").String(string(data)))
 		span.SetStatus(codes.Error, err.Error())
-		log.Println("could not get response:", err)
+		logging.Error(detailsCtx, "Could not get the ship details", "error", err)
 		return err
 	} else {
 		s.Error.Code = -1
@@ -117,18 +113,18 @@ func (s *Ship) GetDetails(ctx context.Context) error {
 	if err = decoder.Decode(&s); err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
-		log.Println("could not decode response:", err)
+		logging.Error(detailsCtx, "Could not decode the ship details", "error", err)
 		return err
 	}
 
-	if len(s.Error.Message) > 0 {
+	if err = s.Error.Err(); err != nil {
 		// Error from the server, we should still report it.
-		err = fmt.Errorf("ERROR FROM SERVER (%d): %s", s.Error.Code, s.Error.Message)
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
 		return err
 	}
 
+	s.observed.observeLocation(s.Details, time.Now())
 	return nil
 }
 
@@ -143,6 +139,13 @@ func (s *Ship) Fly(ctx context.Context, destination string) error {
 	defer flySpan.End()
 
 	flightPlan, err := s.NewFlightPlan(flyCtx, destination)
+	if errors.Is(err, gameerror.ErrShipInTransit) {
+		// The ship is still flying somewhere else, so we wait for it to land before trying again.
+		flySpan.AddEvent("Ship already in transit")
+		if err = s.waitArrival(flyCtx); err == nil {
+			flightPlan, err = s.NewFlightPlan(flyCtx, destination)
+		}
+	}
 	if err != nil {
 		flySpan.RecordError(err)
 		flySpan.SetStatus(codes.Error, err.Error())
@@ -158,44 +161,60 @@ func (s *Ship) Fly(ctx context.Context, destination string) error {
 			attribute.Key("flightplan.destination").String(flightPlan.Details.Destination),
 			attribute.Key("flightplan.fuel.consumed").Int(flightPlan.Details.FuelConsumed),
 			attribute.Key("flightplan.distance").Int(flightPlan.Details.Distance)))
-	web.FuelConsumed.WithLabelValues(s.Details.Id).Add(float64(flightPlan.Details.FuelConsumed))
+	if !s.dryRun {
+		web.FuelConsumed.WithLabelValues(s.Details.Id).Add(float64(flightPlan.Details.FuelConsumed))
+	}
+	s.observed.observeFlight(s.Details, flightPlan.Details)
 
-	log.Printf("Flight Plan defined to %s in %ds (%+v)\n",
-		flightPlan.Details.Destination,
-		flightPlan.Details.TimeRemainingInSeconds,
-		flightPlan.Details.ArrivesAt)
+	logging.Info(flyCtx, "Flight plan defined",
+		"flight_plan_id", flightPlan.Details.Id,
+		"destination", flightPlan.Details.Destination,
+		"remaining_seconds", flightPlan.Details.TimeRemainingInSeconds,
+		"arrives_at", flightPlan.Details.ArrivesAt)
 
-	time.Sleep(time.Duration(flightPlan.Details.TimeRemainingInSeconds+5) * time.Second)
+	if !s.dryRun {
+		s.sleep(time.Duration(flightPlan.Details.TimeRemainingInSeconds+5) * time.Second)
+	}
 
 	flySpan.AddEvent("Check flight status")
-	err = s.GetDetails(flyCtx)
-	if err != nil {
+	if err = s.waitArrival(flyCtx); err != nil {
 		flySpan.RecordError(err)
 		flySpan.SetStatus(codes.Error, err.Error())
 		return err
 	}
 
+	return nil
+}
+
+// waitArrival blocks until the ship has no active flight plan anymore.
+func (s *Ship) waitArrival(ctx context.Context) error {
+	span := trace.SpanFromContext(ctx)
+
+	err := s.GetDetails(ctx)
+	if err != nil {
+		return err
+	}
+
 	for len(s.Details.FlightPlanId) > 0 {
-		flightPlan, err = s.GetFlightPlan(flyCtx)
+		flightPlan, err := s.GetFlightPlan(ctx)
 		if err != nil {
-			flySpan.RecordError(err)
-			flySpan.SetStatus(codes.Error, err.Error())
 			return err
 		}
+		if flightPlan == nil {
+			// The flight plan finished between the two requests.
+			break
+		}
 
-		flySpan.AddEvent(
+		span.AddEvent(
 			"Extending flight time",
 			trace.WithAttributes(
 				attribute.Key("flightplan.id").String(flightPlan.Details.Id),
 				attribute.Key("flightplan.remaining").Int(flightPlan.Details.TimeRemainingInSeconds),
 				attribute.Key("flightplan.destination").String(flightPlan.Details.Destination)))
-		time.Sleep(time.Duration(flightPlan.Details.TimeRemainingInSeconds) * time.Second)
+		s.sleep(time.Duration(flightPlan.Details.TimeRemainingInSeconds) * time.Second)
 
-		flySpan.AddEvent("Update flight status")
-		err = s.GetDetails(flyCtx)
-		if err != nil {
-			flySpan.RecordError(err)
-			flySpan.SetStatus(codes.Error, err.Error())
+		span.AddEvent("Update flight status")
+		if err = s.GetDetails(ctx); err != nil {
 			return err
 		}
 	}
@@ -212,7 +231,7 @@ func (s *Ship) NewFlightPlan(ctx context.Context, destination string) (*FlightPl
 			attribute.Key("destination").String(destination)))
 	defer span.End()
 
-	data, err := s.webProxy.SetNewFlightPlan(destination)
+	data, err := s.webProxy.SetNewFlightPlan(newCtx, destination)
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
@@ -227,32 +246,22 @@ func (s *Ship) NewFlightPlan(ctx context.Context, destination string) (*FlightPl
 		return nil, err
 	}
 
-	if fp.Error.Code > 0 {
-		re := regexp.MustCompile(InsufficientFuelRegex)
-		found := re.FindAllStringSubmatch(fp.Error.Message, 1)
-		if found == nil {
-			err = fmt.Errorf("UNEXPECTED ERROR (%d): %s", fp.Error.Code, fp.Error.Message)
-			log.Println(err.Error())
-			span.RecordError(err)
-		} else {
-			fuel, err := strconv.Atoi(found[0][1])
-			if err != nil {
-				span.RecordError(err)
-				span.SetStatus(codes.Error, err.Error())
-				return nil, err
-			}
-
-			// Error from the server, we should still report it.
-			err = fmt.Errorf("ERROR FROM SERVER (%d): %s", fp.Error.Code, fp.Error.Message)
+	if err = fp.Error.Err(); err != nil {
+		// Error from the server, we should still report it.
+		span.RecordError(err)
+
+		fuel, ok := gameerror.RequiredFuel(err)
+		if !ok {
+			logging.Error(newCtx, "Could not define the flight plan", "destination", destination, "error", err)
+			span.SetStatus(codes.Error, err.Error())
+			return nil, err
+		}
+
+		err = s.ForceBuyFuel(newCtx, fuel)
+		if err != nil {
 			span.RecordError(err)
-			// span.SetStatus(codes.Error, err.Error())
-
-			err = s.ForceBuyFuel(newCtx, fuel)
-			if err != nil {
-				span.RecordError(err)
-				span.SetStatus(codes.Error, err.Error())
-				return nil, err
-			}
+			span.SetStatus(codes.Error, err.Error())
+			return nil, err
 		}
 
 		return s.NewFlightPlan(newCtx, destination)
@@ -273,8 +282,8 @@ func (s *Ship) GetFlightPlan(ctx context.Context) (*FlightPlan, error) {
 		return nil, nil
 	}
 
-	log.Printf("Flight Plan found: %s\n", s.Details.FlightPlanId)
-	data, err := s.webProxy.GetFlightPlan(s.Details.FlightPlanId)
+	logging.Debug(ctx, "Flight plan found", "flight_plan_id", s.Details.FlightPlanId)
+	data, err := s.webProxy.GetFlightPlan(ctx, s.Details.FlightPlanId)
 	if err != nil {
 		return nil, err
 	}
@@ -284,9 +293,8 @@ func (s *Ship) GetFlightPlan(ctx context.Context) (*FlightPlan, error) {
 		return nil, err
 	}
 
-	if len(fp.Error.Message) > 0 {
+	if err = fp.Error.Err(); err != nil {
 		// Error from the server, we should still report it.
-		err = fmt.Errorf("ERROR FROM SERVER (%d): %s", fp.Error.Code, fp.Error.Message)
 		return nil, err
 	}
 
@@ -6,6 +6,7 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/otaviokr/spacetraders-ship/component"
@@ -43,7 +44,7 @@ func TestNewShip(t *testing.T) {
 	proxy := mocks.NewMockProxy(ctrl)
 
 	for _, uc := range useCases {
-		proxy.EXPECT().GetShipInfo().Return([]byte(fmt.Sprintf("%v", uc["detailsResponse"])), nil)
+		proxy.EXPECT().GetShipInfo(gomock.Any()).Return([]byte(fmt.Sprintf("%v", uc["detailsResponse"])), nil)
 		actual, err := component.NewShipCustomProxy(
 			context.TODO(),
 			trace.NewNoopTracerProvider().Tracer(""),
@@ -70,7 +71,7 @@ func TestNewShipFailed(t *testing.T) {
 
 	proxy := mocks.NewMockProxy(ctrl)
 
-	proxy.EXPECT().GetShipInfo().Return(nil, fmt.Errorf(errorMessage))
+	proxy.EXPECT().GetShipInfo(gomock.Any()).Return(nil, fmt.Errorf(errorMessage))
 	_, err := component.NewShipCustomProxy(
 		context.TODO(),
 		trace.NewNoopTracerProvider().Tracer(""),
@@ -91,8 +92,8 @@ func TestNewShipFailed(t *testing.T) {
 // 	proxy := mocks.NewMockProxy(ctrl)
 
 // 	for _, uc := range useCases {
-// 		proxy.EXPECT().GetShipInfo().Return([]byte(fmt.Sprintf("%v", uc["detailsResponse"])), nil)
-// 		proxy.EXPECT().GetShipInfo().Return([]byte(fmt.Sprintf("%v", uc["detailsResponse"])), nil)
+// 		proxy.EXPECT().GetShipInfo(gomock.Any()).Return([]byte(fmt.Sprintf("%v", uc["detailsResponse"])), nil)
+// 		proxy.EXPECT().GetShipInfo(gomock.Any()).Return([]byte(fmt.Sprintf("%v", uc["detailsResponse"])), nil)
 // 		proxy.EXPECT().
 // 			GetMarketplaceProducts(fmt.Sprintf("%v", uc["location"])).
 // 			Return([]byte(fmt.Sprintf("%v", uc["marketResponse"])), nil)
@@ -155,9 +156,9 @@ func TestFly(t *testing.T) {
 	proxy := mocks.NewMockProxy(ctrl)
 
 	for _, uc := range useCases {
-		proxy.EXPECT().GetShipInfo().Return([]byte(fmt.Sprintf("%v", uc["detailsResponse"])), nil)
-		proxy.EXPECT().GetShipInfo().Return([]byte(fmt.Sprintf("%v", uc["detailsResponse"])), nil)
-		proxy.EXPECT().SetNewFlightPlan(
+		proxy.EXPECT().GetShipInfo(gomock.Any()).Return([]byte(fmt.Sprintf("%v", uc["detailsResponse"])), nil)
+		proxy.EXPECT().GetShipInfo(gomock.Any()).Return([]byte(fmt.Sprintf("%v", uc["detailsResponse"])), nil)
+		proxy.EXPECT().SetNewFlightPlan(gomock.Any(),
 			fmt.Sprintf("%v", uc["destination"])).Return([]byte(fmt.Sprintf("%v", uc["flightPlanResponse"])),
 			nil)
 		ship, err := component.NewShipCustomProxy(
@@ -174,6 +175,13 @@ func TestFly(t *testing.T) {
 			t.Log(err)
 			t.Fail()
 		}
+
+		flights := ship.Observations().Flights
+		expected := component.ObservedFlight{Departure: "OE-PM-TR", Destination: "OE-PM", ShipType: "GR-MK-II",
+			Speed: 1, Distance: 1, Fuel: 1, Duration: 61960 * time.Millisecond}
+		if len(flights) != 1 || flights[0] != expected {
+			t.Fatalf("\nACTUAL: %+v\nEXPECT: %+v\n", flights, expected)
+		}
 	}
 }
 
@@ -208,9 +216,9 @@ func TestNewFlightPlan(t *testing.T) {
 	proxy := mocks.NewMockProxy(ctrl)
 
 	for _, uc := range useCases {
-		proxy.EXPECT().GetShipInfo().Return([]byte(fmt.Sprintf("%v", uc["detailsResponse"])), nil)
-		// proxy.EXPECT().GetShipInfo().Return([]byte(fmt.Sprintf("%v", uc["detailsResponse"])), nil)
-		proxy.EXPECT().SetNewFlightPlan(
+		proxy.EXPECT().GetShipInfo(gomock.Any()).Return([]byte(fmt.Sprintf("%v", uc["detailsResponse"])), nil)
+		// proxy.EXPECT().GetShipInfo(gomock.Any()).Return([]byte(fmt.Sprintf("%v", uc["detailsResponse"])), nil)
+		proxy.EXPECT().SetNewFlightPlan(gomock.Any(),
 			fmt.Sprintf("%v", uc["destination"])).Return([]byte(fmt.Sprintf("%v", uc["flightPlanResponse"])),
 			nil)
 		ship, err := component.NewShipCustomProxy(
@@ -265,9 +273,9 @@ func TestGetFlightPlan(t *testing.T) {
 	proxy := mocks.NewMockProxy(ctrl)
 
 	for _, uc := range useCases {
-		proxy.EXPECT().GetShipInfo().Return([]byte(fmt.Sprintf("%v", uc["detailsResponse"])), nil)
-		proxy.EXPECT().GetShipInfo().Return([]byte(fmt.Sprintf("%v", uc["detailsResponse"])), nil)
-		proxy.EXPECT().GetFlightPlan(fmt.Sprintf("%v", uc["flightPlanId"])).
+		proxy.EXPECT().GetShipInfo(gomock.Any()).Return([]byte(fmt.Sprintf("%v", uc["detailsResponse"])), nil)
+		proxy.EXPECT().GetShipInfo(gomock.Any()).Return([]byte(fmt.Sprintf("%v", uc["detailsResponse"])), nil)
+		proxy.EXPECT().GetFlightPlan(gomock.Any(), fmt.Sprintf("%v", uc["flightPlanId"])).
 			Return([]byte(fmt.Sprintf("%v", uc["flightPlanResponse"])), nil)
 		ship, err := component.NewShipCustomProxy(
 			context.TODO(),
@@ -337,9 +345,9 @@ func TestShipSell(t *testing.T) {
 	proxy := mocks.NewMockProxy(ctrl)
 
 	for _, uc := range useCases {
-		proxy.EXPECT().GetShipInfo().Return([]byte(fmt.Sprintf("%v", uc["detailsResponse"])), nil)
-		// proxy.EXPECT().GetShipInfo().Return([]byte(fmt.Sprintf("%v", uc["detailsResponse"])), nil)
-		proxy.EXPECT().SellGood(fmt.Sprintf("%v", uc["good"]), uc["quantity"].(int)).
+		proxy.EXPECT().GetShipInfo(gomock.Any()).Return([]byte(fmt.Sprintf("%v", uc["detailsResponse"])), nil)
+		// proxy.EXPECT().GetShipInfo(gomock.Any()).Return([]byte(fmt.Sprintf("%v", uc["detailsResponse"])), nil)
+		proxy.EXPECT().SellGood(gomock.Any(), fmt.Sprintf("%v", uc["good"]), uc["quantity"].(int)).
 			Return([]byte(fmt.Sprintf("%v", uc["sellGoodResponse"])), nil)
 		ship, err := component.NewShipCustomProxy(
 			context.TODO(),
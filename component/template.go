@@ -0,0 +1,218 @@
+package component
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// routeTemplate is what a route file can have besides the route itself:
+//   - include lists other files (relative to this one) whose variables and segments can be used here;
+//   - vars are the values replacing ${name} anywhere in the route and in the segments, overriding the included ones;
+//   - segments are named lists of stops, used in the route with a stop like {segment: name}.
+type routeTemplate struct {
+	Include  []string             `yaml:"include"`
+	Vars     map[string]string    `yaml:"vars"`
+	Segments map[string]yaml.Node `yaml:"segments"`
+}
+
+// variablePattern matches a variable in a value, like ${cargo}.
+var variablePattern = regexp.MustCompile(`\$\{([A-Za-z0-9_.-]+)\}`)
+
+// routeLoader reads a route file with everything it includes. The variables are only replaced once all the files are
+// read, so a segment in an included file uses the values of the file including it.
+type routeLoader struct {
+	readFile func(path string) ([]byte, error)
+	vars     map[string]string
+	segments map[string]*yaml.Node
+	// including are the files being read, to find the ones including themselves.
+	including []string
+}
+
+// loadRoute reads the route in data, whose includes are relative to dir, reading them with readFile.
+func loadRoute(data []byte, dir string, readFile func(path string) ([]byte, error)) (*Route, error) {
+	loader := &routeLoader{
+		readFile: readFile,
+		vars:     map[string]string{},
+		segments: map[string]*yaml.Node{},
+	}
+
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+	if document.Kind == 0 {
+		// Nothing to read, as the YAML decoder tells it.
+		return nil, io.EOF
+	}
+	if err := loader.merge(&document, dir); err != nil {
+		return nil, err
+	}
+
+	if err := loader.substitute(&document); err != nil {
+		return nil, err
+	}
+	var route Route
+	if err := document.Decode(&route); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if route.Route, err = loader.expand(route.Route, nil); err != nil {
+		return nil, err
+	}
+	for i, candidate := range route.Candidates {
+		if route.Candidates[i].Route, err = loader.expand(candidate.Route, nil); err != nil {
+			return nil, fmt.Errorf("candidate %s: %w", candidate.Name, err)
+		}
+	}
+	return &route, nil
+}
+
+// merge adds the variables and segments of the document, after the ones of the files it includes.
+func (l *routeLoader) merge(document *yaml.Node, dir string) error {
+	var template routeTemplate
+	if err := document.Decode(&template); err != nil {
+		return err
+	}
+
+	for _, include := range template.Include {
+		path := include
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, include)
+		}
+		for _, including := range l.including {
+			if including == path {
+				return fmt.Errorf("include %s: included by itself (through %s)", include, strings.Join(l.including, ", "))
+			}
+		}
+
+		data, err := l.readFile(path)
+		if err != nil {
+			return fmt.Errorf("include %s: %w", include, err)
+		}
+		var included yaml.Node
+		if err = yaml.Unmarshal(data, &included); err != nil {
+			return fmt.Errorf("include %s: %w", include, err)
+		}
+		if included.Kind == 0 {
+			continue
+		}
+
+		l.including = append(l.including, path)
+		err = l.merge(&included, filepath.Dir(path))
+		l.including = l.including[:len(l.including)-1]
+		if err != nil {
+			return fmt.Errorf("include %s: %w", include, err)
+		}
+	}
+
+	for name, value := range template.Vars {
+		l.vars[name] = value
+	}
+	for name, segment := range template.Segments {
+		segment := segment
+		l.segments[name] = &segment
+	}
+	return nil
+}
+
+// substitute replaces the variables in all the values of the node, failing if any of them is not defined.
+func (l *routeLoader) substitute(node *yaml.Node) error {
+	missing := map[string]bool{}
+	l.walk(node, missing)
+	if len(missing) < 1 {
+		return nil
+	}
+
+	names := make([]string, 0, len(missing))
+	for name := range missing {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return fmt.Errorf("undefined variables: %s", strings.Join(names, ", "))
+}
+
+func (l *routeLoader) walk(node *yaml.Node, missing map[string]bool) {
+	if node.Kind == yaml.ScalarNode && strings.Contains(node.Value, "${") {
+		node.Value = variablePattern.ReplaceAllStringFunc(node.Value, func(variable string) string {
+			name := variablePattern.FindStringSubmatch(variable)[1]
+			value, ok := l.vars[name]
+			if !ok {
+				missing[name] = true
+				return variable
+			}
+			return value
+		})
+		// The type is found again from the new value, so ${cargo} can be a number.
+		node.Tag = ""
+		node.Style = 0
+	}
+	for _, child := range node.Content {
+		l.walk(child, missing)
+	}
+}
+
+// expand replaces the stops that refer to a segment by the stops of the segment, which can use other segments too.
+func (l *routeLoader) expand(stops []RouteStop, using []string) ([]RouteStop, error) {
+	expanded := make([]RouteStop, 0, len(stops))
+	for i, stop := range stops {
+		if len(stop.Segment) < 1 {
+			expanded = append(expanded, stop)
+			continue
+		}
+		if len(stop.Station) > 0 || len(stop.Buy) > 0 || len(stop.Sell) > 0 || stop.When != nil {
+			return nil, fmt.Errorf("stop %d: segment %s cannot have a station, buy, sell or when", i+1, stop.Segment)
+		}
+		for _, name := range using {
+			if name == stop.Segment {
+				return nil, fmt.Errorf("segment %s uses itself", stop.Segment)
+			}
+		}
+
+		node, ok := l.segments[stop.Segment]
+		if !ok {
+			return nil, fmt.Errorf("stop %d: unknown segment %s", i+1, stop.Segment)
+		}
+		// The node is shared by every use of the segment, so it is substituted on a copy.
+		copied := copyNode(node)
+		if err := l.substitute(copied); err != nil {
+			return nil, fmt.Errorf("segment %s: %w", stop.Segment, err)
+		}
+		var segment []RouteStop
+		if err := copied.Decode(&segment); err != nil {
+			return nil, fmt.Errorf("segment %s: %w", stop.Segment, err)
+		}
+
+		segment, err := l.expand(segment, append(using, stop.Segment))
+		if err != nil {
+			return nil, fmt.Errorf("segment %s: %w", stop.Segment, err)
+		}
+		expanded = append(expanded, segment...)
+	}
+	return expanded, nil
+}
+
+// copyNode returns a deep copy of the node.
+func copyNode(node *yaml.Node) *yaml.Node {
+	copied := *node
+	copied.Content = make([]*yaml.Node, len(node.Content))
+	for i, child := range node.Content {
+		copied.Content[i] = copyNode(child)
+	}
+	return &copied
+}
+
+// readRouteFile reads the route file with readFile, including the other files relative to its directory.
+func readRouteFile(path string, readFile func(path string) ([]byte, error)) (*Route, error) {
+	data, err := readFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return loadRoute(data, filepath.Dir(path), readFile)
+}
@@ -0,0 +1,137 @@
+package component_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/otaviokr/spacetraders-ship/component"
+)
+
+func TestReadRouteTemplate(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"common/refuel.yml": "vars:\n  reserve: 20\nsegments:\n  refuel:\n    - station: OE-PM-TR\n      buy:\n        FUEL: ${reserve}\n",
+		"common/all.yml":    "include:\n  - refuel.yml\nsegments:\n  loop:\n    - segment: refuel\n    - station: OE-PM\n",
+		"self.yml":          "include:\n  - self.yml\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	useCases := map[string]map[string]interface{}{
+		"variables": {
+			"yaml": "vars:\n  cargo: 300\n  good: DRONES\nroute:\n  - station: OE-PM\n    buy:\n      ${good}: ${cargo}",
+			"expected": []component.RouteStop{
+				{Station: "OE-PM", Buy: map[string]int{"DRONES": 300}}},
+		},
+		"segments": {
+			"yaml": "segments:\n  sell:\n    - station: OE-CR\n      sell:\n        DRONES: -1\n" +
+				"route:\n  - station: OE-PM\n  - segment: sell\n  - station: OE-KO\n  - segment: sell",
+			"expected": []component.RouteStop{
+				{Station: "OE-PM"},
+				{Station: "OE-CR", Sell: map[string]int{"DRONES": -1}},
+				{Station: "OE-KO"},
+				{Station: "OE-CR", Sell: map[string]int{"DRONES": -1}}},
+		},
+		"includes": {
+			"yaml": "include:\n  - common/all.yml\nvars:\n  reserve: 35\nroute:\n  - segment: loop\n  - station: OE-CR",
+			"expected": []component.RouteStop{
+				{Station: "OE-PM-TR", Buy: map[string]int{"FUEL": 35}},
+				{Station: "OE-PM"},
+				{Station: "OE-CR"}},
+		},
+		"included variables": {
+			"yaml": "include:\n  - common/refuel.yml\nroute:\n  - segment: refuel",
+			"expected": []component.RouteStop{
+				{Station: "OE-PM-TR", Buy: map[string]int{"FUEL": 20}}},
+		},
+		"candidates": {
+			"yaml": "include:\n  - common/refuel.yml\ncandidates:\n  - name: a\n    route:\n      - segment: refuel",
+			"expected": []component.RouteStop{
+				{Station: "OE-PM-TR", Buy: map[string]int{"FUEL": 20}}},
+		},
+		"undefined variables": {
+			"yaml":  "route:\n  - station: ${here}\n    buy:\n      FUEL: ${fuel}",
+			"error": "undefined variables: fuel, here",
+		},
+		"unknown segment": {
+			"yaml":  "route:\n  - station: OE-PM\n  - segment: refuel",
+			"error": "stop 2: unknown segment refuel",
+		},
+		"segment with station": {
+			"yaml":  "segments:\n  a:\n    - station: OE-PM\nroute:\n  - segment: a\n    station: OE-CR",
+			"error": "stop 1: segment a cannot have a station, buy, sell or when",
+		},
+		"segment using itself": {
+			"yaml":  "segments:\n  a:\n    - segment: b\n  b:\n    - segment: a\nroute:\n  - segment: a",
+			"error": "segment a: segment b: segment a uses itself",
+		},
+		"missing include": {
+			"yaml":  "include:\n  - missing.yml\nroute:\n  - station: OE-PM",
+			"error": "include missing.yml: open " + filepath.Join(dir, "missing.yml"),
+		},
+		"include itself": {
+			"yaml":  "include:\n  - self.yml\nroute:\n  - station: OE-PM",
+			"error": "include self.yml: include self.yml: included by itself",
+		},
+	}
+
+	for name, uc := range useCases {
+		path := filepath.Join(dir, "route.yml")
+		if err := os.WriteFile(path, []byte(uc["yaml"].(string)), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		route, err := component.ReadRouteFile(path)
+		if expected, ok := uc["error"]; ok {
+			if err == nil || !strings.HasPrefix(err.Error(), expected.(string)) {
+				t.Fatalf("\nACTUAL: %s: %v\nEXPECT: %s\n", name, err, expected)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("\nACTUAL: %s: %v\nEXPECT: no error\n", name, err)
+		}
+
+		stops := route.Route
+		if len(route.Candidates) > 0 {
+			stops = route.Candidates[0].Route
+		}
+		if !reflect.DeepEqual(stops, uc["expected"]) {
+			t.Fatalf("\nACTUAL: %s: %+v\nEXPECT: %+v\n", name, stops, uc["expected"])
+		}
+	}
+}
+
+func TestRouteWatcherIncludes(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("common.yml", "vars:\n  station: OE-PM\n")
+	write("route.yml", "include:\n  - common.yml\nroute:\n  - station: ${station}\n")
+	watcher, err := component.NewRouteWatcher(filepath.Join(dir, "route.yml"), nil)
+	if err != nil {
+		t.Fatalf("\nACTUAL: %v\nEXPECT: no error\n", err)
+	}
+
+	write("common.yml", "vars:\n  station: OE-CR\n")
+	if applied := watcher.Check(); !applied {
+		t.Fatalf("\nACTUAL: applied %t\nEXPECT: true\n", applied)
+	}
+	if route, version := watcher.Route(); route.Route[0].Station != "OE-CR" || version != 2 {
+		t.Fatalf("\nACTUAL: %s version %d\nEXPECT: OE-CR version 2\n", route.Route[0].Station, version)
+	}
+}
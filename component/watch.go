@@ -0,0 +1,126 @@
+package component
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// When a new version of the route file is applied by the ship.
+const (
+	// ReloadAtStop applies the new route at the next stop, ending the current cycle there.
+	ReloadAtStop = "stop"
+	// ReloadAtCycle applies the new route when the current cycle is finished.
+	ReloadAtCycle = "cycle"
+)
+
+// RouteWatcher keeps the last valid version of a route file, checking the file for changes. A change that cannot be
+// read or is not valid is reported, and the last valid version is kept, so a mistake in the file never stops the ship.
+type RouteWatcher struct {
+	path string
+	// changed is called once for each change of the file: with the new route, or with the error if it is not valid.
+	changed func(route *Route, err error)
+
+	mu      sync.Mutex
+	route   *Route
+	version int
+	// checksum is of the last content read, valid or not, so the same mistake is only reported once.
+	checksum [sha256.Size]byte
+}
+
+// NewRouteWatcher reads the route file, failing if it is not valid, since there is no previous version to keep.
+func NewRouteWatcher(path string, changed func(route *Route, err error)) (*RouteWatcher, error) {
+	route, checksum, err := parseRoute(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return &RouteWatcher{
+		path:     path,
+		changed:  changed,
+		route:    route,
+		version:  1,
+		checksum: checksum,
+	}, nil
+}
+
+// parseRoute reads and validates the route, with the checksum of every file read, the included ones too, and of the
+// errors reading them.
+func parseRoute(path string) (*Route, [sha256.Size]byte, error) {
+	hash := sha256.New()
+	route, err := readRouteFile(path, func(path string) ([]byte, error) {
+		data, err := os.ReadFile(path)
+		hash.Write([]byte(path))
+		hash.Write(data)
+		if err != nil {
+			hash.Write([]byte(err.Error()))
+		}
+		return data, err
+	})
+	if err == nil {
+		err = route.Validate()
+	}
+
+	var checksum [sha256.Size]byte
+	copy(checksum[:], hash.Sum(nil))
+	if err != nil {
+		return nil, checksum, err
+	}
+	return route, checksum, nil
+}
+
+// Path returns the path of the route file.
+func (w *RouteWatcher) Path() string {
+	return w.path
+}
+
+// Route returns the last valid route, and its version, which changes every time a new route is applied.
+func (w *RouteWatcher) Route() (*Route, int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.route, w.version
+}
+
+// Check reads the file now, applying it if it changed and is valid. It tells if a new route was applied. A change in
+// the files it includes counts as a change of the route.
+func (w *RouteWatcher) Check() bool {
+	route, checksum, err := parseRoute(w.path)
+
+	w.mu.Lock()
+	// The same content, or the same error reading it (e.g., a missing file), is only reported once.
+	if checksum == w.checksum {
+		w.mu.Unlock()
+		return false
+	}
+	w.checksum = checksum
+	if err == nil {
+		w.route = route
+		w.version++
+	}
+	w.mu.Unlock()
+
+	if err != nil {
+		err = fmt.Errorf("%s: %w", w.path, err)
+	}
+	if w.changed != nil {
+		w.changed(route, err)
+	}
+	return err == nil
+}
+
+// Watch checks the file every interval, until the context is done.
+func (w *RouteWatcher) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.Check()
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package component_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/otaviokr/spacetraders-ship/component"
+)
+
+func TestRouteWatcher(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "route.yml")
+	write := func(content string) {
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("route:\n  - station: OE-PM\n")
+	var reports []error
+	watcher, err := component.NewRouteWatcher(path, func(route *component.Route, err error) {
+		reports = append(reports, err)
+	})
+	if err != nil {
+		t.Fatalf("\nACTUAL: %v\nEXPECT: no error\n", err)
+	}
+
+	steps := []struct {
+		name    string
+		change  func()
+		applied bool
+		station string
+		version int
+		reports int
+		invalid bool
+	}{
+		{"unchanged", func() {}, false, "OE-PM", 1, 0, false},
+		{"changed", func() { write("route:\n  - station: OE-CR\n") }, true, "OE-CR", 2, 1, false},
+		{"invalid", func() { write("route: []\n") }, false, "OE-CR", 2, 2, true},
+		{"same mistake", func() {}, false, "OE-CR", 2, 2, true},
+		{"removed", func() { os.Remove(path) }, false, "OE-CR", 2, 3, true},
+		{"still removed", func() {}, false, "OE-CR", 2, 3, true},
+		{"fixed", func() { write("route:\n  - station: OE-KO\n") }, true, "OE-KO", 3, 4, false},
+	}
+
+	for _, step := range steps {
+		step.change()
+		if applied := watcher.Check(); applied != step.applied {
+			t.Fatalf("\nACTUAL: %s applied %t\nEXPECT: %t\n", step.name, applied, step.applied)
+		}
+
+		route, version := watcher.Route()
+		if route.Route[0].Station != step.station || version != step.version {
+			t.Fatalf("\nACTUAL: %s %s version %d\nEXPECT: %s version %d\n",
+				step.name, route.Route[0].Station, version, step.station, step.version)
+		}
+		if len(reports) != step.reports {
+			t.Fatalf("\nACTUAL: %s reported %d changes\nEXPECT: %d\n", step.name, len(reports), step.reports)
+		}
+		if step.reports > 0 && (reports[len(reports)-1] != nil) != step.invalid {
+			t.Fatalf("\nACTUAL: %s last report %v\nEXPECT: invalid %t\n", step.name, reports[len(reports)-1], step.invalid)
+		}
+	}
+}
+
+func TestRouteWatcherInvalidAtStart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "route.yml")
+	if err := os.WriteFile(path, []byte("route: []\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := component.NewRouteWatcher(path, nil); err == nil {
+		t.Fatalf("\nACTUAL: no error\nEXPECT: the route has no stops\n")
+	}
+}
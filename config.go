@@ -0,0 +1,24 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// runConfig handles the configuration subcommands. For now, only "print": it shows the effective configuration, with
+// the secrets redacted, and then any problem found in it.
+func runConfig(args []string) error {
+	if len(args) < 1 || args[0] != "print" {
+		return fmt.Errorf("config: unknown subcommand, use \"config print [flags]\"")
+	}
+
+	cfg, err := loadConfig(flag.NewFlagSet("config print", flag.ContinueOnError), args[1:])
+	if err != nil {
+		return err
+	}
+	if err = cfg.Print(os.Stdout); err != nil {
+		return err
+	}
+	return cfg.Validate()
+}
@@ -0,0 +1,281 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/otaviokr/spacetraders-ship/component"
+	"github.com/otaviokr/spacetraders-ship/kafka"
+	"github.com/otaviokr/spacetraders-ship/logging"
+	"github.com/otaviokr/spacetraders-ship/telemetry"
+	"gopkg.in/yaml.v3"
+)
+
+// Redacted replaces the secrets when the configuration is printed.
+const Redacted = "REDACTED"
+
+// Config is everything the ship needs to run. It is loaded from the defaults, then the configuration file, then the
+// environment variables and, finally, the command-line flags; each one overrides the previous ones (see Flags.Load).
+type Config struct {
+	ShipID string `yaml:"shipId"`
+	// Token is the account token. The gateway does the authentication, but the ships sharing a token in this process
+	// share the same rate limit bucket.
+	Token string `yaml:"token"`
+	// RouteFile is the path to the trading route.
+	RouteFile   string `yaml:"routeFile"`
+	MetricsPort string `yaml:"metricsPort"`
+	// DryRun only prints what the ship would do in one cycle of the route.
+	DryRun bool `yaml:"dryRun"`
+	// RecordFile is where every request and response is appended, to be replayed in tests (see kafka.Replay).
+	RecordFile string `yaml:"recordFile"`
+	// LocationsFile is where the locations learned by the ship are kept (see navigation.Registry); if empty, they are
+	// only kept in memory.
+	LocationsFile string `yaml:"locationsFile"`
+
+	RouteReload RouteReloadConfig `yaml:"routeReload"`
+	Log         LogConfig         `yaml:"log"`
+	RateLimit   RateLimitConfig   `yaml:"rateLimit"`
+	Kafka       kafka.Config      `yaml:"kafka"`
+	Retry       kafka.RetryPolicy `yaml:"retry"`
+	Cache       kafka.CacheConfig `yaml:"cache"`
+	Chaos       kafka.ChaosConfig `yaml:"chaos"`
+	Telemetry   telemetry.Config  `yaml:"telemetry"`
+}
+
+// RateLimitConfig is how many requests per second are sent to the game, shared by the ships with the same token.
+type RateLimitConfig struct {
+	Rate  float64 `yaml:"rate"`
+	Burst int     `yaml:"burst"`
+}
+
+// RouteReloadConfig is how often the route file is checked for changes (0 only checks it at the start of each cycle)
+// and when the changes are applied: at the next stop (component.ReloadAtStop) or at the end of the cycle
+// (component.ReloadAtCycle).
+type RouteReloadConfig struct {
+	Interval time.Duration `yaml:"interval"`
+	Apply    string        `yaml:"apply"`
+}
+
+// LogConfig is how the log lines are written: which levels (debug, info, warn or error) and in which format (json or
+// logfmt). The level can also be changed while running, through the admin endpoint.
+type LogConfig struct {
+	Level  string `yaml:"level"`
+	Format string `yaml:"format"`
+	// AdminToken must be sent to change the level at runtime (see logging.LevelVar.Handler); if empty, it cannot be
+	// changed.
+	AdminToken string `yaml:"adminToken"`
+}
+
+// Default returns the configuration used for anything that is not set.
+func Default() Config {
+	return Config{
+		MetricsPort: "9090",
+		RouteReload: RouteReloadConfig{Interval: 10 * time.Second, Apply: component.ReloadAtCycle},
+		Log:         LogConfig{Level: "info", Format: logging.FormatLogfmt},
+		// Space Traders allows 2 requests per second for each token.
+		RateLimit: RateLimitConfig{Rate: 2, Burst: 2},
+		Kafka:     kafka.DefaultConfig(),
+		Retry:     kafka.DefaultRetryPolicy(),
+		Cache:     kafka.DefaultCacheConfig(),
+		Telemetry: telemetry.DefaultConfig(),
+	}
+}
+
+// ReadFile loads the configuration file on top of c. Unknown keys are an error, so typos don't go unnoticed.
+func (c *Config) ReadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err = decoder.Decode(c); err != nil && err != io.EOF {
+		return fmt.Errorf("config: reading %s: %w", path, err)
+	}
+	return nil
+}
+
+// Validate checks the whole configuration, listing every problem found, with where it can be fixed.
+func (c Config) Validate() error {
+	return c.validate(true)
+}
+
+// ValidateWithoutRoute is Validate for the commands that talk to the game, but don't follow the route.
+func (c Config) ValidateWithoutRoute() error {
+	return c.validate(false)
+}
+
+// validate is the implementation of Validate, checking the route file only if needed.
+func (c Config) validate(needsRoute bool) error {
+	var problems []string
+	add := func(key, format string, args ...interface{}) {
+		problem := fmt.Sprintf("%s: %s", key, fmt.Sprintf(format, args...))
+		if s, ok := settingsByKey[key]; ok {
+			problem += fmt.Sprintf(" (set %s, -%s or %s in the configuration file)", s.env, s.flag, key)
+		}
+		problems = append(problems, problem)
+	}
+
+	if len(c.ShipID) < 1 {
+		add("shipId", "required")
+	}
+	if needsRoute && len(c.RouteFile) < 1 {
+		add("routeFile", "required")
+	}
+	if port, err := strconv.Atoi(c.MetricsPort); err != nil || port < 1 || port > 65535 {
+		add("metricsPort", "%q is not a valid port", c.MetricsPort)
+	}
+
+	if c.RouteReload.Interval < 0 {
+		add("routeReload.interval", "must not be negative, got %s (use 0 to disable)", c.RouteReload.Interval)
+	}
+	if c.RouteReload.Apply != component.ReloadAtStop && c.RouteReload.Apply != component.ReloadAtCycle {
+		add("routeReload.apply", "unknown value %q (use %s or %s)",
+			c.RouteReload.Apply, component.ReloadAtStop, component.ReloadAtCycle)
+	}
+
+	if _, err := logging.ParseLevel(c.Log.Level); err != nil {
+		add("log.level", "unknown level %q (use debug, info, warn or error)", c.Log.Level)
+	}
+	if c.Log.Format != logging.FormatJSON && c.Log.Format != logging.FormatLogfmt {
+		add("log.format", "unknown format %q (use %s or %s)", c.Log.Format, logging.FormatJSON, logging.FormatLogfmt)
+	}
+
+	if c.RateLimit.Rate < 0 {
+		add("rateLimit.rate", "must not be negative, got %v (use 0 to disable)", c.RateLimit.Rate)
+	}
+	if c.RateLimit.Burst < 1 {
+		add("rateLimit.burst", "must be at least 1, got %d", c.RateLimit.Burst)
+	}
+
+	if len(c.Kafka.Brokers) < 1 {
+		add("kafka.brokers", "at least one broker is required")
+	}
+	if len(c.Kafka.TopicRead) < 1 {
+		add("kafka.topicRead", "required")
+	}
+	if len(c.Kafka.TopicWrite) < 1 {
+		add("kafka.topicWrite", "required")
+	}
+	if c.Kafka.PartitionRead < kafka.AutomaticPartition {
+		add("kafka.partitionRead", "must be %d (automatic) or a partition, got %d",
+			kafka.AutomaticPartition, c.Kafka.PartitionRead)
+	}
+	if c.Kafka.PartitionWrite < kafka.AutomaticPartition {
+		add("kafka.partitionWrite", "must be %d (automatic) or a partition, got %d",
+			kafka.AutomaticPartition, c.Kafka.PartitionWrite)
+	}
+	if c.Kafka.ReplyTimeout < 0 {
+		add("kafka.replyTimeout", "must not be negative, got %s", c.Kafka.ReplyTimeout)
+	}
+	tls := c.Kafka.TLS
+	if !tls.Enabled && (len(tls.CAFile) > 0 || len(tls.CertFile) > 0 || len(tls.KeyFile) > 0) {
+		add("kafka.tls.enabled", "certificate files are set, but tls is not enabled")
+	}
+	switch strings.ToUpper(c.Kafka.SASL.Mechanism) {
+	case "":
+		if len(c.Kafka.SASL.Username) > 0 || len(c.Kafka.SASL.Password) > 0 {
+			add("kafka.sasl.mechanism", "required when the credentials are set")
+		}
+	case kafka.SASLPlain, kafka.SASLScramSHA256, kafka.SASLScramSHA512:
+		if len(c.Kafka.SASL.Username) < 1 || len(c.Kafka.SASL.Password) < 1 {
+			add("kafka.sasl.username", "username and password are required for %s", c.Kafka.SASL.Mechanism)
+		}
+	default:
+		add("kafka.sasl.mechanism", "unknown mechanism %q (use %s, %s or %s)",
+			c.Kafka.SASL.Mechanism, kafka.SASLPlain, kafka.SASLScramSHA256, kafka.SASLScramSHA512)
+	}
+
+	if c.Retry.MaxAttempts < 1 {
+		add("retry.maxAttempts", "must be at least 1, got %d", c.Retry.MaxAttempts)
+	}
+	if c.Retry.InitialBackoff < 0 {
+		add("retry.initialBackoff", "must not be negative, got %s", c.Retry.InitialBackoff)
+	}
+	if c.Retry.MaxBackoff < c.Retry.InitialBackoff {
+		add("retry.maxBackoff", "must not be shorter than the initial backoff (%s), got %s",
+			c.Retry.InitialBackoff, c.Retry.MaxBackoff)
+	}
+	if c.Retry.Jitter < 0 || c.Retry.Jitter > 1 {
+		add("retry.jitter", "must be between 0 and 1, got %v", c.Retry.Jitter)
+	}
+
+	if c.Cache.ShipInfo < 0 {
+		add("cache.shipInfo", "must not be negative, got %s", c.Cache.ShipInfo)
+	}
+	if c.Cache.Marketplace < 0 {
+		add("cache.marketplace", "must not be negative, got %s", c.Cache.Marketplace)
+	}
+	if c.Cache.FlightPlan < 0 {
+		add("cache.flightPlan", "must not be negative, got %s", c.Cache.FlightPlan)
+	}
+
+	for _, rate := range []struct {
+		key   string
+		value float64
+	}{
+		{"chaos.delayRate", c.Chaos.DelayRate},
+		{"chaos.dropRate", c.Chaos.DropRate},
+		{"chaos.malformedRate", c.Chaos.MalformedRate},
+		{"chaos.errorRate", c.Chaos.ErrorRate},
+		{"chaos.reorderRate", c.Chaos.ReorderRate},
+	} {
+		if rate.value < 0 || rate.value > 1 {
+			add(rate.key, "must be between 0 and 1, got %v", rate.value)
+		}
+	}
+	if c.Chaos.DelayRate > 0 && c.Chaos.Delay <= 0 {
+		add("chaos.delay", "required when chaos.delayRate is set")
+	}
+	if c.Chaos.ErrorRate > 0 && len(c.Chaos.ErrorCodes) < 1 {
+		add("chaos.errorCodes", "required when chaos.errorRate is set")
+	}
+
+	if err := c.Telemetry.Validate(); err != nil {
+		add("telemetry", "%s", strings.TrimPrefix(err.Error(), "telemetry: "))
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration:\n  - %s", strings.Join(problems, "\n  - "))
+	}
+	return nil
+}
+
+// Redact returns a copy of the configuration with the secrets replaced by Redacted, so it can be printed or logged.
+func (c Config) Redact() Config {
+	redact := func(value string) string {
+		if len(value) < 1 {
+			return value
+		}
+		return Redacted
+	}
+
+	c.Token = redact(c.Token)
+	c.Kafka.SASL.Password = redact(c.Kafka.SASL.Password)
+	c.Log.AdminToken = redact(c.Log.AdminToken)
+	if len(c.Telemetry.Headers) > 0 {
+		// The headers usually carry the credentials of the collector.
+		headers := make(map[string]string, len(c.Telemetry.Headers))
+		for key, value := range c.Telemetry.Headers {
+			headers[key] = redact(value)
+		}
+		c.Telemetry.Headers = headers
+	}
+	return c
+}
+
+// Print writes the configuration, with the secrets redacted, in the same format as the configuration file.
+func (c Config) Print(w io.Writer) error {
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(c.Redact()); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
@@ -0,0 +1,385 @@
+package config
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/otaviokr/spacetraders-ship/telemetry"
+)
+
+// valid returns a configuration that passes the validation, to be changed by each test.
+func valid() Config {
+	c := Default()
+	c.ShipID = "ship-1"
+	c.RouteFile = "route.yaml"
+	c.Kafka.TopicRead = "replies"
+	c.Kafka.TopicWrite = "requests"
+	return c
+}
+
+func env(values map[string]string) func(string) string {
+	return func(name string) string {
+		return values[name]
+	}
+}
+
+func writeFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("\nACTUAL: %v\nEXPECT: no error\n", err)
+	}
+	return path
+}
+
+func load(t *testing.T, args []string, getenv func(string) string) (Config, error) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags := RegisterFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+	return flags.Load(getenv)
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeFile(t, `
+shipId: from-file
+routeFile: file-route.yaml
+rateLimit:
+  rate: 1
+  burst: 5
+kafka:
+  brokers: [file:9092]
+  topicRead: replies
+cache:
+  marketplace: 2m
+`)
+
+	useCases := map[string]map[string]interface{}{
+		"file only": {
+			"args":      []string{"-config", path},
+			"env":       map[string]string{},
+			"shipId":    "from-file",
+			"rate":      1.0,
+			"burst":     5,
+			"brokers":   []string{"file:9092"},
+			"cacheTTL":  2 * time.Minute,
+			"routeFile": "file-route.yaml",
+		},
+		"file from env": {
+			"args":      []string{},
+			"env":       map[string]string{FileEnv: path},
+			"shipId":    "from-file",
+			"rate":      1.0,
+			"burst":     5,
+			"brokers":   []string{"file:9092"},
+			"cacheTTL":  2 * time.Minute,
+			"routeFile": "file-route.yaml",
+		},
+		"env overrides file": {
+			"args": []string{"-config", path},
+			"env": map[string]string{
+				"SHIP_ID":               "from-env",
+				"RATE_LIMIT":            "0.5",
+				"KAFKA_CONN_STRING":     "a:9092, b:9092",
+				"CACHE_TTL_MARKETPLACE": "30s",
+			},
+			"shipId":    "from-env",
+			"rate":      0.5,
+			"burst":     5,
+			"brokers":   []string{"a:9092", "b:9092"},
+			"cacheTTL":  30 * time.Second,
+			"routeFile": "file-route.yaml",
+		},
+		"flags override env": {
+			"args": []string{"-config", path, "-ship-id", "from-flag", "-rate-limit=3", "-route", "flag-route.yaml"},
+			"env": map[string]string{
+				"SHIP_ID":    "from-env",
+				"RATE_LIMIT": "0.5",
+			},
+			"shipId":    "from-flag",
+			"rate":      3.0,
+			"burst":     5,
+			"brokers":   []string{"file:9092"},
+			"cacheTTL":  2 * time.Minute,
+			"routeFile": "flag-route.yaml",
+		},
+		"defaults": {
+			"args":      []string{},
+			"env":       map[string]string{},
+			"shipId":    "",
+			"rate":      2.0,
+			"burst":     2,
+			"brokers":   []string{"localhost:9092"},
+			"cacheTTL":  60 * time.Second,
+			"routeFile": "",
+		},
+	}
+
+	for name, uc := range useCases {
+		t.Run(name, func(t *testing.T) {
+			c, err := load(t, uc["args"].([]string), env(uc["env"].(map[string]string)))
+			if err != nil {
+				t.Fatalf("\nACTUAL: %v\nEXPECT: no error\n", err)
+			}
+
+			if c.ShipID != uc["shipId"].(string) || c.Telemetry.ShipID != c.ShipID {
+				t.Fatalf("\nACTUAL: %s (telemetry %s)\nEXPECT: %s\n", c.ShipID, c.Telemetry.ShipID, uc["shipId"])
+			}
+			if c.RouteFile != uc["routeFile"].(string) {
+				t.Fatalf("\nACTUAL: %s\nEXPECT: %s\n", c.RouteFile, uc["routeFile"])
+			}
+			if c.RateLimit.Rate != uc["rate"].(float64) || c.RateLimit.Burst != uc["burst"].(int) {
+				t.Fatalf("\nACTUAL: %+v\nEXPECT: rate %v burst %d\n", c.RateLimit, uc["rate"], uc["burst"])
+			}
+			if !reflect.DeepEqual(c.Kafka.Brokers, uc["brokers"].([]string)) {
+				t.Fatalf("\nACTUAL: %v\nEXPECT: %v\n", c.Kafka.Brokers, uc["brokers"])
+			}
+			if c.Cache.Marketplace != uc["cacheTTL"].(time.Duration) {
+				t.Fatalf("\nACTUAL: %s\nEXPECT: %s\n", c.Cache.Marketplace, uc["cacheTTL"])
+			}
+			// Not in the file, so it keeps the default.
+			if c.Retry.MaxAttempts != 5 || c.Retry.Retryable == nil {
+				t.Fatalf("\nACTUAL: %+v\nEXPECT: default retry policy\n", c.Retry)
+			}
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	useCases := map[string]map[string]interface{}{
+		"invalid env": {
+			"args":  []string{},
+			"env":   map[string]string{"RETRY_MAX_BACKOFF": "soon"},
+			"error": "RETRY_MAX_BACKOFF",
+		},
+		"invalid flag": {
+			"args":  []string{"-rate-limit-burst", "many"},
+			"env":   map[string]string{},
+			"error": "-rate-limit-burst",
+		},
+		"unknown key in file": {
+			"args":  []string{"-config", writeFile(t, "shipID: typo\n")},
+			"env":   map[string]string{},
+			"error": "field shipID not found",
+		},
+		"missing file": {
+			"args":  []string{"-config", filepath.Join(t.TempDir(), "missing.yaml")},
+			"env":   map[string]string{},
+			"error": "missing.yaml",
+		},
+	}
+
+	for name, uc := range useCases {
+		t.Run(name, func(t *testing.T) {
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			fs.SetOutput(&bytes.Buffer{})
+			flags := RegisterFlags(fs)
+			err := fs.Parse(uc["args"].([]string))
+			if err == nil {
+				_, err = flags.Load(env(uc["env"].(map[string]string)))
+			}
+			if err == nil || !strings.Contains(err.Error(), uc["error"].(string)) {
+				t.Fatalf("\nACTUAL: %v\nEXPECT: error about %s\n", err, uc["error"])
+			}
+		})
+	}
+}
+
+func TestLoadBoolFlag(t *testing.T) {
+	c, err := load(t, []string{"-dry-run", "-kafka-tls"}, env(map[string]string{"DRY_RUN": "false"}))
+	if err != nil {
+		t.Fatalf("\nACTUAL: %v\nEXPECT: no error\n", err)
+	}
+	if !c.DryRun || !c.Kafka.TLS.Enabled {
+		t.Fatalf("\nACTUAL: dry run %v, tls %v\nEXPECT: both enabled\n", c.DryRun, c.Kafka.TLS.Enabled)
+	}
+}
+
+func TestLoadJaegerURL(t *testing.T) {
+	useCases := map[string]map[string]interface{}{
+		"jaeger url only": {
+			"env":      map[string]string{"JAEGER_URL": "http://jaeger:14268/api/traces"},
+			"exporter": telemetry.ExporterJaeger,
+			"endpoint": "http://jaeger:14268/api/traces",
+		},
+		"trace settings win": {
+			"env": map[string]string{
+				"JAEGER_URL":     "http://jaeger:14268/api/traces",
+				"TRACE_EXPORTER": "OTLP-GRPC",
+				"TRACE_ENDPOINT": "collector:4317",
+			},
+			"exporter": telemetry.ExporterOTLPGRPC,
+			"endpoint": "collector:4317",
+		},
+		"nothing set": {
+			"env":      map[string]string{},
+			"exporter": telemetry.ExporterNone,
+			"endpoint": "",
+		},
+	}
+
+	for name, uc := range useCases {
+		t.Run(name, func(t *testing.T) {
+			c, err := load(t, []string{}, env(uc["env"].(map[string]string)))
+			if err != nil {
+				t.Fatalf("\nACTUAL: %v\nEXPECT: no error\n", err)
+			}
+			if c.Telemetry.Exporter != uc["exporter"].(string) || c.Telemetry.Endpoint != uc["endpoint"].(string) {
+				t.Fatalf("\nACTUAL: %s %s\nEXPECT: %s %s\n",
+					c.Telemetry.Exporter, c.Telemetry.Endpoint, uc["exporter"], uc["endpoint"])
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	useCases := map[string]map[string]interface{}{
+		"valid": {
+			"change":   func(c *Config) {},
+			"problems": []string{},
+		},
+		"missing ship and route": {
+			"change": func(c *Config) {
+				c.ShipID = ""
+				c.RouteFile = ""
+			},
+			"problems": []string{
+				"shipId: required (set SHIP_ID, -ship-id or shipId in the configuration file)",
+				"routeFile: required (set CONFIG_FILE_PATH, -route or routeFile in the configuration file)",
+			},
+		},
+		"out of range": {
+			"change": func(c *Config) {
+				c.MetricsPort = "90900"
+				c.Retry.Jitter = 2
+				c.Chaos.DropRate = -0.5
+			},
+			"problems": []string{"metricsPort:", "retry.jitter:", "chaos.dropRate:"},
+		},
+		"bad route reload": {
+			"change": func(c *Config) {
+				c.RouteReload.Interval = -time.Second
+				c.RouteReload.Apply = "now"
+			},
+			"problems": []string{"routeReload.interval: must not be negative", "routeReload.apply: unknown value \"now\""},
+		},
+		"bad logging": {
+			"change": func(c *Config) {
+				c.Log.Level = "verbose"
+				c.Log.Format = "xml"
+			},
+			"problems": []string{"log.level: unknown level \"verbose\"", "log.format: unknown format \"xml\""},
+		},
+		"incomplete chaos": {
+			"change": func(c *Config) {
+				c.Chaos.DelayRate = 0.1
+				c.Chaos.ErrorRate = 0.1
+			},
+			"problems": []string{"chaos.delay: required", "chaos.errorCodes: required"},
+		},
+		"sasl without password": {
+			"change": func(c *Config) {
+				c.Kafka.SASL.Mechanism = "plain"
+				c.Kafka.SASL.Username = "ship"
+			},
+			"problems": []string{"kafka.sasl.username: username and password are required"},
+		},
+		"unknown exporter": {
+			"change": func(c *Config) {
+				c.Telemetry.Exporter = "zipkin"
+			},
+			"problems": []string{"telemetry: unknown exporter \"zipkin\""},
+		},
+	}
+
+	for name, uc := range useCases {
+		t.Run(name, func(t *testing.T) {
+			c := valid()
+			uc["change"].(func(*Config))(&c)
+			err := c.Validate()
+
+			problems := uc["problems"].([]string)
+			if len(problems) < 1 {
+				if err != nil {
+					t.Fatalf("\nACTUAL: %v\nEXPECT: no error\n", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("\nACTUAL: no error\nEXPECT: %v\n", problems)
+			}
+			for _, problem := range problems {
+				if !strings.Contains(err.Error(), problem) {
+					t.Fatalf("\nACTUAL: %v\nEXPECT: %s\n", err, problem)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateWithoutRoute(t *testing.T) {
+	c := valid()
+	c.RouteFile = ""
+	if err := c.ValidateWithoutRoute(); err != nil {
+		t.Fatalf("\nACTUAL: %v\nEXPECT: no error\n", err)
+	}
+
+	c.ShipID = ""
+	if err := c.ValidateWithoutRoute(); err == nil || strings.Contains(err.Error(), "routeFile") {
+		t.Fatalf("\nACTUAL: %v\nEXPECT: only shipId required\n", err)
+	}
+}
+
+func TestPrintRedactsSecrets(t *testing.T) {
+	c := valid()
+	c.Token = "secret-token"
+	c.Kafka.SASL.Mechanism = "PLAIN"
+	c.Kafka.SASL.Username = "ship"
+	c.Kafka.SASL.Password = "secret-password"
+	c.Log.AdminToken = "secret-admin"
+	c.Telemetry.Headers = map[string]string{"authorization": "secret-header"}
+
+	var out bytes.Buffer
+	if err := c.Print(&out); err != nil {
+		t.Fatalf("\nACTUAL: %v\nEXPECT: no error\n", err)
+	}
+	if strings.Contains(out.String(), "secret") {
+		t.Fatalf("\nACTUAL: %s\nEXPECT: secrets redacted\n", out.String())
+	}
+	if strings.Count(out.String(), Redacted) != 4 || !strings.Contains(out.String(), "username: ship") {
+		t.Fatalf("\nACTUAL: %s\nEXPECT: 4 redacted values, username visible\n", out.String())
+	}
+	// The original is not changed.
+	if c.Token != "secret-token" || c.Telemetry.Headers["authorization"] != "secret-header" {
+		t.Fatalf("\nACTUAL: %+v\nEXPECT: original secrets\n", c)
+	}
+}
+
+func TestPrintCanBeLoaded(t *testing.T) {
+	c := valid()
+	c.Cache.FlightPlan = 1500 * time.Millisecond
+	c.Chaos.ErrorCodes = []int{503, 42901}
+	c.Telemetry.Attributes = map[string]string{"team": "traders"}
+
+	var out bytes.Buffer
+	if err := c.Print(&out); err != nil {
+		t.Fatalf("\nACTUAL: %v\nEXPECT: no error\n", err)
+	}
+
+	loaded, err := load(t, []string{"-config", writeFile(t, out.String())}, env(map[string]string{}))
+	if err != nil {
+		t.Fatalf("\nACTUAL: %v\nEXPECT: no error\n%s\n", err, out.String())
+	}
+	loaded.Retry.Retryable = nil
+	c.Retry.Retryable = nil
+	loaded.Telemetry.ShipID = ""
+	if !reflect.DeepEqual(loaded, c) {
+		t.Fatalf("\nACTUAL: %+v\nEXPECT: %+v\n", loaded, c)
+	}
+}
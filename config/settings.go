@@ -0,0 +1,388 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/otaviokr/spacetraders-ship/telemetry"
+)
+
+// FileEnv is the environment variable with the path to the configuration file, if not given by the -config flag.
+const FileEnv = "SHIP_CONFIG_FILE"
+
+// setting is a single value of the configuration that can be set by an environment variable or a command-line flag.
+type setting struct {
+	// key is where the value is in the configuration file.
+	key    string
+	env    string
+	flag   string
+	usage  string
+	isBool bool
+	set    func(c *Config, value string) error
+}
+
+// settings are applied in this order, so the more specific ones (e.g., TRACE_ENDPOINT) come after the ones they
+// override (e.g., JAEGER_URL).
+var settings = []setting{
+	stringSetting("shipId", "SHIP_ID", "ship-id", "ID of the ship to control",
+		func(c *Config) *string { return &c.ShipID }),
+	stringSetting("token", "USER_TOKEN", "token", "account token, identifies the shared rate limit",
+		func(c *Config) *string { return &c.Token }),
+	stringSetting("routeFile", "CONFIG_FILE_PATH", "route", "path to the route file",
+		func(c *Config) *string { return &c.RouteFile }),
+	stringSetting("metricsPort", "METRICS_PORT", "metrics-port", "port where the metrics are exposed",
+		func(c *Config) *string { return &c.MetricsPort }),
+	boolSetting("dryRun", "DRY_RUN", "dry-run", "only print what the ship would do in one cycle",
+		func(c *Config) *bool { return &c.DryRun }),
+	stringSetting("recordFile", "RECORD_FILE", "record", "file where the requests and responses are appended",
+		func(c *Config) *string { return &c.RecordFile }),
+	stringSetting("locationsFile", "LOCATIONS_FILE", "locations", "file where the locations learned are kept",
+		func(c *Config) *string { return &c.LocationsFile }),
+
+	durationSetting("routeReload.interval", "ROUTE_RELOAD_INTERVAL", "route-reload-interval",
+		"how often the route file is checked for changes (0 only checks it at each cycle)",
+		func(c *Config) *time.Duration { return &c.RouteReload.Interval }),
+	stringSetting("routeReload.apply", "ROUTE_RELOAD_APPLY", "route-reload-apply",
+		"when a changed route is applied: stop (at the next stop) or cycle (at the end of the cycle)",
+		func(c *Config) *string { return &c.RouteReload.Apply }),
+
+	stringSetting("log.level", "LOG_LEVEL", "log-level", "lowest level logged: debug, info, warn or error",
+		func(c *Config) *string { return &c.Log.Level }),
+	stringSetting("log.format", "LOG_FORMAT", "log-format", "format of the log lines: json or logfmt",
+		func(c *Config) *string { return &c.Log.Format }),
+	stringSetting("log.adminToken", "LOG_ADMIN_TOKEN", "log-admin-token",
+		"token required to change the log level at runtime (empty disables changing it)",
+		func(c *Config) *string { return &c.Log.AdminToken }),
+
+	floatSetting("rateLimit.rate", "RATE_LIMIT", "rate-limit", "requests per second (0 disables the limit)",
+		func(c *Config) *float64 { return &c.RateLimit.Rate }),
+	intSetting("rateLimit.burst", "RATE_LIMIT_BURST", "rate-limit-burst", "requests sent at once before waiting",
+		func(c *Config) *int { return &c.RateLimit.Burst }),
+
+	stringSetting("kafka.network", "KAFKA_CONN_TYPE", "kafka-network", "network type to reach the brokers",
+		func(c *Config) *string { return &c.Kafka.Network }),
+	listSetting("kafka.brokers", "KAFKA_CONN_STRING", "kafka-brokers", "comma-separated list of brokers (host:port)",
+		func(c *Config) *[]string { return &c.Kafka.Brokers }),
+	stringSetting("kafka.topicRead", "KAFKA_TOPIC_READ", "kafka-topic-read", "topic with the replies",
+		func(c *Config) *string { return &c.Kafka.TopicRead }),
+	stringSetting("kafka.topicWrite", "KAFKA_TOPIC_WRITE", "kafka-topic-write", "topic for the requests",
+		func(c *Config) *string { return &c.Kafka.TopicWrite }),
+	stringSetting("kafka.groupId", "KAFKA_GROUP_ID", "kafka-group-id", "consumer group to read the replies",
+		func(c *Config) *string { return &c.Kafka.GroupID }),
+	intSetting("kafka.partitionRead", "KAFKA_PARTITION_READ", "kafka-partition-read",
+		"partition to read from (-1 for the consumer group)",
+		func(c *Config) *int { return &c.Kafka.PartitionRead }),
+	intSetting("kafka.partitionWrite", "KAFKA_PARTITION_WRITE", "kafka-partition-write",
+		"partition to write to (-1 to partition by ship ID)",
+		func(c *Config) *int { return &c.Kafka.PartitionWrite }),
+	durationSetting("kafka.replyTimeout", "KAFKA_REPLY_TIMEOUT", "kafka-reply-timeout", "how long to wait for a reply",
+		func(c *Config) *time.Duration { return &c.Kafka.ReplyTimeout }),
+	boolSetting("kafka.tls.enabled", "KAFKA_TLS_ENABLED", "kafka-tls", "connect to the brokers with TLS",
+		func(c *Config) *bool { return &c.Kafka.TLS.Enabled }),
+	stringSetting("kafka.tls.caFile", "KAFKA_TLS_CA_FILE", "kafka-tls-ca-file", "PEM file with the CAs to trust",
+		func(c *Config) *string { return &c.Kafka.TLS.CAFile }),
+	stringSetting("kafka.tls.certFile", "KAFKA_TLS_CERT_FILE", "kafka-tls-cert-file",
+		"PEM file with the client certificate",
+		func(c *Config) *string { return &c.Kafka.TLS.CertFile }),
+	stringSetting("kafka.tls.keyFile", "KAFKA_TLS_KEY_FILE", "kafka-tls-key-file", "PEM file with the client key",
+		func(c *Config) *string { return &c.Kafka.TLS.KeyFile }),
+	stringSetting("kafka.tls.serverName", "KAFKA_TLS_SERVER_NAME", "kafka-tls-server-name",
+		"name checked in the broker certificate",
+		func(c *Config) *string { return &c.Kafka.TLS.ServerName }),
+	boolSetting("kafka.tls.insecureSkipVerify", "KAFKA_TLS_INSECURE_SKIP_VERIFY", "kafka-tls-insecure-skip-verify",
+		"do not verify the broker certificate (testing only!)",
+		func(c *Config) *bool { return &c.Kafka.TLS.InsecureSkipVerify }),
+	stringSetting("kafka.sasl.mechanism", "KAFKA_SASL_MECHANISM", "kafka-sasl-mechanism",
+		"PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512",
+		func(c *Config) *string { return &c.Kafka.SASL.Mechanism }),
+	stringSetting("kafka.sasl.username", "KAFKA_SASL_USERNAME", "kafka-sasl-username", "SASL username",
+		func(c *Config) *string { return &c.Kafka.SASL.Username }),
+	stringSetting("kafka.sasl.password", "KAFKA_SASL_PASSWORD", "kafka-sasl-password", "SASL password",
+		func(c *Config) *string { return &c.Kafka.SASL.Password }),
+
+	intSetting("retry.maxAttempts", "RETRY_MAX_ATTEMPTS", "retry-max-attempts",
+		"attempts per request, including the first",
+		func(c *Config) *int { return &c.Retry.MaxAttempts }),
+	durationSetting("retry.initialBackoff", "RETRY_INITIAL_BACKOFF", "retry-initial-backoff",
+		"wait before the first retry",
+		func(c *Config) *time.Duration { return &c.Retry.InitialBackoff }),
+	durationSetting("retry.maxBackoff", "RETRY_MAX_BACKOFF", "retry-max-backoff", "maximum wait between attempts",
+		func(c *Config) *time.Duration { return &c.Retry.MaxBackoff }),
+	floatSetting("retry.jitter", "RETRY_JITTER", "retry-jitter", "fraction (0 to 1) of the backoff that is random",
+		func(c *Config) *float64 { return &c.Retry.Jitter }),
+	boolSetting("retry.retryOrders", "RETRY_ORDERS", "retry-orders", "retry buy and sell orders (may trade twice)",
+		func(c *Config) *bool { return &c.Retry.RetryOrders }),
+
+	durationSetting("cache.shipInfo", "CACHE_TTL_SHIP_INFO", "cache-ttl-ship-info",
+		"how long the ship details are cached",
+		func(c *Config) *time.Duration { return &c.Cache.ShipInfo }),
+	durationSetting("cache.marketplace", "CACHE_TTL_MARKETPLACE", "cache-ttl-marketplace",
+		"how long the marketplace is cached",
+		func(c *Config) *time.Duration { return &c.Cache.Marketplace }),
+	durationSetting("cache.flightPlan", "CACHE_TTL_FLIGHT_PLAN", "cache-ttl-flight-plan",
+		"how long the flight plan is cached",
+		func(c *Config) *time.Duration { return &c.Cache.FlightPlan }),
+
+	durationSetting("chaos.delay", "CHAOS_DELAY", "chaos-delay", "maximum delay injected in a response",
+		func(c *Config) *time.Duration { return &c.Chaos.Delay }),
+	floatSetting("chaos.delayRate", "CHAOS_DELAY_RATE", "chaos-delay-rate", "how often a response is delayed",
+		func(c *Config) *float64 { return &c.Chaos.DelayRate }),
+	floatSetting("chaos.dropRate", "CHAOS_DROP_RATE", "chaos-drop-rate", "how often a reply is lost",
+		func(c *Config) *float64 { return &c.Chaos.DropRate }),
+	floatSetting("chaos.malformedRate", "CHAOS_MALFORMED_RATE", "chaos-malformed-rate", "how often a reply is malformed",
+		func(c *Config) *float64 { return &c.Chaos.MalformedRate }),
+	floatSetting("chaos.errorRate", "CHAOS_ERROR_RATE", "chaos-error-rate", "how often a reply is an error",
+		func(c *Config) *float64 { return &c.Chaos.ErrorRate }),
+	intListSetting("chaos.errorCodes", "CHAOS_ERROR_CODES", "chaos-error-codes", "comma-separated error codes to inject",
+		func(c *Config) *[]int { return &c.Chaos.ErrorCodes }),
+	floatSetting("chaos.reorderRate", "CHAOS_REORDER_RATE", "chaos-reorder-rate", "how often replies are swapped",
+		func(c *Config) *float64 { return &c.Chaos.ReorderRate }),
+	int64Setting("chaos.seed", "CHAOS_SEED", "chaos-seed", "seed to reproduce the faults (0 for random)",
+		func(c *Config) *int64 { return &c.Chaos.Seed }),
+
+	{
+		key:   "telemetry.endpoint",
+		env:   "JAEGER_URL",
+		flag:  "jaeger-url",
+		usage: "send the traces to this Jaeger collector (same as -trace-exporter=jaeger -trace-endpoint=URL)",
+		set: func(c *Config, value string) error {
+			c.Telemetry.Exporter = telemetry.ExporterJaeger
+			c.Telemetry.Endpoint = value
+			return nil
+		},
+	},
+	{
+		key:   "telemetry.exporter",
+		env:   "TRACE_EXPORTER",
+		flag:  "trace-exporter",
+		usage: "where the traces are sent: otlp-grpc, otlp-http, jaeger, stdout or none",
+		set: func(c *Config, value string) error {
+			c.Telemetry.Exporter = strings.ToLower(value)
+			return nil
+		},
+	},
+	stringSetting("telemetry.endpoint", "TRACE_ENDPOINT", "trace-endpoint", "where the exporter sends the traces",
+		func(c *Config) *string { return &c.Telemetry.Endpoint }),
+	boolSetting("telemetry.insecure", "TRACE_INSECURE", "trace-insecure", "disable TLS for the OTLP exporters",
+		func(c *Config) *bool { return &c.Telemetry.Insecure }),
+	mapSetting("telemetry.headers", "TRACE_HEADERS", "trace-headers", "headers for the OTLP exporters (key=value,...)",
+		func(c *Config) *map[string]string { return &c.Telemetry.Headers }),
+	{
+		key:   "telemetry.sampler",
+		env:   "TRACE_SAMPLER",
+		flag:  "trace-sampler",
+		usage: "which traces are kept: always, never, ratio or parentbased_ratio",
+		set: func(c *Config, value string) error {
+			c.Telemetry.Sampler = strings.ToLower(value)
+			return nil
+		},
+	},
+	floatSetting("telemetry.sampleRatio", "TRACE_SAMPLE_RATIO", "trace-sample-ratio", "fraction of the traces kept",
+		func(c *Config) *float64 { return &c.Telemetry.SampleRatio }),
+	stringSetting("telemetry.environment", "ENVIRONMENT", "environment", "environment reported in the traces",
+		func(c *Config) *string { return &c.Telemetry.Environment }),
+	mapSetting("telemetry.attributes", "TRACE_ATTRIBUTES", "trace-attributes",
+		"extra resource attributes in the traces (key=value,...)",
+		func(c *Config) *map[string]string { return &c.Telemetry.Attributes }),
+}
+
+// settingsByKey finds the setting for a key of the configuration file, to tell the user where it can be changed. If
+// more than one setting changes the same key, the last one (the most specific) is used.
+var settingsByKey = map[string]setting{}
+
+func init() {
+	for _, s := range settings {
+		settingsByKey[s.key] = s
+	}
+}
+
+func stringSetting(key, env, flag, usage string, field func(*Config) *string) setting {
+	return setting{key: key, env: env, flag: flag, usage: usage, set: func(c *Config, value string) error {
+		*field(c) = value
+		return nil
+	}}
+}
+
+func boolSetting(key, env, flag, usage string, field func(*Config) *bool) setting {
+	return setting{key: key, env: env, flag: flag, usage: usage, isBool: true, set: func(c *Config, value string) error {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean", value)
+		}
+		*field(c) = parsed
+		return nil
+	}}
+}
+
+func intSetting(key, env, flag, usage string, field func(*Config) *int) setting {
+	return setting{key: key, env: env, flag: flag, usage: usage, set: func(c *Config, value string) error {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", value)
+		}
+		*field(c) = parsed
+		return nil
+	}}
+}
+
+func int64Setting(key, env, flag, usage string, field func(*Config) *int64) setting {
+	return setting{key: key, env: env, flag: flag, usage: usage, set: func(c *Config, value string) error {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", value)
+		}
+		*field(c) = parsed
+		return nil
+	}}
+}
+
+func floatSetting(key, env, flag, usage string, field func(*Config) *float64) setting {
+	return setting{key: key, env: env, flag: flag, usage: usage, set: func(c *Config, value string) error {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", value)
+		}
+		*field(c) = parsed
+		return nil
+	}}
+}
+
+func durationSetting(key, env, flag, usage string, field func(*Config) *time.Duration) setting {
+	return setting{key: key, env: env, flag: flag, usage: usage, set: func(c *Config, value string) error {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a duration (e.g., 1.5s or 2m)", value)
+		}
+		*field(c) = parsed
+		return nil
+	}}
+}
+
+func listSetting(key, env, flag, usage string, field func(*Config) *[]string) setting {
+	return setting{key: key, env: env, flag: flag, usage: usage, set: func(c *Config, value string) error {
+		var list []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); len(item) > 0 {
+				list = append(list, item)
+			}
+		}
+		*field(c) = list
+		return nil
+	}}
+}
+
+func intListSetting(key, env, flag, usage string, field func(*Config) *[]int) setting {
+	return setting{key: key, env: env, flag: flag, usage: usage, set: func(c *Config, value string) error {
+		var list []int
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); len(item) < 1 {
+				continue
+			}
+			parsed, err := strconv.Atoi(item)
+			if err != nil {
+				return fmt.Errorf("%q is not an integer", item)
+			}
+			list = append(list, parsed)
+		}
+		*field(c) = list
+		return nil
+	}}
+}
+
+func mapSetting(key, env, flag, usage string, field func(*Config) *map[string]string) setting {
+	return setting{key: key, env: env, flag: flag, usage: usage, set: func(c *Config, value string) error {
+		parsed, err := telemetry.ParseAttributes(value)
+		if err != nil {
+			return err
+		}
+		*field(c) = parsed
+		return nil
+	}}
+}
+
+// Flags are the command-line flags of the configuration, registered in a flag set. The flags are only applied by
+// Load, after the configuration file and the environment variables.
+type Flags struct {
+	file    string
+	pending []pendingFlag
+}
+
+// pendingFlag is a flag given in the command line, waiting for Load.
+type pendingFlag struct {
+	setting setting
+	value   string
+}
+
+// flagValue adapts a setting to flag.Value.
+type flagValue struct {
+	flags   *Flags
+	setting setting
+	value   string
+}
+
+func (v *flagValue) String() string {
+	return v.value
+}
+
+func (v *flagValue) Set(value string) error {
+	// Parsing it now, so the flag package reports which flag is wrong.
+	if err := v.setting.set(&Config{}, value); err != nil {
+		return err
+	}
+	v.value = value
+	v.flags.pending = append(v.flags.pending, pendingFlag{setting: v.setting, value: value})
+	return nil
+}
+
+func (v *flagValue) IsBoolFlag() bool {
+	return v.setting.isBool
+}
+
+// RegisterFlags adds a flag for every setting of the configuration to fs, plus -config for the configuration file.
+func RegisterFlags(fs *flag.FlagSet) *Flags {
+	f := &Flags{}
+	fs.StringVar(&f.file, "config", "", fmt.Sprintf("path to the configuration file (%s)", FileEnv))
+	for _, s := range settings {
+		fs.Var(&flagValue{flags: f, setting: s}, s.flag, fmt.Sprintf("%s (%s)", s.usage, s.env))
+	}
+	return f
+}
+
+// Load builds the configuration from the defaults, the configuration file, the environment variables (read with
+// getenv) and the flags parsed so far, in this order of precedence. The result is not validated (see
+// Config.Validate), so it can be printed even if it is wrong.
+func (f *Flags) Load(getenv func(string) string) (Config, error) {
+	c := Default()
+
+	file := f.file
+	if len(file) < 1 {
+		file = getenv(FileEnv)
+	}
+	if len(file) > 0 {
+		if err := c.ReadFile(file); err != nil {
+			return c, err
+		}
+	}
+
+	for _, s := range settings {
+		value := getenv(s.env)
+		if len(value) < 1 {
+			continue
+		}
+		if err := s.set(&c, value); err != nil {
+			return c, fmt.Errorf("config: environment variable %s: %w", s.env, err)
+		}
+	}
+
+	for _, p := range f.pending {
+		if err := p.setting.set(&c, p.value); err != nil {
+			return c, fmt.Errorf("config: flag -%s: %w", p.setting.flag, err)
+		}
+	}
+
+	c.Telemetry.ShipID = c.ShipID
+	return c, nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/otaviokr/spacetraders-ship/backtest"
+	"github.com/otaviokr/spacetraders-ship/kafka"
+)
+
+// runExport converts a record file (see kafka.Recorder) into market data for the backtest.
+func runExport(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	cassettePath := flags.String("cassette", "", "record file to convert (default: the configured record file)")
+	outputPath := flags.String("output", "", "where the market data is written (default: standard output)")
+	cfg, err := loadConfig(flags, args)
+	if err != nil {
+		return err
+	}
+
+	if len(*cassettePath) < 1 {
+		*cassettePath = cfg.RecordFile
+	}
+	if len(*cassettePath) < 1 {
+		return fmt.Errorf("export: the record file is required")
+	}
+
+	replay, err := kafka.ReadCassetteFile(*cassettePath)
+	if err != nil {
+		return fmt.Errorf("export: reading record file: %w", err)
+	}
+
+	snapshot, err := backtest.SnapshotFromCassette(replay.Interactions())
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if len(*outputPath) > 0 {
+		f, err := os.Create(*outputPath)
+		if err != nil {
+			return fmt.Errorf("export: %w", err)
+		}
+		defer f.Close()
+		w = f
+	}
+	return backtest.WriteSnapshot(w, snapshot)
+}
@@ -0,0 +1,199 @@
+package gameerror
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Codes returned by the game that we know how to classify.
+//
+// Space Traders does not publish the full list of codes, so only the ones we have observed are mapped here. Anything
+// else is classified by the message, see classifyMessage.
+const (
+	CodeInsufficientFuel = 3001
+	CodeRateLimited      = 42901
+
+	// HTTP status codes, in case the gateway forwards them as the error code.
+	CodeTooManyRequests    = 429
+	CodeServiceUnavailable = 503
+)
+
+var (
+	// ErrInsufficientFuel means the ship does not have enough fuel to complete the flight plan.
+	ErrInsufficientFuel = errors.New("insufficient fuel")
+
+	// ErrInsufficientCredits means the account cannot afford the purchase.
+	ErrInsufficientCredits = errors.New("insufficient credits")
+
+	// ErrCargoFull means the ship has no room left for the goods.
+	ErrCargoFull = errors.New("cargo full")
+
+	// ErrGoodNotTraded means the marketplace does not buy or sell the good.
+	ErrGoodNotTraded = errors.New("good not traded in marketplace")
+
+	// ErrShipInTransit means the ship is flying and cannot trade nor receive a new flight plan.
+	ErrShipInTransit = errors.New("ship in transit")
+
+	// ErrRateLimited means too many requests were sent with the same token.
+	ErrRateLimited = errors.New("rate limited")
+
+	// ErrNotFound means the ship, location or flight plan requested does not exist.
+	ErrNotFound = errors.New("not found")
+
+	// ErrUnavailable means the game (or the infrastructure in between) could not answer the request.
+	ErrUnavailable = errors.New("service unavailable")
+)
+
+// classes maps the message fragments (lower case) to the error class they represent. The order matters: the first
+// match wins.
+var classes = []struct {
+	fragment string
+	class    error
+}{
+	{"insufficient fuel", ErrInsufficientFuel},
+	{"insufficient funds", ErrInsufficientCredits},
+	{"insufficient credits", ErrInsufficientCredits},
+	{"not enough credits", ErrInsufficientCredits},
+	{"cargo space", ErrCargoFull},
+	{"exceeds the available", ErrCargoFull},
+	// The service itself being unavailable must not be taken for a good that is not available.
+	{"service not available", ErrUnavailable},
+	{"service unavailable", ErrUnavailable},
+	{"endpoint not available", ErrUnavailable},
+	{"temporarily not available", ErrUnavailable},
+	{"temporarily unavailable", ErrUnavailable},
+	{"not available", ErrGoodNotTraded},
+	{"not sold", ErrGoodNotTraded},
+	{"not traded", ErrGoodNotTraded},
+	{"in transit", ErrShipInTransit},
+	{"in-transit", ErrShipInTransit},
+	{"throttle", ErrRateLimited},
+	{"rate limit", ErrRateLimited},
+	{"not found", ErrNotFound},
+	{"does not exist", ErrNotFound},
+}
+
+// requiredFuelRegex extracts how much fuel is missing from the insufficient fuel message.
+var requiredFuelRegex = regexp.MustCompile("You require ([0-9]+) more FUEL")
+
+// ServerError is an error reported by the game in the response body.
+type ServerError struct {
+	Code    int
+	Message string
+	// RetryAfter is how long the game asked us to wait before the next request, if it did.
+	RetryAfter time.Duration
+	class      error
+}
+
+// New creates a ServerError from the code and message sent by the game.
+func New(code int, message string) *ServerError {
+	return &ServerError{
+		Code:    code,
+		Message: message,
+		class:   Classify(code, message)}
+}
+
+// Error returns the error in the same format we always used to log server errors.
+func (e *ServerError) Error() string {
+	return fmt.Sprintf("ERROR FROM SERVER (%d): %s", e.Code, e.Message)
+}
+
+// Is allows errors.Is to match the ServerError against the sentinel errors of this package.
+func (e *ServerError) Is(target error) bool {
+	return e.class != nil && e.class == target
+}
+
+// Classify returns the sentinel error that represents the code and message sent by the game, or nil if unknown.
+func Classify(code int, message string) error {
+	switch code {
+	case CodeInsufficientFuel:
+		return ErrInsufficientFuel
+	case CodeRateLimited, CodeTooManyRequests:
+		return ErrRateLimited
+	case CodeServiceUnavailable:
+		return ErrUnavailable
+	}
+
+	return classifyMessage(message)
+}
+
+// classifyMessage looks for known fragments in the message, since most codes are not documented.
+func classifyMessage(message string) error {
+	lower := strings.ToLower(message)
+	for _, c := range classes {
+		if strings.Contains(lower, c.fragment) {
+			return c.class
+		}
+	}
+	return nil
+}
+
+// RequiredFuel returns how much extra fuel the game asked for, if err is an insufficient fuel error.
+func RequiredFuel(err error) (int, bool) {
+	var se *ServerError
+	if !errors.As(err, &se) || !errors.Is(se, ErrInsufficientFuel) {
+		return 0, false
+	}
+
+	found := requiredFuelRegex.FindStringSubmatch(se.Message)
+	if found == nil {
+		return 0, false
+	}
+
+	fuel, err := strconv.Atoi(found[1])
+	if err != nil {
+		return 0, false
+	}
+	return fuel, true
+}
+
+// response is the envelope used by the game to report errors.
+//
+// When rate limited, the game tells how many seconds to wait in the error data; the gateway may also forward the
+// Retry-After header as retryAfter.
+type response struct {
+	Error struct {
+		Message string `yaml:"message"`
+		Code    int    `yaml:"code"`
+		Data    struct {
+			RetryAfter float64 `yaml:"retryAfter"`
+		} `yaml:"data"`
+	} `yaml:"error"`
+	RetryAfter float64 `yaml:"retryAfter"`
+}
+
+// Parse looks for an error reported by the game in the response body, returning nil if there is none or if the body
+// cannot be decoded (that is for the caller to find out).
+func Parse(data []byte) error {
+	var r response
+	if err := yaml.Unmarshal(data, &r); err != nil {
+		return nil
+	}
+
+	if len(r.Error.Message) < 1 {
+		return nil
+	}
+
+	err := New(r.Error.Code, r.Error.Message)
+	retryAfter := r.Error.Data.RetryAfter
+	if retryAfter <= 0 {
+		retryAfter = r.RetryAfter
+	}
+	err.RetryAfter = time.Duration(retryAfter * float64(time.Second))
+	return err
+}
+
+// RetryAfter returns how long the game asked us to wait, if err is a rate limit error that carries that information.
+func RetryAfter(err error) (time.Duration, bool) {
+	var se *ServerError
+	if !errors.As(err, &se) || !errors.Is(se, ErrRateLimited) || se.RetryAfter <= 0 {
+		return 0, false
+	}
+	return se.RetryAfter, true
+}
@@ -0,0 +1,99 @@
+package gameerror_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/otaviokr/spacetraders-ship/gameerror"
+)
+
+func TestClassify(t *testing.T) {
+	useCases := map[string]map[string]interface{}{
+		"uc1": {
+			"code":     3001,
+			"message":  "Ship has insufficient fuel for flight plan. You require 13 more FUEL",
+			"expected": gameerror.ErrInsufficientFuel},
+		"uc2": {
+			"code":     42901,
+			"message":  "Throttle limit reached. Please try again.",
+			"expected": gameerror.ErrRateLimited},
+		"uc3": {
+			"code":     2004,
+			"message":  "User has insufficient funds to purchase the goods.",
+			"expected": gameerror.ErrInsufficientCredits},
+		"uc4": {
+			"code":     2002,
+			"message":  "Ship is currently in-transit. Wait until it arrives.",
+			"expected": gameerror.ErrShipInTransit},
+		"uc5": {
+			"code":     1234,
+			"message":  "Something nobody has seen before",
+			"expected": nil},
+		"uc6": {
+			"code":     4001,
+			"message":  "Good is not available in the marketplace.",
+			"expected": gameerror.ErrGoodNotTraded},
+		"uc7": {
+			"code":     1,
+			"message":  "The service not available right now, please try again later.",
+			"expected": gameerror.ErrUnavailable},
+		"uc8": {
+			"code":     1,
+			"message":  "Endpoint not available during maintenance.",
+			"expected": gameerror.ErrUnavailable}}
+
+	for name, uc := range useCases {
+		err := gameerror.New(uc["code"].(int), fmt.Sprintf("%v", uc["message"]))
+		expected, _ := uc["expected"].(error)
+		if expected == nil {
+			if gameerror.Classify(uc["code"].(int), fmt.Sprintf("%v", uc["message"])) != nil {
+				t.Fatalf("%s: expected no class for %s", name, err)
+			}
+			continue
+		}
+
+		if !errors.Is(fmt.Errorf("wrapped: %w", err), expected) {
+			t.Fatalf("%s: %s is not %s", name, err, expected)
+		}
+	}
+}
+
+func TestRequiredFuel(t *testing.T) {
+	err := gameerror.New(3001, "Ship has insufficient fuel for flight plan. You require 13 more FUEL")
+	fuel, ok := gameerror.RequiredFuel(err)
+	if !ok || fuel != 13 {
+		t.Fatalf("\nACTUAL: %d (%v)\nEXPECT: 13 (true)\n", fuel, ok)
+	}
+
+	if _, ok := gameerror.RequiredFuel(gameerror.New(42901, "Throttle limit reached.")); ok {
+		t.Fatal("rate limit error should not carry required fuel")
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	useCases := map[string]map[string]interface{}{
+		"uc1": {
+			"response": "{\"error\":{\"message\":\"Throttle limit reached.\",\"code\":42901,\"data\":{\"retryAfter\":1.5}}}",
+			"expected": 1500 * time.Millisecond},
+		"uc2": {
+			"response": "{\"error\":{\"message\":\"Too Many Requests\",\"code\":429},\"retryAfter\":3}",
+			"expected": 3 * time.Second}}
+
+	for name, uc := range useCases {
+		err := gameerror.Parse([]byte(fmt.Sprintf("%v", uc["response"])))
+		if !errors.Is(err, gameerror.ErrRateLimited) {
+			t.Fatalf("%s: %v is not rate limited", name, err)
+		}
+
+		actual, ok := gameerror.RetryAfter(err)
+		if !ok || actual != uc["expected"].(time.Duration) {
+			t.Fatalf("%s\nACTUAL: %s\nEXPECT: %s\n", name, actual, uc["expected"])
+		}
+	}
+
+	if err := gameerror.Parse([]byte("{\"ship\":{\"id\":\"id0001\"}}")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,140 @@
+package kafka
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/otaviokr/spacetraders-ship/gameerror"
+	"github.com/otaviokr/spacetraders-ship/web"
+)
+
+// CacheConfig defines for how long each kind of response is reused. A zero TTL disables the cache for that request.
+type CacheConfig struct {
+	ShipInfo    time.Duration `yaml:"shipInfo"`
+	Marketplace time.Duration `yaml:"marketplace"`
+	FlightPlan  time.Duration `yaml:"flightPlan"`
+}
+
+// DefaultCacheConfig returns the TTLs used when nothing else is configured. Flight plans are not cached, since the
+// time remaining is what the ship is waiting for.
+func DefaultCacheConfig() CacheConfig {
+	return CacheConfig{
+		ShipInfo:    15 * time.Second,
+		Marketplace: 60 * time.Second,
+	}
+}
+
+// cacheEntry is a response and when it stops being valid.
+type cacheEntry struct {
+	data    []byte
+	expires time.Time
+}
+
+// CachingProxy wraps another Proxy, reusing the responses of the read requests (ship details, marketplace and flight
+// plan) for a while. Any order (buy, sell or new flight plan) invalidates what it may have changed, even if it failed,
+// since the game may have processed it anyway. Errors are never cached.
+type CachingProxy struct {
+	proxy  Proxy
+	id     string
+	config CacheConfig
+	now    func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+// NewCachingProxy creates a new instance of CachingProxy. The id is only used to label the metrics.
+func NewCachingProxy(proxy Proxy, id string, config CacheConfig) *CachingProxy {
+	return &CachingProxy{
+		proxy:   proxy,
+		id:      id,
+		config:  config,
+		now:     time.Now,
+		entries: map[string]cacheEntry{},
+	}
+}
+
+// GetShipInfo collects information about specific ship.
+func (cp *CachingProxy) GetShipInfo(ctx context.Context) ([]byte, error) {
+	return cp.get("GetShipInfo", "ship", cp.config.ShipInfo, func() ([]byte, error) {
+		return cp.proxy.GetShipInfo(ctx)
+	})
+}
+
+// GetMarketplaceProducts gathers information about products available to trade in the planet where the ship is.
+func (cp *CachingProxy) GetMarketplaceProducts(ctx context.Context, location string) ([]byte, error) {
+	return cp.get("GetMarketplaceProducts", "marketplace/"+location, cp.config.Marketplace, func() ([]byte, error) {
+		return cp.proxy.GetMarketplaceProducts(ctx, location)
+	})
+}
+
+// SetNewFlightPlan sends to game a new destination where the ships needs to fly to. The ship leaves the marketplace,
+// so everything is invalidated.
+func (cp *CachingProxy) SetNewFlightPlan(ctx context.Context, destination string) ([]byte, error) {
+	defer cp.Invalidate("")
+	return cp.proxy.SetNewFlightPlan(ctx, destination)
+}
+
+// GetFlightPlan retrieves information about current flight plan for specific ship, if any. The ship only asks for it
+// while waiting to land, so the ship details are invalidated too: the next ones tell if the flight is over.
+func (cp *CachingProxy) GetFlightPlan(ctx context.Context, planId string) ([]byte, error) {
+	defer cp.Invalidate("ship")
+	return cp.get("GetFlightPlan", "flightPlan/"+planId, cp.config.FlightPlan, func() ([]byte, error) {
+		return cp.proxy.GetFlightPlan(ctx, planId)
+	})
+}
+
+// BuyGood sends to game a purchase order. The cargo, credits and the marketplace stock change.
+func (cp *CachingProxy) BuyGood(ctx context.Context, good string, quantity int) ([]byte, error) {
+	defer cp.Invalidate("ship")
+	defer cp.Invalidate("marketplace/")
+	return cp.proxy.BuyGood(ctx, good, quantity)
+}
+
+// SellGood sends to game a sell order. The cargo, credits and the marketplace stock change.
+func (cp *CachingProxy) SellGood(ctx context.Context, good string, quantity int) ([]byte, error) {
+	defer cp.Invalidate("ship")
+	defer cp.Invalidate("marketplace/")
+	return cp.proxy.SellGood(ctx, good, quantity)
+}
+
+// Invalidate removes the cached responses whose key starts with the prefix: "ship", "marketplace/" (optionally
+// followed by the location) or "flightPlan/". An empty prefix clears the whole cache.
+func (cp *CachingProxy) Invalidate(prefix string) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	for key := range cp.entries {
+		if strings.HasPrefix(key, prefix) {
+			delete(cp.entries, key)
+		}
+	}
+}
+
+// get returns the cached response if it is still valid, or sends the request and caches its response.
+func (cp *CachingProxy) get(action, key string, ttl time.Duration, request func() ([]byte, error)) ([]byte, error) {
+	if ttl <= 0 {
+		return request()
+	}
+
+	cp.mu.Lock()
+	entry, ok := cp.entries[key]
+	cp.mu.Unlock()
+	if ok && cp.now().Before(entry.expires) {
+		web.ProxyCacheRequests.WithLabelValues(cp.id, action, "hit").Inc()
+		return entry.data, nil
+	}
+	web.ProxyCacheRequests.WithLabelValues(cp.id, action, "miss").Inc()
+
+	data, err := request()
+	if err != nil || gameerror.Parse(data) != nil {
+		return data, err
+	}
+
+	cp.mu.Lock()
+	cp.entries[key] = cacheEntry{data: data, expires: cp.now().Add(ttl)}
+	cp.mu.Unlock()
+	return data, nil
+}
@@ -0,0 +1,113 @@
+package kafka
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/otaviokr/spacetraders-ship/mocks"
+)
+
+func TestCachingProxy(t *testing.T) {
+	details := []byte("{\"ship\":{\"id\":\"id0001\"}}")
+	market := []byte("{\"marketplace\":[]}")
+	failure := []byte("{\"error\":{\"message\":\"Throttle limit reached.\",\"code\":42901}}")
+
+	useCases := map[string]map[string]interface{}{
+		"hit": {
+			"expect": func(proxy *mocks.MockProxy) {
+				proxy.EXPECT().GetShipInfo(gomock.Any()).Return(details, nil).Times(1)
+			},
+			"run": func(cp *CachingProxy, clock *time.Time) {
+				cp.GetShipInfo(context.TODO())
+				*clock = clock.Add(10 * time.Second)
+				cp.GetShipInfo(context.TODO())
+			}},
+		"expired": {
+			"expect": func(proxy *mocks.MockProxy) {
+				proxy.EXPECT().GetShipInfo(gomock.Any()).Return(details, nil).Times(2)
+			},
+			"run": func(cp *CachingProxy, clock *time.Time) {
+				cp.GetShipInfo(context.TODO())
+				*clock = clock.Add(15 * time.Second)
+				cp.GetShipInfo(context.TODO())
+			}},
+		"errors not cached": {
+			"expect": func(proxy *mocks.MockProxy) {
+				gomock.InOrder(
+					proxy.EXPECT().GetShipInfo(gomock.Any()).Return(failure, nil),
+					proxy.EXPECT().GetShipInfo(gomock.Any()).Return(nil, ErrNoReply),
+					proxy.EXPECT().GetShipInfo(gomock.Any()).Return(details, nil))
+			},
+			"run": func(cp *CachingProxy, clock *time.Time) {
+				cp.GetShipInfo(context.TODO())
+				cp.GetShipInfo(context.TODO())
+				cp.GetShipInfo(context.TODO())
+				cp.GetShipInfo(context.TODO())
+			}},
+		"marketplace per location": {
+			"expect": func(proxy *mocks.MockProxy) {
+				proxy.EXPECT().GetMarketplaceProducts(gomock.Any(), "Local0001").Return(market, nil).Times(1)
+				proxy.EXPECT().GetMarketplaceProducts(gomock.Any(), "Local0002").Return(market, nil).Times(1)
+			},
+			"run": func(cp *CachingProxy, clock *time.Time) {
+				cp.GetMarketplaceProducts(context.TODO(), "Local0001")
+				cp.GetMarketplaceProducts(context.TODO(), "Local0002")
+				cp.GetMarketplaceProducts(context.TODO(), "Local0001")
+			}},
+		"invalidated by trade": {
+			"expect": func(proxy *mocks.MockProxy) {
+				proxy.EXPECT().GetShipInfo(gomock.Any()).Return(details, nil).Times(2)
+				proxy.EXPECT().GetMarketplaceProducts(gomock.Any(), "Local0001").Return(market, nil).Times(2)
+				proxy.EXPECT().SellGood(gomock.Any(), "Good0001", 1).Return(nil, ErrNoReply)
+			},
+			"run": func(cp *CachingProxy, clock *time.Time) {
+				cp.GetShipInfo(context.TODO())
+				cp.GetMarketplaceProducts(context.TODO(), "Local0001")
+				cp.SellGood(context.TODO(), "Good0001", 1)
+				cp.GetShipInfo(context.TODO())
+				cp.GetMarketplaceProducts(context.TODO(), "Local0001")
+			}},
+		"invalidated by flight plan": {
+			"expect": func(proxy *mocks.MockProxy) {
+				proxy.EXPECT().GetShipInfo(gomock.Any()).Return(details, nil).Times(2)
+				proxy.EXPECT().SetNewFlightPlan(gomock.Any(), "Local0002").Return(nil, nil)
+			},
+			"run": func(cp *CachingProxy, clock *time.Time) {
+				cp.GetShipInfo(context.TODO())
+				cp.SetNewFlightPlan(context.TODO(), "Local0002")
+				cp.GetShipInfo(context.TODO())
+			}},
+		"flight plan not cached by default": {
+			"expect": func(proxy *mocks.MockProxy) {
+				proxy.EXPECT().GetFlightPlan(gomock.Any(), "plan0001").Return(nil, nil).Times(2)
+			},
+			"run": func(cp *CachingProxy, clock *time.Time) {
+				cp.GetFlightPlan(context.TODO(), "plan0001")
+				cp.GetFlightPlan(context.TODO(), "plan0001")
+			}},
+		"invalidated by flight plan status": {
+			"expect": func(proxy *mocks.MockProxy) {
+				proxy.EXPECT().GetShipInfo(gomock.Any()).Return(details, nil).Times(2)
+				proxy.EXPECT().GetFlightPlan(gomock.Any(), "plan0001").Return(nil, nil)
+			},
+			"run": func(cp *CachingProxy, clock *time.Time) {
+				cp.GetShipInfo(context.TODO())
+				cp.GetFlightPlan(context.TODO(), "plan0001")
+				cp.GetShipInfo(context.TODO())
+			}}}
+
+	for _, uc := range useCases {
+		ctrl := gomock.NewController(t)
+		proxy := mocks.NewMockProxy(ctrl)
+		uc["expect"].(func(*mocks.MockProxy))(proxy)
+
+		clock := time.Date(2022, 7, 1, 10, 0, 0, 0, time.UTC)
+		cp := NewCachingProxy(proxy, "id0001", DefaultCacheConfig())
+		cp.now = func() time.Time { return clock }
+
+		uc["run"].(func(*CachingProxy, *time.Time))(cp, &clock)
+		ctrl.Finish()
+	}
+}
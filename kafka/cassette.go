@@ -0,0 +1,308 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/otaviokr/spacetraders-ship/gameerror"
+	"github.com/otaviokr/spacetraders-ship/logging"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// ErrCassetteMismatch means the request is not the one recorded next in the cassette.
+	ErrCassetteMismatch = errors.New("request does not match the cassette")
+
+	// ErrCassetteExhausted means all the interactions in the cassette were already replayed.
+	ErrCassetteExhausted = errors.New("no more interactions in the cassette")
+)
+
+// cassetteErrors are the sentinel errors kept in the cassette by name, so errors.Is still matches them when replayed.
+var cassetteErrors = []struct {
+	name string
+	err  error
+}{
+	{"no-reply", ErrNoReply},
+	{"unavailable", gameerror.ErrUnavailable},
+	{"rate-limited", gameerror.ErrRateLimited},
+	{"insufficient-fuel", gameerror.ErrInsufficientFuel},
+	{"insufficient-credits", gameerror.ErrInsufficientCredits},
+	{"cargo-full", gameerror.ErrCargoFull},
+	{"good-not-traded", gameerror.ErrGoodNotTraded},
+	{"ship-in-transit", gameerror.ErrShipInTransit},
+	{"not-found", gameerror.ErrNotFound},
+	{"canceled", context.Canceled},
+	{"deadline-exceeded", context.DeadlineExceeded},
+}
+
+// Interaction is a request sent through the proxy and the response it got, as stored in the cassette.
+type Interaction struct {
+	Time     time.Time     `yaml:"time"`
+	Duration time.Duration `yaml:"duration"`
+	Method   string        `yaml:"method"`
+	Args     []string      `yaml:"args,omitempty"`
+	Response string        `yaml:"response"`
+	Error    string        `yaml:"error,omitempty"`
+	// Class lists the sentinel errors the error matched, by name (e.g., no-reply, unavailable).
+	Class []string `yaml:"class,omitempty"`
+}
+
+// Recorder wraps another Proxy, writing every request and its response to the cassette. Each interaction is a YAML
+// document, written as soon as the response arrives, so the cassette is still readable if the ship crashes.
+type Recorder struct {
+	proxy Proxy
+	mu    sync.Mutex
+	w     io.Writer
+	now   func() time.Time
+}
+
+// NewRecorder creates a new instance of Recorder, writing the cassette to w.
+func NewRecorder(proxy Proxy, w io.Writer) *Recorder {
+	return &Recorder{
+		proxy: proxy,
+		w:     w,
+		now:   time.Now,
+	}
+}
+
+// GetShipInfo records the request to the proxy.
+func (r *Recorder) GetShipInfo(ctx context.Context) ([]byte, error) {
+	return r.record(ctx, "GetShipInfo", nil, func() ([]byte, error) {
+		return r.proxy.GetShipInfo(ctx)
+	})
+}
+
+// GetMarketplaceProducts records the request to the proxy.
+func (r *Recorder) GetMarketplaceProducts(ctx context.Context, location string) ([]byte, error) {
+	return r.record(ctx, "GetMarketplaceProducts", []string{location}, func() ([]byte, error) {
+		return r.proxy.GetMarketplaceProducts(ctx, location)
+	})
+}
+
+// SetNewFlightPlan records the request to the proxy.
+func (r *Recorder) SetNewFlightPlan(ctx context.Context, destination string) ([]byte, error) {
+	return r.record(ctx, "SetNewFlightPlan", []string{destination}, func() ([]byte, error) {
+		return r.proxy.SetNewFlightPlan(ctx, destination)
+	})
+}
+
+// GetFlightPlan records the request to the proxy.
+func (r *Recorder) GetFlightPlan(ctx context.Context, planId string) ([]byte, error) {
+	return r.record(ctx, "GetFlightPlan", []string{planId}, func() ([]byte, error) {
+		return r.proxy.GetFlightPlan(ctx, planId)
+	})
+}
+
+// BuyGood records the request to the proxy.
+func (r *Recorder) BuyGood(ctx context.Context, good string, quantity int) ([]byte, error) {
+	return r.record(ctx, "BuyGood", []string{good, strconv.Itoa(quantity)}, func() ([]byte, error) {
+		return r.proxy.BuyGood(ctx, good, quantity)
+	})
+}
+
+// SellGood records the request to the proxy.
+func (r *Recorder) SellGood(ctx context.Context, good string, quantity int) ([]byte, error) {
+	return r.record(ctx, "SellGood", []string{good, strconv.Itoa(quantity)}, func() ([]byte, error) {
+		return r.proxy.SellGood(ctx, good, quantity)
+	})
+}
+
+// record sends the request and appends the interaction to the cassette. Failing to write the cassette does not fail
+// the request: the ship must keep working even if the disk is full.
+func (r *Recorder) record(ctx context.Context, method string, args []string, request func() ([]byte, error)) ([]byte, error) {
+	start := r.now()
+	data, err := request()
+
+	interaction := Interaction{
+		Time:     start.UTC(),
+		Duration: r.now().Sub(start),
+		Method:   method,
+		Args:     args,
+		Response: string(data),
+	}
+	if err != nil {
+		interaction.Error = err.Error()
+		for _, sentinel := range cassetteErrors {
+			if errors.Is(err, sentinel.err) {
+				interaction.Class = append(interaction.Class, sentinel.name)
+			}
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	doc, marshalErr := yaml.Marshal(interaction)
+	if marshalErr == nil {
+		_, marshalErr = fmt.Fprintf(r.w, "---\n%s", doc)
+	}
+	if marshalErr != nil {
+		logging.Error(ctx, "Could not record the interaction", "method", method, "error", marshalErr)
+	}
+
+	return data, err
+}
+
+// Replay is a Proxy that serves the responses stored in a cassette, in the same order they were recorded. A request
+// that is not the next one in the cassette fails with ErrCassetteMismatch, so any change in the ship behaviour shows up.
+type Replay struct {
+	mu           sync.Mutex
+	interactions []Interaction
+	next         int
+}
+
+// ReadCassetteFile reads the cassette from the file, to be replayed.
+func ReadCassetteFile(path string) (*Replay, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadCassette(f)
+}
+
+// ReadCassette reads all the interactions in the cassette, to be replayed.
+func ReadCassette(data io.Reader) (*Replay, error) {
+	replay := &Replay{}
+	decoder := yaml.NewDecoder(data)
+	for {
+		var interaction Interaction
+		err := decoder.Decode(&interaction)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading cassette interaction %d: %w", len(replay.interactions)+1, err)
+		}
+		for _, name := range interaction.Class {
+			if cassetteError(name) == nil {
+				return nil, fmt.Errorf("reading cassette interaction %d: unknown error class %s",
+					len(replay.interactions)+1, name)
+			}
+		}
+		replay.interactions = append(replay.interactions, interaction)
+	}
+	return replay, nil
+}
+
+// Remaining returns how many interactions were not replayed yet.
+func (r *Replay) Remaining() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.interactions) - r.next
+}
+
+// Interactions returns all the interactions in the cassette, replayed or not.
+func (r *Replay) Interactions() []Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Interaction{}, r.interactions...)
+}
+
+// GetShipInfo replays the next interaction.
+func (r *Replay) GetShipInfo(ctx context.Context) ([]byte, error) {
+	return r.replay("GetShipInfo")
+}
+
+// GetMarketplaceProducts replays the next interaction.
+func (r *Replay) GetMarketplaceProducts(ctx context.Context, location string) ([]byte, error) {
+	return r.replay("GetMarketplaceProducts", location)
+}
+
+// SetNewFlightPlan replays the next interaction.
+func (r *Replay) SetNewFlightPlan(ctx context.Context, destination string) ([]byte, error) {
+	return r.replay("SetNewFlightPlan", destination)
+}
+
+// GetFlightPlan replays the next interaction.
+func (r *Replay) GetFlightPlan(ctx context.Context, planId string) ([]byte, error) {
+	return r.replay("GetFlightPlan", planId)
+}
+
+// BuyGood replays the next interaction.
+func (r *Replay) BuyGood(ctx context.Context, good string, quantity int) ([]byte, error) {
+	return r.replay("BuyGood", good, strconv.Itoa(quantity))
+}
+
+// SellGood replays the next interaction.
+func (r *Replay) SellGood(ctx context.Context, good string, quantity int) ([]byte, error) {
+	return r.replay("SellGood", good, strconv.Itoa(quantity))
+}
+
+// replay returns the response of the next interaction, if it matches the request.
+func (r *Replay) replay(method string, args ...string) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	request := fmt.Sprintf("%s(%s)", method, strings.Join(args, ", "))
+	if r.next >= len(r.interactions) {
+		return nil, fmt.Errorf("%w: %s", ErrCassetteExhausted, request)
+	}
+
+	interaction := r.interactions[r.next]
+	if interaction.Method != method || !equalArgs(interaction.Args, args) {
+		return nil, fmt.Errorf("%w: got %s, expected %s(%s) (interaction %d)",
+			ErrCassetteMismatch, request, interaction.Method, strings.Join(interaction.Args, ", "), r.next+1)
+	}
+	r.next++
+
+	var err error
+	if len(interaction.Error) > 0 {
+		replayed := &replayedError{message: interaction.Error}
+		for _, name := range interaction.Class {
+			replayed.classes = append(replayed.classes, cassetteError(name))
+		}
+		err = replayed
+	}
+	return []byte(interaction.Response), err
+}
+
+// cassetteError returns the sentinel error kept in the cassette with the name, or nil if unknown.
+func cassetteError(name string) error {
+	for _, sentinel := range cassetteErrors {
+		if sentinel.name == name {
+			return sentinel.err
+		}
+	}
+	return nil
+}
+
+// equalArgs compares the recorded arguments with the ones in the request.
+func equalArgs(recorded, requested []string) bool {
+	if len(recorded) != len(requested) {
+		return false
+	}
+	for i := range recorded {
+		if recorded[i] != requested[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// replayedError is an error stored in the cassette. Its original type is lost, so errors.Is matches the sentinel errors
+// recorded with it instead.
+type replayedError struct {
+	message string
+	classes []error
+}
+
+func (e *replayedError) Error() string {
+	return e.message
+}
+
+func (e *replayedError) Is(target error) bool {
+	for _, class := range e.classes {
+		if class == target {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,81 @@
+package kafka
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/otaviokr/spacetraders-ship/gameerror"
+	"github.com/otaviokr/spacetraders-ship/mocks"
+)
+
+func TestReadCassetteUnknownClass(t *testing.T) {
+	cassette := "---\nmethod: GetShipInfo\nerror: something went wrong\nclass: [no-reply, gone-wrong]\n"
+	expected := "reading cassette interaction 1: unknown error class gone-wrong"
+	if _, err := ReadCassette(strings.NewReader(cassette)); err == nil || err.Error() != expected {
+		t.Fatalf("\nACTUAL: %v\nEXPECT: %s\n", err, expected)
+	}
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	proxy := mocks.NewMockProxy(ctrl)
+	gomock.InOrder(
+		proxy.EXPECT().GetShipInfo(gomock.Any()).Return([]byte("{\"ship\":{\"id\":\"id0001\"}}"), nil),
+		proxy.EXPECT().BuyGood(gomock.Any(), "FUEL", 10).Return(nil, ErrNoReply),
+		proxy.EXPECT().GetMarketplaceProducts(gomock.Any(), "Local0001").Return([]byte("{\"marketplace\":[]}"), nil),
+		proxy.EXPECT().GetFlightPlan(gomock.Any(), "plan0001").Return(nil, errors.New("flight plan not found")))
+
+	var cassette bytes.Buffer
+	recorder := NewRecorder(proxy, &cassette)
+	recorder.now = func() time.Time { return time.Date(2022, 7, 1, 10, 0, 0, 0, time.UTC) }
+
+	recorder.GetShipInfo(context.TODO())
+	recorder.BuyGood(context.TODO(), "FUEL", 10)
+	recorder.GetMarketplaceProducts(context.TODO(), "Local0001")
+	recorder.GetFlightPlan(context.TODO(), "plan0001")
+
+	replay, err := ReadCassette(&cassette)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replay.Remaining() != 4 {
+		t.Fatalf("\nACTUAL: %d\nEXPECT: %d\n", replay.Remaining(), 4)
+	}
+
+	data, err := replay.GetShipInfo(context.TODO())
+	if err != nil || string(data) != "{\"ship\":{\"id\":\"id0001\"}}" {
+		t.Fatalf("\nACTUAL: %s (%v)\nEXPECT: %s\n", data, err, "{\"ship\":{\"id\":\"id0001\"}}")
+	}
+
+	// The request must match the one recorded next.
+	if _, err = replay.GetMarketplaceProducts(context.TODO(), "Local0001"); !errors.Is(err, ErrCassetteMismatch) {
+		t.Fatalf("\nACTUAL: %v\nEXPECT: %v\n", err, ErrCassetteMismatch)
+	}
+	if _, err = replay.BuyGood(context.TODO(), "FUEL", 11); !errors.Is(err, ErrCassetteMismatch) {
+		t.Fatalf("\nACTUAL: %v\nEXPECT: %v\n", err, ErrCassetteMismatch)
+	}
+
+	// The recorded errors still match the sentinels.
+	if _, err = replay.BuyGood(context.TODO(), "FUEL", 10); !errors.Is(err, gameerror.ErrUnavailable) || !errors.Is(err, ErrNoReply) {
+		t.Fatalf("\nACTUAL: %v\nEXPECT: %v\n", err, ErrNoReply)
+	}
+
+	if _, err = replay.GetMarketplaceProducts(context.TODO(), "Local0001"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the sentinels recorded match, whatever the message says.
+	if _, err = replay.GetFlightPlan(context.TODO(), "plan0001"); err == nil || errors.Is(err, gameerror.ErrNotFound) {
+		t.Fatalf("\nACTUAL: %v\nEXPECT: an error not matching %v\n", err, gameerror.ErrNotFound)
+	}
+	if _, err = replay.GetShipInfo(context.TODO()); !errors.Is(err, ErrCassetteExhausted) {
+		t.Fatalf("\nACTUAL: %v\nEXPECT: %v\n", err, ErrCassetteExhausted)
+	}
+}
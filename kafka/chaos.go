@@ -0,0 +1,188 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/otaviokr/spacetraders-ship/gameerror"
+	"github.com/otaviokr/spacetraders-ship/web"
+)
+
+// Faults injected by the ChaosProxy, also used as the label of the metric.
+const (
+	FaultDelay     = "delay"
+	FaultDrop      = "drop"
+	FaultMalformed = "malformed"
+	FaultError     = "error"
+	FaultReorder   = "reorder"
+)
+
+// ChaosConfig defines which faults the ChaosProxy injects and how often. The rates are probabilities (0 to 1) applied
+// to each request; a zero rate disables the fault.
+type ChaosConfig struct {
+	// Delay is the maximum time a delayed response waits; the actual wait is random, up to this value.
+	Delay     time.Duration `yaml:"delay"`
+	DelayRate float64       `yaml:"delayRate"`
+	// DropRate is how often the request is sent, but the reply is lost (like ErrNoReply).
+	DropRate float64 `yaml:"dropRate"`
+	// MalformedRate is how often the reply is replaced by a body that is not valid YAML.
+	MalformedRate float64 `yaml:"malformedRate"`
+	// ErrorRate is how often the reply is replaced by an error from the server, with one of ErrorCodes.
+	ErrorRate  float64 `yaml:"errorRate"`
+	ErrorCodes []int   `yaml:"errorCodes"`
+	// ReorderRate is how often the reply of the previous request is delivered instead of the current one.
+	ReorderRate float64 `yaml:"reorderRate"`
+	// Seed makes the faults reproducible. If zero, the current time is used.
+	Seed int64 `yaml:"seed"`
+}
+
+// Enabled tells if any fault would be injected with this configuration.
+func (c ChaosConfig) Enabled() bool {
+	return c.DelayRate > 0 || c.DropRate > 0 || c.MalformedRate > 0 || c.ErrorRate > 0 || c.ReorderRate > 0
+}
+
+// malformedResponse is what the game would never send: the YAML decoder fails on it.
+const malformedResponse = "{\"ship\": [\"id\": "
+
+// ChaosProxy wraps another Proxy, injecting faults in the responses to test how the ship behaves when things go wrong.
+// It must never be used against the real game other than on purpose.
+type ChaosProxy struct {
+	proxy  Proxy
+	id     string
+	config ChaosConfig
+	sleep  func(time.Duration)
+
+	mu       sync.Mutex
+	random   *rand.Rand
+	previous []byte
+}
+
+// NewChaosProxy creates a new instance of ChaosProxy. The id is only used to label the metrics.
+func NewChaosProxy(proxy Proxy, id string, config ChaosConfig) *ChaosProxy {
+	if len(config.ErrorCodes) < 1 {
+		config.ErrorCodes = []int{gameerror.CodeServiceUnavailable}
+	}
+	seed := config.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	return &ChaosProxy{
+		proxy:  proxy,
+		id:     id,
+		config: config,
+		sleep:  time.Sleep,
+		random: rand.New(rand.NewSource(seed)),
+	}
+}
+
+// GetShipInfo sends the request to the proxy, injecting faults in the response.
+func (c *ChaosProxy) GetShipInfo(ctx context.Context) ([]byte, error) {
+	return c.inject("GetShipInfo", func() ([]byte, error) {
+		return c.proxy.GetShipInfo(ctx)
+	})
+}
+
+// GetMarketplaceProducts sends the request to the proxy, injecting faults in the response.
+func (c *ChaosProxy) GetMarketplaceProducts(ctx context.Context, location string) ([]byte, error) {
+	return c.inject("GetMarketplaceProducts", func() ([]byte, error) {
+		return c.proxy.GetMarketplaceProducts(ctx, location)
+	})
+}
+
+// SetNewFlightPlan sends the request to the proxy, injecting faults in the response.
+func (c *ChaosProxy) SetNewFlightPlan(ctx context.Context, destination string) ([]byte, error) {
+	return c.inject("SetNewFlightPlan", func() ([]byte, error) {
+		return c.proxy.SetNewFlightPlan(ctx, destination)
+	})
+}
+
+// GetFlightPlan sends the request to the proxy, injecting faults in the response.
+func (c *ChaosProxy) GetFlightPlan(ctx context.Context, planId string) ([]byte, error) {
+	return c.inject("GetFlightPlan", func() ([]byte, error) {
+		return c.proxy.GetFlightPlan(ctx, planId)
+	})
+}
+
+// BuyGood sends the request to the proxy, injecting faults in the response.
+func (c *ChaosProxy) BuyGood(ctx context.Context, good string, quantity int) ([]byte, error) {
+	return c.inject("BuyGood", func() ([]byte, error) {
+		return c.proxy.BuyGood(ctx, good, quantity)
+	})
+}
+
+// SellGood sends the request to the proxy, injecting faults in the response.
+func (c *ChaosProxy) SellGood(ctx context.Context, good string, quantity int) ([]byte, error) {
+	return c.inject("SellGood", func() ([]byte, error) {
+		return c.proxy.SellGood(ctx, good, quantity)
+	})
+}
+
+// inject sends the request, then tampers with the response according to the configuration. The request always
+// reaches the game, so a dropped or replaced reply may hide an order that was actually executed, as in real life.
+func (c *ChaosProxy) inject(action string, request func() ([]byte, error)) ([]byte, error) {
+	data, err := request()
+
+	c.mu.Lock()
+	fault, delay, code := c.pick()
+	previous := c.previous
+	if err == nil {
+		c.previous = data
+	}
+	c.mu.Unlock()
+
+	if len(fault) < 1 {
+		return data, err
+	}
+	web.ChaosFaults.WithLabelValues(c.id, action, fault).Inc()
+
+	switch fault {
+	case FaultDelay:
+		c.sleep(delay)
+		return data, err
+	case FaultDrop:
+		return nil, ErrNoReply
+	case FaultMalformed:
+		return []byte(malformedResponse), nil
+	case FaultError:
+		return []byte(fmt.Sprintf("{\"error\":{\"message\":\"Injected fault.\",\"code\":%d}}", code)), nil
+	case FaultReorder:
+		if previous == nil {
+			return data, err
+		}
+		return previous, nil
+	}
+	return data, err
+}
+
+// pick decides which fault (if any) to inject in the next response. Only one fault is injected per request.
+func (c *ChaosProxy) pick() (string, time.Duration, int) {
+	faults := []struct {
+		name string
+		rate float64
+	}{
+		{FaultDrop, c.config.DropRate},
+		{FaultMalformed, c.config.MalformedRate},
+		{FaultError, c.config.ErrorRate},
+		{FaultReorder, c.config.ReorderRate},
+		{FaultDelay, c.config.DelayRate},
+	}
+
+	for _, f := range faults {
+		if f.rate <= 0 || c.random.Float64() >= f.rate {
+			continue
+		}
+
+		switch f.name {
+		case FaultDelay:
+			return f.name, time.Duration(c.random.Int63n(int64(c.config.Delay) + 1)), 0
+		case FaultError:
+			return f.name, 0, c.config.ErrorCodes[c.random.Intn(len(c.config.ErrorCodes))]
+		}
+		return f.name, 0, 0
+	}
+	return "", 0, 0
+}
@@ -0,0 +1,75 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/otaviokr/spacetraders-ship/gameerror"
+	"github.com/otaviokr/spacetraders-ship/mocks"
+)
+
+func TestChaosProxy(t *testing.T) {
+	first := "{\"ship\":{\"id\":\"id0001\",\"location\":\"Local0001\"}}"
+	second := "{\"ship\":{\"id\":\"id0001\",\"location\":\"Local0002\"}}"
+
+	useCases := map[string]map[string]interface{}{
+		"no fault": {
+			"config":   ChaosConfig{},
+			"expected": second,
+			"err":      nil},
+		"delay": {
+			"config":   ChaosConfig{Delay: time.Second, DelayRate: 1},
+			"expected": second,
+			"err":      nil,
+			"slept":    true},
+		"drop": {
+			"config":   ChaosConfig{DropRate: 1},
+			"expected": "",
+			"err":      gameerror.ErrUnavailable},
+		"malformed": {
+			"config":   ChaosConfig{MalformedRate: 1},
+			"expected": malformedResponse,
+			"err":      nil},
+		"server error": {
+			"config":   ChaosConfig{ErrorRate: 1, ErrorCodes: []int{42901}},
+			"expected": "{\"error\":{\"message\":\"Injected fault.\",\"code\":42901}}",
+			"err":      nil},
+		"reorder": {
+			"config":   ChaosConfig{ReorderRate: 1},
+			"expected": first,
+			"err":      nil}}
+
+	for name, uc := range useCases {
+		ctrl := gomock.NewController(t)
+		proxy := mocks.NewMockProxy(ctrl)
+		gomock.InOrder(
+			proxy.EXPECT().GetShipInfo(gomock.Any()).Return([]byte(first), nil),
+			proxy.EXPECT().GetShipInfo(gomock.Any()).Return([]byte(second), nil))
+
+		config := uc["config"].(ChaosConfig)
+		config.Seed = 1
+		chaos := NewChaosProxy(proxy, "id0001", config)
+		slept := false
+		chaos.sleep = func(time.Duration) { slept = true }
+
+		// The first request only feeds the reordered reply; the faults are checked on the second one.
+		chaos.GetShipInfo(context.TODO())
+		slept = false
+		data, err := chaos.GetShipInfo(context.TODO())
+
+		expectedErr, _ := uc["err"].(error)
+		if !errors.Is(err, expectedErr) || (expectedErr == nil && err != nil) {
+			t.Fatalf("%s\nACTUAL: %v\nEXPECT: %v\n", name, err, expectedErr)
+		}
+		if string(data) != uc["expected"].(string) {
+			t.Fatalf("%s\nACTUAL: %s\nEXPECT: %s\n", name, data, uc["expected"])
+		}
+		if expectedSlept, _ := uc["slept"].(bool); slept != expectedSlept {
+			t.Fatalf("%s\nACTUAL: %t\nEXPECT: %t\n", name, slept, expectedSlept)
+		}
+		ctrl.Finish()
+	}
+}
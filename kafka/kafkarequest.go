@@ -1,9 +1,10 @@
 package kafka
 
 import (
+	"context"
 	"fmt"
-	"log"
-	"time"
+
+	"github.com/otaviokr/spacetraders-ship/logging"
 )
 
 const (
@@ -18,21 +19,14 @@ const (
 // GetShipInfo collects information about specific ship.
 //
 // https://api.spacetraders.io/#api-ships-GetShip
-func (kp *KafkaProxy) GetShipInfo() ([]byte, error) {
+func (kp *KafkaProxy) GetShipInfo(ctx context.Context) ([]byte, error) {
 	// return wp.get(fmt.Sprintf(httpEndpointGetShipDetails, wp.id, wp.token))
-	msg := []byte{}
-	err := kp.Write(kp.id, fmt.Sprintf("{\"id\": \"%s\", \"action\": \"%s\"}", kp.id, httpEndpointGetShipDetails))
+	msg, err := kp.request(ctx, "GetShipInfo", fmt.Sprintf("{\"id\": \"%s\", \"action\": \"%s\"}", kp.id, httpEndpointGetShipDetails))
 	if err != nil {
-		log.Println("Error sending request to kafka:", err)
+		logging.Error(ctx, "Could not request the ship details", "error", err)
 		return msg, err
 	}
-
-	for len(msg) < 1 {
-		log.Println("Waiting for response from GetShipInfo...")
-		time.Sleep(1 * time.Second)
-		msg = kp.Read()
-	}
-	log.Printf("GetShipInfo: received msg : %s\n", string(msg))
+	logging.Debug(ctx, "Ship details received", "bytes", len(msg))
 
 	return msg, nil
 }
@@ -40,94 +34,54 @@ func (kp *KafkaProxy) GetShipInfo() ([]byte, error) {
 // GetMarketplaceProducts gathers information about products available to trade in the planet where the ship is.
 //
 // https://api.spacetraders.io/#api-locations-GetMarketplace
-func (kp *KafkaProxy) GetMarketplaceProducts(location string) ([]byte, error) {
+func (kp *KafkaProxy) GetMarketplaceProducts(ctx context.Context, location string) ([]byte, error) {
 	// return wp.get(fmt.Sprintf(httpEndpointGetMarketplaceInfo, location, wp.token))
-	kp.Write(kp.id, fmt.Sprintf("{\"action\": \"%s\", \"id\": \"%s\", \"location\": \"%s\"}", httpEndpointGetMarketplaceInfo, kp.id, location))
-
-	msg := []byte{}
-	for len(msg) < 1 {
-		time.Sleep(1 * time.Second)
-		msg = kp.Read()
-	}
-
-	return msg, nil
+	return kp.request(ctx, "GetMarketplaceProducts", fmt.Sprintf("{\"action\": \"%s\", \"id\": \"%s\", \"location\": \"%s\"}", httpEndpointGetMarketplaceInfo, kp.id, location))
 }
 
 // SetNewFlightPlan sends to game a new destination where the ships needs to fly to.
 //
 // https://api.spacetraders.io/#api-flight_plans-NewFlightPlan
-func (kp *KafkaProxy) SetNewFlightPlan(destination string) ([]byte, error) {
+func (kp *KafkaProxy) SetNewFlightPlan(ctx context.Context, destination string) ([]byte, error) {
 	// return wp.post(
 	// 	fmt.Sprintf(httpEndpointPostFlightPlanNew, wp.token),
 	// 	bytes.NewReader(
 	// 		[]byte(fmt.Sprintf("{\"shipId\": \"%s\", \"destination\": \"%s\"}", wp.id, destination))))
-	kp.Write(kp.id, fmt.Sprintf("{\"action\": \"%s\",\"shipId\": \"%s\",\"destination\":\"%s\"}", httpEndpointPostFlightPlanNew, kp.id, destination))
-
-	msg := []byte{}
-	for len(msg) < 1 {
-		time.Sleep(1 * time.Second)
-		msg = kp.Read()
-	}
-
-	return msg, nil
+	return kp.request(ctx, "SetNewFlightPlan", fmt.Sprintf("{\"action\": \"%s\",\"shipId\": \"%s\",\"destination\":\"%s\"}", httpEndpointPostFlightPlanNew, kp.id, destination))
 }
 
 // GetFlightPlan retrieves information about current flight plan for specific ship, if any.
 //
 // https://api.spacetraders.io/#api-flight_plans-GetFlightPlan
-func (kp *KafkaProxy) GetFlightPlan(planId string) ([]byte, error) {
+func (kp *KafkaProxy) GetFlightPlan(ctx context.Context, planId string) ([]byte, error) {
 	// return wp.get(fmt.Sprintf(httpEndpointGetFlightPlanDetails, planId, wp.token))
-	kp.Write(kp.id, fmt.Sprintf("{\"action\": \"%s\",\"planId\": \"%s\"}", httpEndpointGetFlightPlanDetails, planId))
-
-	msg := []byte{}
-	for len(msg) < 1 {
-		time.Sleep(1 * time.Second)
-		msg = kp.Read()
-	}
-
-	return msg, nil
+	return kp.request(ctx, "GetFlightPlan", fmt.Sprintf("{\"action\": \"%s\",\"planId\": \"%s\"}", httpEndpointGetFlightPlanDetails, planId))
 }
 
 // BuyGood sends to game a purchase order.
 //
 // https://api.spacetraders.io/#api-purchase_orders-NewPurchaseOrder
-func (kp *KafkaProxy) BuyGood(good string, quantity int) ([]byte, error) {
+func (kp *KafkaProxy) BuyGood(ctx context.Context, good string, quantity int) ([]byte, error) {
 	// return wp.post(
 	// 	fmt.Sprintf(httpEndpointPostBuyOrderNew, wp.token),
 	// 	bytes.NewReader(
 	// 		[]byte(
 	// 			fmt.Sprintf("{\"shipId\": \"%s\", \"good\": \"%s\", \"quantity\": %d}", wp.id, good, quantity))))
-	kp.Write(kp.id, fmt.Sprintf(
+	return kp.request(ctx, "BuyGood", fmt.Sprintf(
 		"{\"action\": \"%s\",\"shipId\": \"%s\",\"good\": \"%s\",\"quantity\": %d}",
 		httpEndpointPostBuyOrderNew, kp.id, good, quantity))
-
-	msg := []byte{}
-	for len(msg) < 1 {
-		time.Sleep(1 * time.Second)
-		msg = kp.Read()
-	}
-
-	return msg, nil
 }
 
 // SellGood sends to game a sell order.
 //
 // https://api.spacetraders.io/#api-sell_orders-NewSellOrder
-func (kp *KafkaProxy) SellGood(good string, quantity int) ([]byte, error) {
+func (kp *KafkaProxy) SellGood(ctx context.Context, good string, quantity int) ([]byte, error) {
 	// return wp.post(
 	// 	fmt.Sprintf(httpEndpointPostSellOrderNew, wp.token),
 	// 	bytes.NewReader(
 	// 		[]byte(
 	// 			fmt.Sprintf("{\"shipId\": \"%s\", \"good\": \"%s\", \"quantity\": %d}", wp.id, good, quantity))))
-	kp.Write(kp.id, fmt.Sprintf(
+	return kp.request(ctx, "SellGood", fmt.Sprintf(
 		"{\"action\": \"%s\",\"shipId\": \"%s\",\"good\": \"%s\",\"quantity\": %d}",
 		httpEndpointPostSellOrderNew, kp.id, good, quantity))
-
-	msg := []byte{}
-	for len(msg) < 1 {
-		time.Sleep(1 * time.Second)
-		msg = kp.Read()
-	}
-
-	return msg, nil
 }
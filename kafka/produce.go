@@ -2,82 +2,549 @@ package kafka
 
 import (
 	"context"
-	"log"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
 	"time"
 
+	"github.com/otaviokr/spacetraders-ship/gameerror"
+	"github.com/otaviokr/spacetraders-ship/logging"
 	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// ErrNoReply means the request was sent, but no reply arrived in time. The game may or may not have processed it.
+var ErrNoReply = fmt.Errorf("%w: no reply received", gameerror.ErrUnavailable)
+
+const (
+	// DefaultReplyTimeout is how long a request waits for its reply, if nothing else is configured.
+	DefaultReplyTimeout = 10 * time.Second
+
+	// requestIdHeader identifies the request in the Kafka headers. If the gateway copies it to the reply, the reply is
+	// delivered to the request that asked for it; otherwise, replies are delivered in the order the requests were sent.
+	requestIdHeader = "request-id"
+)
+
+// messageReader is the part of kafka.Reader used by the proxy.
+type messageReader interface {
+	ReadMessage(ctx context.Context) (kafka.Message, error)
+	Close() error
+}
+
+// messageWriter is the part of kafka.Writer used by the proxy.
+type messageWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// AutomaticPartition lets Kafka decide the partition: by the ship ID (the message key) when writing, and by the
+// consumer group when reading.
+const AutomaticPartition = -1
+
+// DefaultGroupPrefix is prepended to the ship ID to name its consumer group, if no group is configured.
+const DefaultGroupPrefix = "spacetraders-ship-"
+
+// Config defines how to connect to Kafka.
+type Config struct {
+	// Network is the network type, usually "tcp".
+	Network string `yaml:"network"`
+	// Brokers is the list of host:port to bootstrap the connection.
+	Brokers    []string `yaml:"brokers"`
+	TopicRead  string   `yaml:"topicRead"`
+	TopicWrite string   `yaml:"topicWrite"`
+	// GroupID is the consumer group used to read the replies. Each ship must have its own group, since it only wants
+	// its own replies; if empty, DefaultGroupPrefix followed by the ship ID is used.
+	GroupID string `yaml:"groupId"`
+	// PartitionRead and PartitionWrite pin the proxy to a single partition. Use AutomaticPartition (the default) to
+	// rely on the consumer group and on the message key instead.
+	PartitionRead  int `yaml:"partitionRead"`
+	PartitionWrite int `yaml:"partitionWrite"`
+	// ReplyTimeout is how long a request waits for its reply. If zero, DefaultReplyTimeout is used.
+	ReplyTimeout time.Duration `yaml:"replyTimeout"`
+	TLS          TLSConfig     `yaml:"tls"`
+	SASL         SASLConfig    `yaml:"sasl"`
+}
+
+// DefaultConfig returns the configuration for a local broker, with automatic partitions.
+func DefaultConfig() Config {
+	return Config{
+		Network:        "tcp",
+		Brokers:        []string{"localhost:9092"},
+		PartitionRead:  AutomaticPartition,
+		PartitionWrite: AutomaticPartition,
+		ReplyTimeout:   DefaultReplyTimeout,
+	}
+}
+
+// KafkaProxy sends the requests to the gateway through Kafka. The replies are consumed in the background, and handed
+// to the waiting request as soon as they arrive.
+//
+// The requests are keyed by the ship ID, so all requests of a ship land on the same partition, in order. The gateway is
+// expected to key the replies the same way; replies for other ships are ignored. When reading through a consumer group,
+// the replies of every ship come in, so a reply that has neither the key of the ship nor the id of one of its requests
+// cannot be told apart and is ignored too.
 type KafkaProxy struct {
 	id       string
 	Consumer *KafkaDetails
 	Producer *KafkaDetails
+	// ReplyTimeout is how long a request waits for its reply before failing with ErrNoReply.
+	ReplyTimeout time.Duration
+
+	reader messageReader
+	writer messageWriter
+	tracer trace.Tracer
+	cancel context.CancelFunc
+	done   chan struct{}
+	// grouped is set when the replies are read through a consumer group, from every partition of the topic, instead of
+	// from a partition pinned to the ship.
+	grouped bool
+
+	// started is when the proxy was created; replies produced before belong to a previous run of the ship (e.g., read
+	// again from the offset committed by the consumer group), and are ignored.
+	started time.Time
+	// requestPrefix starts the id of every request, unique to this run so the replies to a previous run never match.
+	requestPrefix string
+
+	mu       sync.Mutex
+	waiting  []*waiter
+	sequence uint64
+	// abandoned are the requests that timed out without a reply, oldest first. Their replies may still arrive; a late
+	// reply without request id is discarded in their place, instead of being handed to the next request.
+	abandoned []abandonedRequest
+}
+
+// abandonedRequest is a request that timed out, and when. Its reply is only expected for another ReplyTimeout; after
+// that, it is taken as lost, so a lost reply does not make the proxy discard the reply of another request.
+type abandonedRequest struct {
+	requestId string
+	at        time.Time
 }
 
 type KafkaDetails struct {
 	Topic     string
 	Partition int
-	conn      *kafka.Conn
-}
-
-func NewKafkaProxy(
-	ctx context.Context, id, connectionType, hostname,
-	topicRead string, partitionRead int,
-	topicWrite string, partitionWrite int) Proxy {
-	return &KafkaProxy{
-		id: id,
-		Consumer: dialLeader(
-			context.WithValue(ctx, "kafkaproxy", "consumer"),
-			connectionType,
-			hostname,
-			topicRead,
-			partitionRead),
-		Producer: dialLeader(
-			context.WithValue(ctx, "kafkaproxy", "producer"),
-			connectionType,
-			hostname,
-			topicWrite,
-			partitionWrite),
-	}
-}
-
-func dialLeader(ctx context.Context, connectionType, hostname, topic string, partition int) *KafkaDetails {
-	conn, err := kafka.DialLeader(ctx, connectionType, hostname, topic, partition)
+	GroupID   string
+}
+
+// waiter is a request waiting for its reply.
+type waiter struct {
+	requestId string
+	reply     chan kafka.Message
+}
+
+// tracerName identifies the spans created by the proxy.
+const tracerName = "github.com/otaviokr/spacetraders-ship/kafka"
+
+// propagator writes the trace context in the W3C format (traceparent and tracestate headers), so the gateway can
+// continue the trace of the ship.
+var propagator = propagation.TraceContext{}
+
+// headerCarrier lets the propagator read and write the Kafka message headers.
+type headerCarrier struct {
+	headers *[]kafka.Header
+}
+
+func (c headerCarrier) Get(key string) string {
+	for _, header := range *c.headers {
+		if header.Key == key {
+			return string(header.Value)
+		}
+	}
+	return ""
+}
+
+func (c headerCarrier) Set(key, value string) {
+	for i, header := range *c.headers {
+		if header.Key == key {
+			(*c.headers)[i].Value = []byte(value)
+			return
+		}
+	}
+	*c.headers = append(*c.headers, kafka.Header{Key: key, Value: []byte(value)})
+}
+
+func (c headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(*c.headers))
+	for _, header := range *c.headers {
+		keys = append(keys, header.Key)
+	}
+	return keys
+}
+
+// fixedPartition is a kafka.Balancer that always writes to the same partition.
+type fixedPartition int
+
+func (p fixedPartition) Balance(msg kafka.Message, partitions ...int) int {
+	return int(p)
+}
+
+// NewKafkaProxy connects to Kafka and starts consuming the replies. The configuration is validated and the brokers are
+// contacted before returning, so a bad address, certificate or credential fails here, not on the first request.
+func NewKafkaProxy(ctx context.Context, id string, config Config) (*KafkaProxy, error) {
+	if len(config.Brokers) < 1 {
+		return nil, fmt.Errorf("kafka: no broker configured")
+	}
+	if len(config.TopicRead) < 1 || len(config.TopicWrite) < 1 {
+		return nil, fmt.Errorf("kafka: both the read and write topics are required")
+	}
+
+	dialer, transport, err := config.security()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := dialer.DialContext(ctx, config.Network, config.Brokers[0])
 	if err != nil {
-		log.Fatal("failed to dial leader:", err)
+		return nil, fmt.Errorf("kafka: connecting to %s: %w", config.Brokers[0], err)
+	}
+	conn.Close()
+
+	var balancer kafka.Balancer = &kafka.Hash{}
+	if config.PartitionWrite != AutomaticPartition {
+		balancer = fixedPartition(config.PartitionWrite)
+	}
+
+	writer := &kafka.Writer{
+		Addr:         kafka.TCP(config.Brokers...),
+		Topic:        config.TopicWrite,
+		Balancer:     balancer,
+		Transport:    transport,
+		RequiredAcks: kafka.RequireOne,
+		// Requests are sent one at a time, there is no point in waiting for a batch.
+		BatchTimeout: time.Millisecond,
+		WriteTimeout: 10 * time.Second,
+	}
+
+	readerConfig := kafka.ReaderConfig{
+		Brokers:  config.Brokers,
+		Topic:    config.TopicRead,
+		Dialer:   dialer,
+		MinBytes: 1,
+		MaxBytes: 1e6, // 1e6 == 10^6 (1MB)
+		MaxWait:  100 * time.Millisecond,
+	}
+
+	consumer := &KafkaDetails{Topic: config.TopicRead, Partition: config.PartitionRead}
+	if config.PartitionRead == AutomaticPartition {
+		consumer.GroupID = config.GroupID
+		if len(consumer.GroupID) < 1 {
+			consumer.GroupID = DefaultGroupPrefix + id
+		}
+		readerConfig.GroupID = consumer.GroupID
+		// A new group only cares about the replies to the requests sent from now on.
+		readerConfig.StartOffset = kafka.LastOffset
+	} else {
+		readerConfig.Partition = config.PartitionRead
+	}
+	reader := kafka.NewReader(readerConfig)
+
+	if config.PartitionRead != AutomaticPartition {
+		// Only the replies to the requests sent from now on matter.
+		offset, err := lastOffset(ctx, dialer, config.Network, config.Brokers[0], config.TopicRead, config.PartitionRead)
+		if err == nil {
+			err = reader.SetOffset(offset)
+		}
+		if err != nil {
+			reader.Close()
+			return nil, fmt.Errorf("kafka: reading last offset of %s/%d: %w", config.TopicRead, config.PartitionRead, err)
+		}
+	}
+
+	kp := newKafkaProxy(ctx, id, writer, reader)
+	if config.ReplyTimeout > 0 {
+		kp.ReplyTimeout = config.ReplyTimeout
+	}
+	kp.Consumer = consumer
+	kp.grouped = config.PartitionRead == AutomaticPartition
+	kp.Producer = &KafkaDetails{Topic: config.TopicWrite, Partition: config.PartitionWrite}
+	return kp, nil
+}
+
+// newKafkaProxy creates the proxy and starts consuming the replies in the background.
+func newKafkaProxy(ctx context.Context, id string, writer messageWriter, reader messageReader) *KafkaProxy {
+	consumerCtx, cancel := context.WithCancel(ctx)
+	started := time.Now()
+	kp := &KafkaProxy{
+		id:            id,
+		ReplyTimeout:  DefaultReplyTimeout,
+		reader:        reader,
+		writer:        writer,
+		tracer:        otel.Tracer(tracerName),
+		cancel:        cancel,
+		done:          make(chan struct{}),
+		started:       started,
+		requestPrefix: id + "-" + strconv.FormatInt(started.UnixNano(), 36) + "-",
 	}
+	go kp.consume(consumerCtx)
+	return kp
+}
 
-	return &KafkaDetails{
-		Topic:     topic,
-		Partition: partition,
-		conn:      conn,
+// lastOffset asks the leader of the partition for the offset of the next message.
+func lastOffset(ctx context.Context, dialer *kafka.Dialer, network, broker, topic string, partition int) (int64, error) {
+	conn, err := dialer.DialLeader(context.WithValue(ctx, "kafkaproxy", "consumer"), network, broker, topic, partition)
+	if err != nil {
+		return 0, err
 	}
+	defer conn.Close()
+	return conn.ReadLastOffset()
 }
 
 func (kp *KafkaProxy) Write(key, msg string) error {
-	kp.Producer.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
-	_, err := kp.Producer.conn.WriteMessages(kafka.Message{Key: []byte(key), Value: []byte(msg)})
-	// if err != nil {
-	// 	log.Fatal("failed to write messages:", err)
-	// }
-	return err
+	return kp.write(kafka.Message{Key: []byte(key), Value: []byte(msg)})
+}
+
+// write sends the message to the gateway.
+func (kp *KafkaProxy) write(msg kafka.Message) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return kp.writer.WriteMessages(ctx, msg)
 }
 
-func (kp *KafkaProxy) Read() []byte {
-	kp.Consumer.conn.SetReadDeadline(time.Now().Add(10 * time.Second))
-	msg, err := kp.Consumer.conn.ReadMessage(1e6) // 1e6 == 10^6 (1MB)
+// request sends the message to the gateway and waits for the reply.
+//
+// The request is traced as a child of the span in the context, and the trace context goes in the message headers. If
+// the gateway sends its own trace context back in the reply, the reply span is linked to it.
+func (kp *KafkaProxy) request(ctx context.Context, action, payload string) ([]byte, error) {
+	attributes := []attribute.KeyValue{
+		semconv.MessagingSystemKey.String("kafka"),
+		attribute.Key("messaging.kafka.message_key").String(kp.id),
+		attribute.Key("action").String(action),
+	}
+	if kp.Producer != nil {
+		attributes = append(attributes, semconv.MessagingDestinationKey.String(kp.Producer.Topic))
+	}
+	requestCtx, span := kp.tracer.Start(
+		ctx,
+		"Kafka "+action,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(attributes...))
+	defer span.End()
+
+	w := kp.wait()
+	span.SetAttributes(semconv.MessagingMessageIDKey.String(w.requestId))
+
+	msg := kafka.Message{
+		Key:     []byte(kp.id),
+		Value:   []byte(payload),
+		Headers: []kafka.Header{{Key: requestIdHeader, Value: []byte(w.requestId)}},
+	}
+	propagator.Inject(requestCtx, headerCarrier{&msg.Headers})
+
+	reply, err := kp.send(msg, w)
 	if err != nil {
-		log.Fatal("failed to write messages:", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	kp.traceReply(requestCtx, reply)
+	return reply.Value, nil
+}
+
+// send writes the message and waits for the reply.
+func (kp *KafkaProxy) send(msg kafka.Message, w *waiter) (kafka.Message, error) {
+	if err := kp.write(msg); err != nil {
+		kp.forget(w)
+		return kafka.Message{}, fmt.Errorf("%w: %v", gameerror.ErrUnavailable, err)
+	}
+
+	timer := time.NewTimer(kp.ReplyTimeout)
+	defer timer.Stop()
+
+	select {
+	case reply := <-w.reply:
+		return reply, nil
+	case <-timer.C:
+		if !kp.abandon(w) {
+			// The reply arrived right before the request was abandoned.
+			return <-w.reply, nil
+		}
+		return kafka.Message{}, fmt.Errorf("%w: waited %s for %s", ErrNoReply, kp.ReplyTimeout, w.requestId)
+	case <-kp.done:
+		kp.forget(w)
+		return kafka.Message{}, fmt.Errorf("%w: proxy closed", ErrNoReply)
+	}
+}
+
+// traceReply records the reply as a child of the request span, linked to the span of the gateway (if it sent one), so
+// the time spent by the gateway and the game shows up in the trace of the ship.
+func (kp *KafkaProxy) traceReply(ctx context.Context, reply kafka.Message) {
+	options := []trace.SpanStartOption{
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			semconv.MessagingSystemKey.String("kafka"),
+			semconv.MessagingOperationReceive,
+			semconv.MessagingKafkaPartitionKey.Int(reply.Partition),
+			attribute.Key("messaging.kafka.offset").Int64(reply.Offset)),
+	}
+
+	gateway := trace.SpanContextFromContext(propagator.Extract(context.Background(), headerCarrier{&reply.Headers}))
+	if gateway.IsValid() {
+		options = append(options, trace.WithLinks(trace.Link{SpanContext: gateway}))
+	}
+
+	_, span := kp.tracer.Start(ctx, "Kafka reply", options...)
+	if !reply.Time.IsZero() {
+		span.AddEvent("Reply produced", trace.WithTimestamp(reply.Time))
+	}
+	span.End()
+}
+
+// wait registers a new request waiting for its reply. It must be done before the request is sent, or a fast reply
+// could be dispatched before anyone is waiting for it.
+func (kp *KafkaProxy) wait() *waiter {
+	kp.mu.Lock()
+	defer kp.mu.Unlock()
+
+	kp.sequence++
+	w := &waiter{
+		requestId: kp.requestPrefix + strconv.FormatUint(kp.sequence, 10),
+		reply:     make(chan kafka.Message, 1),
+	}
+	kp.waiting = append(kp.waiting, w)
+	return w
+}
+
+// forget removes the request from the waiting list, so its reply (if it ever arrives) is discarded.
+func (kp *KafkaProxy) forget(w *waiter) {
+	kp.mu.Lock()
+	defer kp.mu.Unlock()
+	kp.remove(w)
+}
+
+// abandon forgets the request that timed out, expecting its reply to arrive late, so it is discarded. It tells if the
+// request was still waiting; if not, its reply is already in the channel.
+func (kp *KafkaProxy) abandon(w *waiter) bool {
+	kp.mu.Lock()
+	defer kp.mu.Unlock()
+	if !kp.remove(w) {
+		return false
+	}
+	kp.abandoned = append(kp.abandoned, abandonedRequest{requestId: w.requestId, at: time.Now()})
+	return true
+}
+
+// remove takes the request out of the waiting list, telling if it was there. The lock must be held.
+func (kp *KafkaProxy) remove(w *waiter) bool {
+	for i, other := range kp.waiting {
+		if other == w {
+			kp.waiting = append(kp.waiting[:i], kp.waiting[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// consume reads the replies until the proxy is closed, handing them to the waiting requests.
+func (kp *KafkaProxy) consume(ctx context.Context) {
+	defer close(kp.done)
+
+	for {
+		msg, err := kp.reader.ReadMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, io.EOF) {
+				return
+			}
+			logging.Error(ctx, "Could not read the replies", "error", err)
+
+			// Don't spin if the broker is down.
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+
+		kp.dispatch(msg)
+	}
+}
+
+// dispatch hands the reply to the request it belongs to: the one with the same request id, if the reply has it, or
+// the oldest one waiting otherwise. Replies nobody is waiting for (e.g., arriving after the timeout) are discarded, as
+// are the replies with neither key nor request id read through a consumer group, since they may be for any ship, and
+// the replies produced before the proxy started. A reply without request id is taken as the late reply of the oldest request abandoned, if any, since the replies
+// come in the order of the requests; otherwise every reply after it would go to the wrong request.
+func (kp *KafkaProxy) dispatch(msg kafka.Message) {
+	if len(msg.Key) > 0 && string(msg.Key) != kp.id {
+		// Reply to another ship sharing the partition.
+		return
+	}
+	if !msg.Time.IsZero() && msg.Time.Before(kp.started) {
+		logging.Warn(context.Background(), "Discarding reply from before the start", "produced_at", msg.Time,
+			"bytes", len(msg.Value))
+		return
+	}
+
+	requestId := ""
+	for _, header := range msg.Headers {
+		if header.Key == requestIdHeader {
+			requestId = string(header.Value)
+		}
 	}
+	if kp.grouped && len(msg.Key) < 1 && len(requestId) < 1 {
+		logging.Warn(context.Background(), "Discarding reply without key nor request id", "bytes", len(msg.Value))
+		return
+	}
+
+	kp.mu.Lock()
+	defer kp.mu.Unlock()
 
-	return msg.Value
+	for len(kp.abandoned) > 0 && time.Since(kp.abandoned[0].at) > kp.ReplyTimeout {
+		kp.abandoned = kp.abandoned[1:]
+	}
+	if len(requestId) < 1 && len(kp.abandoned) > 0 {
+		logging.Warn(context.Background(), "Discarding late reply of a request that timed out",
+			"request_id", kp.abandoned[0].requestId, "bytes", len(msg.Value))
+		kp.abandoned = kp.abandoned[1:]
+		return
+	}
+	for i, abandoned := range kp.abandoned {
+		if abandoned.requestId == requestId {
+			logging.Warn(context.Background(), "Discarding late reply of a request that timed out",
+				"request_id", requestId, "bytes", len(msg.Value))
+			kp.abandoned = append(kp.abandoned[:i], kp.abandoned[i+1:]...)
+			return
+		}
+	}
+
+	index := -1
+	for i, w := range kp.waiting {
+		if len(requestId) < 1 || w.requestId == requestId {
+			index = i
+			break
+		}
+	}
+
+	if index < 0 {
+		logging.Warn(context.Background(), "Discarding reply nobody is waiting for", "request_id", requestId,
+			"bytes", len(msg.Value))
+		return
+	}
+
+	w := kp.waiting[index]
+	kp.waiting = append(kp.waiting[:index], kp.waiting[index+1:]...)
+	w.reply <- msg
 }
 
-func (kp *KafkaProxy) Close() {
-	if err := kp.Producer.conn.Close(); err != nil {
-		log.Fatal("failed to close writer:", err)
+// Close stops consuming the replies and closes the connections.
+func (kp *KafkaProxy) Close() error {
+	kp.cancel()
+	readerErr := kp.reader.Close()
+	<-kp.done
+
+	if err := kp.writer.Close(); err != nil {
+		return fmt.Errorf("failed to close writer: %w", err)
 	}
-	if err := kp.Consumer.conn.Close(); err != nil {
-		log.Fatal("failed to close reader:", err)
+	if readerErr != nil {
+		return fmt.Errorf("failed to close reader: %w", readerErr)
 	}
+	return nil
 }
@@ -0,0 +1,342 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/otaviokr/spacetraders-ship/gameerror"
+	"github.com/segmentio/kafka-go"
+	traceSdk "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// fakeReader delivers the messages sent to its channel.
+type fakeReader struct {
+	messages chan kafka.Message
+	closed   chan struct{}
+	once     sync.Once
+}
+
+func newFakeReader() *fakeReader {
+	return &fakeReader{messages: make(chan kafka.Message, 10), closed: make(chan struct{})}
+}
+
+func (r *fakeReader) ReadMessage(ctx context.Context) (kafka.Message, error) {
+	select {
+	case msg := <-r.messages:
+		return msg, nil
+	case <-r.closed:
+		return kafka.Message{}, io.EOF
+	case <-ctx.Done():
+		return kafka.Message{}, ctx.Err()
+	}
+}
+
+func (r *fakeReader) Close() error {
+	r.once.Do(func() { close(r.closed) })
+	return nil
+}
+
+// fakeWriter answers each message with the reply function, as the gateway would.
+type fakeWriter struct {
+	reply func(msg kafka.Message)
+	err   error
+}
+
+func (w *fakeWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	if w.err != nil {
+		return w.err
+	}
+	for _, msg := range msgs {
+		if w.reply != nil {
+			w.reply(msg)
+		}
+	}
+	return nil
+}
+
+func (w *fakeWriter) Close() error { return nil }
+
+func requestId(msg kafka.Message) string {
+	for _, header := range msg.Headers {
+		if header.Key == requestIdHeader {
+			return string(header.Value)
+		}
+	}
+	return ""
+}
+
+func TestKafkaProxyRequest(t *testing.T) {
+	useCases := map[string]map[string]interface{}{
+		"reply with request id": {
+			"reply": func(reader *fakeReader) func(kafka.Message) {
+				return func(msg kafka.Message) {
+					// A stale reply to a request that timed out, then the right one.
+					reader.messages <- kafka.Message{Value: []byte("stale"), Headers: []kafka.Header{{Key: requestIdHeader, Value: []byte("id0001-0")}}}
+					reader.messages <- kafka.Message{Value: []byte("reply"), Headers: []kafka.Header{{Key: requestIdHeader, Value: []byte(requestId(msg))}}}
+				}
+			},
+			"expected": "reply",
+			"err":      nil},
+		"reply to a previous run": {
+			"reply": func(reader *fakeReader) func(kafka.Message) {
+				return func(msg kafka.Message) {
+					// Read again after a restart: produced before the start, or for the request with the same number.
+					previous := strings.Replace(requestId(msg), strings.Split(requestId(msg), "-")[1], "previous", 1)
+					reader.messages <- kafka.Message{Value: []byte("stale"), Time: time.Now().Add(-time.Minute)}
+					reader.messages <- kafka.Message{Value: []byte("stale"), Headers: []kafka.Header{{Key: requestIdHeader, Value: []byte(previous)}}}
+					reader.messages <- kafka.Message{Value: []byte("reply"), Headers: []kafka.Header{{Key: requestIdHeader, Value: []byte(requestId(msg))}}}
+				}
+			},
+			"expected": "reply",
+			"err":      nil},
+		"reply without request id": {
+			"reply": func(reader *fakeReader) func(kafka.Message) {
+				return func(msg kafka.Message) {
+					reader.messages <- kafka.Message{Value: []byte("reply")}
+				}
+			},
+			"expected": "reply",
+			"err":      nil},
+		"reply to another ship": {
+			"reply": func(reader *fakeReader) func(kafka.Message) {
+				return func(msg kafka.Message) {
+					// The request is keyed by the ship, so it lands on the same partition as the other requests of the ship.
+					if string(msg.Key) != "id0001" {
+						panic("request not keyed by the ship id: " + string(msg.Key))
+					}
+					reader.messages <- kafka.Message{Key: []byte("id0002"), Value: []byte("other")}
+					reader.messages <- kafka.Message{Key: []byte("id0001"), Value: []byte("reply")}
+				}
+			},
+			"expected": "reply",
+			"err":      nil},
+		"no reply": {
+			"reply": func(reader *fakeReader) func(kafka.Message) {
+				return nil
+			},
+			"expected": "",
+			"err":      ErrNoReply}}
+
+	for name, uc := range useCases {
+		reader := newFakeReader()
+		writer := &fakeWriter{reply: uc["reply"].(func(*fakeReader) func(kafka.Message))(reader)}
+		kp := newKafkaProxy(context.Background(), "id0001", writer, reader)
+		kp.ReplyTimeout = 100 * time.Millisecond
+
+		start := time.Now()
+		data, err := kp.GetShipInfo(context.TODO())
+		expectedErr, _ := uc["err"].(error)
+		if !errors.Is(err, expectedErr) || (expectedErr == nil && err != nil) {
+			t.Fatalf("%s\nACTUAL: %v\nEXPECT: %v\n", name, err, expectedErr)
+		}
+		if string(data) != uc["expected"].(string) {
+			t.Fatalf("%s\nACTUAL: %s\nEXPECT: %s\n", name, data, uc["expected"])
+		}
+		if expectedErr == nil && time.Since(start) >= kp.ReplyTimeout {
+			t.Fatalf("%s: the reply should be delivered as soon as it arrives, took %s", name, time.Since(start))
+		}
+
+		if err = kp.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestKafkaProxyWriteFailure(t *testing.T) {
+	reader := newFakeReader()
+	kp := newKafkaProxy(context.Background(), "id0001", &fakeWriter{err: errors.New("broker down")}, reader)
+	defer kp.Close()
+
+	if _, err := kp.GetShipInfo(context.TODO()); !errors.Is(err, gameerror.ErrUnavailable) {
+		t.Fatalf("\nACTUAL: %v\nEXPECT: %v\n", err, gameerror.ErrUnavailable)
+	}
+	if len(kp.waiting) != 0 {
+		t.Fatalf("\nACTUAL: %d waiting\nEXPECT: 0 waiting\n", len(kp.waiting))
+	}
+}
+
+func TestKafkaProxyLateReply(t *testing.T) {
+	useCases := map[string]map[string]interface{}{
+		"late reply without request id": {
+			"withId": false,
+			"wait":   time.Duration(0),
+		},
+		"late reply with request id": {
+			"withId": true,
+			"wait":   time.Duration(0),
+		},
+		"reply lost": {
+			// The first reply never arrives: once it is no longer expected, the next reply is not discarded for it.
+			"lost": true,
+			"wait": 250 * time.Millisecond,
+		},
+	}
+
+	for name, uc := range useCases {
+		reader := newFakeReader()
+		requests := 0
+		writer := &fakeWriter{reply: func(msg kafka.Message) {
+			requests++
+			if requests == 1 {
+				// The gateway is too slow for the first request.
+				return
+			}
+			reader.messages <- kafka.Message{Value: []byte("reply" + strconv.Itoa(requests))}
+		}}
+		kp := newKafkaProxy(context.Background(), "id0001", writer, reader)
+		kp.ReplyTimeout = 100 * time.Millisecond
+
+		if _, err := kp.GetShipInfo(context.TODO()); !errors.Is(err, ErrNoReply) {
+			t.Fatalf("%s\nACTUAL: %v\nEXPECT: %v\n", name, err, ErrNoReply)
+		}
+		if lost, _ := uc["lost"].(bool); !lost {
+			late := kafka.Message{Value: []byte("reply1")}
+			if uc["withId"].(bool) {
+				late.Headers = []kafka.Header{{Key: requestIdHeader, Value: []byte(kp.requestPrefix + "1")}}
+			}
+			reader.messages <- late
+		}
+		time.Sleep(uc["wait"].(time.Duration))
+
+		for _, expected := range []string{"reply2", "reply3"} {
+			data, err := kp.GetShipInfo(context.TODO())
+			if err != nil || string(data) != expected {
+				t.Fatalf("%s\nACTUAL: %s (%v)\nEXPECT: %s\n", name, data, err, expected)
+			}
+		}
+		if err := kp.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestKafkaProxyGroup(t *testing.T) {
+	useCases := map[string]map[string]interface{}{
+		"reply to anyone": {
+			"replies":  []kafka.Message{{Value: []byte("other")}},
+			"expected": "",
+			"err":      ErrNoReply,
+		},
+		"keyed reply": {
+			"replies":  []kafka.Message{{Value: []byte("other")}, {Key: []byte("id0001"), Value: []byte("reply")}},
+			"expected": "reply",
+			"err":      nil,
+		},
+		"reply with request id": {
+			"replies":  []kafka.Message{{Value: []byte("other")}, {Value: []byte("reply")}},
+			"withId":   true,
+			"expected": "reply",
+			"err":      nil,
+		},
+	}
+
+	for name, uc := range useCases {
+		reader := newFakeReader()
+		writer := &fakeWriter{reply: func(msg kafka.Message) {
+			replies := uc["replies"].([]kafka.Message)
+			for i, reply := range replies {
+				if withId, _ := uc["withId"].(bool); withId && i == len(replies)-1 {
+					reply.Headers = []kafka.Header{{Key: requestIdHeader, Value: []byte(requestId(msg))}}
+				}
+				reader.messages <- reply
+			}
+		}}
+		kp := newKafkaProxy(context.Background(), "id0001", writer, reader)
+		kp.ReplyTimeout = 100 * time.Millisecond
+		kp.grouped = true
+
+		data, err := kp.GetShipInfo(context.TODO())
+		expectedErr, _ := uc["err"].(error)
+		if !errors.Is(err, expectedErr) || (expectedErr == nil && err != nil) || string(data) != uc["expected"].(string) {
+			t.Fatalf("%s\nACTUAL: %s (%v)\nEXPECT: %s (%v)\n", name, data, err, uc["expected"], expectedErr)
+		}
+		if err = kp.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestKafkaProxyConcurrentRequests(t *testing.T) {
+	reader := newFakeReader()
+	writer := &fakeWriter{reply: func(msg kafka.Message) {
+		reader.messages <- kafka.Message{Value: msg.Value, Headers: []kafka.Header{{Key: requestIdHeader, Value: []byte(requestId(msg))}}}
+	}}
+	kp := newKafkaProxy(context.Background(), "id0001", writer, reader)
+	defer kp.Close()
+
+	var wg sync.WaitGroup
+	for _, location := range []string{"Local0001", "Local0002", "Local0003", "Local0004"} {
+		wg.Add(1)
+		go func(location string) {
+			defer wg.Done()
+			data, err := kp.GetMarketplaceProducts(context.TODO(), location)
+			expected := "{\"action\": \"GetMarketplaceInfo\", \"id\": \"id0001\", \"location\": \"" + location + "\"}"
+			if err != nil || string(data) != expected {
+				t.Errorf("\nACTUAL: %s (%v)\nEXPECT: %s\n", data, err, expected)
+			}
+		}(location)
+	}
+	wg.Wait()
+}
+
+func TestKafkaProxyTraceContext(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := traceSdk.NewTracerProvider(traceSdk.WithSpanProcessor(recorder))
+
+	// The gateway continues the trace from the request headers, and sends its own span back in the reply.
+	gateway := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x01},
+		SpanID:     trace.SpanID{0x02},
+		TraceFlags: trace.FlagsSampled,
+	})
+	var traceparent string
+	reader := newFakeReader()
+	writer := &fakeWriter{reply: func(msg kafka.Message) {
+		traceparent = headerCarrier{&msg.Headers}.Get("traceparent")
+		reply := kafka.Message{Key: msg.Key, Value: []byte("reply")}
+		propagator.Inject(trace.ContextWithSpanContext(context.Background(), gateway), headerCarrier{&reply.Headers})
+		reader.messages <- reply
+	}}
+	kp := newKafkaProxy(context.Background(), "id0001", writer, reader)
+	kp.tracer = provider.Tracer("")
+	defer kp.Close()
+
+	ctx, parent := provider.Tracer("").Start(context.Background(), "Get Ship Details")
+	if _, err := kp.GetShipInfo(ctx); err != nil {
+		t.Fatal(err)
+	}
+	parent.End()
+
+	spans := map[string]traceSdk.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	request, reply := spans["Kafka GetShipInfo"], spans["Kafka reply"]
+	if request == nil || reply == nil {
+		t.Fatalf("\nACTUAL: %v\nEXPECT: request and reply spans\n", spans)
+	}
+
+	if request.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Fatalf("\nACTUAL: %s\nEXPECT: %s\n", request.Parent().SpanID(), parent.SpanContext().SpanID())
+	}
+
+	expected := "00-" + request.SpanContext().TraceID().String() + "-" + request.SpanContext().SpanID().String() + "-01"
+	if traceparent != expected {
+		t.Fatalf("\nACTUAL: %s\nEXPECT: %s\n", traceparent, expected)
+	}
+
+	if reply.Parent().SpanID() != request.SpanContext().SpanID() {
+		t.Fatalf("\nACTUAL: %s\nEXPECT: %s\n", reply.Parent().SpanID(), request.SpanContext().SpanID())
+	}
+	if len(reply.Links()) != 1 || reply.Links()[0].SpanContext.SpanID() != gateway.SpanID() {
+		t.Fatalf("\nACTUAL: %+v\nEXPECT: link to %s\n", reply.Links(), gateway.SpanID())
+	}
+}
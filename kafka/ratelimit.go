@@ -0,0 +1,248 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/otaviokr/spacetraders-ship/gameerror"
+	"github.com/otaviokr/spacetraders-ship/logging"
+	"github.com/otaviokr/spacetraders-ship/web"
+)
+
+// DefaultRateLimitPause is how long all requests are held when the game rate limits us without saying for how long.
+const DefaultRateLimitPause = 1 * time.Second
+
+// MaxRateLimitRequeues is how many times a rate limited request is queued again before the rate limited response is
+// returned, so a game that keeps rate limiting us does not hold the ship forever.
+const MaxRateLimitRequeues = 3
+
+// RateLimiter is a token bucket shared by all ships using the same account, since the game limits requests per token.
+type RateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+	sleep  func(context.Context, time.Duration) error
+}
+
+var (
+	rateLimitersMu sync.Mutex
+	rateLimiters   = map[string]*RateLimiter{}
+)
+
+// NewRateLimiter creates a token bucket allowing rate requests per second, with bursts of up to burst requests.
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &RateLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+		now:    time.Now,
+		sleep:  sleepContext,
+	}
+}
+
+// SharedRateLimiter returns the rate limiter for the key (usually, the account token), creating it if needed. All ships
+// running in this process with the same key share the same bucket.
+func SharedRateLimiter(key string, rate float64, burst int) *RateLimiter {
+	rateLimitersMu.Lock()
+	defer rateLimitersMu.Unlock()
+
+	if rl, ok := rateLimiters[key]; ok {
+		return rl
+	}
+	rl := NewRateLimiter(rate, burst)
+	rateLimiters[key] = rl
+	return rl
+}
+
+// Wait blocks until a request can be sent, returning how long it waited. If the context ends first, the turn is given
+// back to the bucket and the error of the context is returned.
+func (rl *RateLimiter) Wait(ctx context.Context) (time.Duration, error) {
+	wait := rl.reserve()
+	if wait > 0 {
+		if err := rl.sleep(ctx, wait); err != nil {
+			rl.release()
+			return wait, err
+		}
+	}
+	return wait, nil
+}
+
+// Pause holds all requests for the given time, e.g., when the game tells us to slow down.
+func (rl *RateLimiter) Pause(d time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := rl.now()
+	rl.refill(now)
+	if until := now.Add(d); until.After(rl.last) {
+		rl.last = until
+	}
+	if rl.tokens > 0 {
+		rl.tokens = 0
+	}
+}
+
+// reserve takes a token from the bucket, returning how long the caller must wait before using it.
+func (rl *RateLimiter) reserve() time.Duration {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if rl.rate <= 0 {
+		// Rate limit disabled.
+		return 0
+	}
+
+	now := rl.now()
+	rl.refill(now)
+	rl.tokens--
+
+	var wait time.Duration
+	if rl.last.After(now) {
+		wait = rl.last.Sub(now)
+	}
+	if rl.tokens < 0 {
+		wait += time.Duration(-rl.tokens / rl.rate * float64(time.Second))
+	}
+	return wait
+}
+
+// release gives back a token taken by reserve but not used.
+func (rl *RateLimiter) release() {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if rl.rate > 0 {
+		rl.tokens++
+	}
+}
+
+// refill adds the tokens generated since the last refill. Nothing is added while the bucket is paused.
+func (rl *RateLimiter) refill(now time.Time) {
+	if !now.After(rl.last) {
+		return
+	}
+
+	rl.tokens += now.Sub(rl.last).Seconds() * rl.rate
+	if rl.tokens > rl.burst {
+		rl.tokens = rl.burst
+	}
+	rl.last = now
+}
+
+// sleepContext waits for the given time, or until the context ends.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// RateLimitedProxy wraps another Proxy, queueing the requests so the game does not rate limit us. If it does anyway,
+// the whole bucket is paused for as long as the game asked and the request is queued again, up to MaxRateLimitRequeues
+// times; after that, the rate limited response is returned (see RetryProxy to try it again later).
+type RateLimitedProxy struct {
+	proxy   Proxy
+	id      string
+	limiter *RateLimiter
+}
+
+// NewRateLimitedProxy creates a new instance of RateLimitedProxy. The id is only used to label the metrics.
+func NewRateLimitedProxy(proxy Proxy, id string, limiter *RateLimiter) *RateLimitedProxy {
+	return &RateLimitedProxy{
+		proxy:   proxy,
+		id:      id,
+		limiter: limiter,
+	}
+}
+
+// GetShipInfo collects information about specific ship.
+func (rp *RateLimitedProxy) GetShipInfo(ctx context.Context) ([]byte, error) {
+	return rp.do(ctx, "GetShipInfo", func() ([]byte, error) {
+		return rp.proxy.GetShipInfo(ctx)
+	})
+}
+
+// GetMarketplaceProducts gathers information about products available to trade in the planet where the ship is.
+func (rp *RateLimitedProxy) GetMarketplaceProducts(ctx context.Context, location string) ([]byte, error) {
+	return rp.do(ctx, "GetMarketplaceProducts", func() ([]byte, error) {
+		return rp.proxy.GetMarketplaceProducts(ctx, location)
+	})
+}
+
+// SetNewFlightPlan sends to game a new destination where the ships needs to fly to.
+func (rp *RateLimitedProxy) SetNewFlightPlan(ctx context.Context, destination string) ([]byte, error) {
+	return rp.do(ctx, "SetNewFlightPlan", func() ([]byte, error) {
+		return rp.proxy.SetNewFlightPlan(ctx, destination)
+	})
+}
+
+// GetFlightPlan retrieves information about current flight plan for specific ship, if any.
+func (rp *RateLimitedProxy) GetFlightPlan(ctx context.Context, planId string) ([]byte, error) {
+	return rp.do(ctx, "GetFlightPlan", func() ([]byte, error) {
+		return rp.proxy.GetFlightPlan(ctx, planId)
+	})
+}
+
+// BuyGood sends to game a purchase order.
+func (rp *RateLimitedProxy) BuyGood(ctx context.Context, good string, quantity int) ([]byte, error) {
+	return rp.do(ctx, "BuyGood", func() ([]byte, error) {
+		return rp.proxy.BuyGood(ctx, good, quantity)
+	})
+}
+
+// SellGood sends to game a sell order.
+func (rp *RateLimitedProxy) SellGood(ctx context.Context, good string, quantity int) ([]byte, error) {
+	return rp.do(ctx, "SellGood", func() ([]byte, error) {
+		return rp.proxy.SellGood(ctx, good, quantity)
+	})
+}
+
+// do waits for its turn in the bucket and sends the request, queueing it again if the game rate limited it. It stops
+// waiting when the context ends.
+func (rp *RateLimitedProxy) do(ctx context.Context, action string, request func() ([]byte, error)) ([]byte, error) {
+	for requeues := 0; ; requeues++ {
+		queued, err := rp.limiter.Wait(ctx)
+		web.ProxyQueueSeconds.WithLabelValues(rp.id, action).Observe(queued.Seconds())
+		if err != nil {
+			return nil, fmt.Errorf("%s: waiting for the rate limit: %w", action, err)
+		}
+
+		data, err := request()
+		failure := err
+		if failure == nil {
+			failure = gameerror.Parse(data)
+		}
+		if !errors.Is(failure, gameerror.ErrRateLimited) {
+			return data, err
+		}
+
+		pause, ok := gameerror.RetryAfter(failure)
+		if !ok {
+			pause = DefaultRateLimitPause
+		}
+		web.ProxyRateLimited.WithLabelValues(rp.id, action).Inc()
+		rp.limiter.Pause(pause)
+		if requeues >= MaxRateLimitRequeues {
+			logging.Warn(ctx, "Rate limited by the game too many times, giving up the request", "action", action,
+				"requeues", requeues)
+			return data, err
+		}
+		logging.Warn(ctx, "Rate limited by the game, holding requests", "action", action, "pause", pause)
+	}
+}
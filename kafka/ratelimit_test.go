@@ -0,0 +1,142 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/otaviokr/spacetraders-ship/mocks"
+)
+
+// fakeClock lets the rate limiter run without actually sleeping.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Sleep(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func (c *fakeClock) SleepContext(ctx context.Context, d time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.Sleep(d)
+	return nil
+}
+
+func newTestRateLimiter(rate float64, burst int) (*RateLimiter, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2022, 7, 1, 0, 0, 0, 0, time.UTC)}
+	rl := NewRateLimiter(rate, burst)
+	rl.last = clock.now
+	rl.now = clock.Now
+	rl.sleep = clock.SleepContext
+	return rl, clock
+}
+
+func TestRateLimiterWait(t *testing.T) {
+	rl, _ := newTestRateLimiter(2, 2)
+
+	expected := []time.Duration{0, 0, 500 * time.Millisecond, 500 * time.Millisecond}
+	for i, e := range expected {
+		if actual, _ := rl.Wait(context.TODO()); actual != e {
+			t.Fatalf("request %d\nACTUAL: %s\nEXPECT: %s\n", i, actual, e)
+		}
+	}
+}
+
+func TestRateLimiterPause(t *testing.T) {
+	rl, clock := newTestRateLimiter(2, 2)
+
+	rl.Pause(3 * time.Second)
+	if actual, _ := rl.Wait(context.TODO()); actual != 3500*time.Millisecond {
+		t.Fatalf("\nACTUAL: %s\nEXPECT: %s\n", actual, 3500*time.Millisecond)
+	}
+
+	clock.Sleep(time.Minute)
+	if actual, _ := rl.Wait(context.TODO()); actual != 0 {
+		t.Fatalf("\nACTUAL: %s\nEXPECT: 0s\n", actual)
+	}
+}
+
+func TestRateLimitedProxy(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	proxy := mocks.NewMockProxy(ctrl)
+	gomock.InOrder(
+		proxy.EXPECT().GetShipInfo(gomock.Any()).
+			Return([]byte("{\"error\":{\"message\":\"Throttle limit reached.\",\"code\":42901,\"data\":{\"retryAfter\":5}}}"), nil),
+		proxy.EXPECT().GetShipInfo(gomock.Any()).Return([]byte("{\"ship\":{\"id\":\"id0001\"}}"), nil))
+
+	rl, clock := newTestRateLimiter(2, 2)
+	start := clock.now
+	rp := NewRateLimitedProxy(proxy, "id0001", rl)
+
+	data, err := rp.GetShipInfo(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "{\"ship\":{\"id\":\"id0001\"}}" {
+		t.Fatalf("unexpected response: %s", string(data))
+	}
+
+	if waited := clock.now.Sub(start); waited < 5*time.Second {
+		t.Fatalf("expected to wait at least 5s, waited %s", waited)
+	}
+}
+
+func TestRateLimitedProxyGivesUp(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	throttled := []byte("{\"error\":{\"message\":\"Throttle limit reached.\",\"code\":42901,\"data\":{\"retryAfter\":1}}}")
+	proxy := mocks.NewMockProxy(ctrl)
+	proxy.EXPECT().GetShipInfo(gomock.Any()).Return(throttled, nil).Times(MaxRateLimitRequeues + 1)
+
+	rl, _ := newTestRateLimiter(2, 2)
+	rp := NewRateLimitedProxy(proxy, "id0001", rl)
+
+	data, err := rp.GetShipInfo(context.TODO())
+	if err != nil || string(data) != string(throttled) {
+		t.Fatalf("\nACTUAL: %s (%v)\nEXPECT: %s\n", data, err, throttled)
+	}
+}
+
+func TestRateLimitedProxyContext(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	proxy := mocks.NewMockProxy(ctrl)
+	proxy.EXPECT().GetShipInfo(gomock.Any()).Times(0)
+
+	rl, _ := newTestRateLimiter(2, 2)
+	rl.Pause(time.Minute)
+	rp := NewRateLimitedProxy(proxy, "id0001", rl)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := rp.GetShipInfo(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("\nACTUAL: %v\nEXPECT: %v\n", err, context.Canceled)
+	}
+
+	// The turn not used is given back to the bucket.
+	if rl.tokens != 0 {
+		t.Fatalf("\nACTUAL: %f tokens\nEXPECT: 0 tokens\n", rl.tokens)
+	}
+}
+
+func TestSharedRateLimiter(t *testing.T) {
+	if SharedRateLimiter("token0001", 2, 2) != SharedRateLimiter("token0001", 5, 5) {
+		t.Fatal("same key should share the rate limiter")
+	}
+	if SharedRateLimiter("token0001", 2, 2) == SharedRateLimiter("token0002", 2, 2) {
+		t.Fatal("different keys should not share the rate limiter")
+	}
+}
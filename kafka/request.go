@@ -1,33 +1,36 @@
 package kafka
 
+import "context"
+
+// Proxy sends the requests to the game. The context carries the trace of the ship, so it continues through the proxy.
 type Proxy interface {
 	// GetShipInfo collects information about specific ship.
 	//
 	// https://api.spacetraders.io/#api-ships-GetShip
-	GetShipInfo() ([]byte, error)
+	GetShipInfo(context.Context) ([]byte, error)
 
 	// GetMarketplaceProducts gathers information about products available to trade in the planet where the ship is.
 	//
 	// https://api.spacetraders.io/#api-locations-GetMarketplace
-	GetMarketplaceProducts(string) ([]byte, error)
+	GetMarketplaceProducts(context.Context, string) ([]byte, error)
 
 	// SetNewFlightPlan sends to game a new destination where the ships needs to fly to.
 	//
 	// https://api.spacetraders.io/#api-flight_plans-NewFlightPlan
-	SetNewFlightPlan(string) ([]byte, error)
+	SetNewFlightPlan(context.Context, string) ([]byte, error)
 
 	// GetFlightPlan retrieves information about current flight plan for specific ship, if any.
 	//
 	// https://api.spacetraders.io/#api-flight_plans-GetFlightPlan
-	GetFlightPlan(string) ([]byte, error)
+	GetFlightPlan(context.Context, string) ([]byte, error)
 
 	// BuyGood sends to game a purchase order.
 	//
 	// https://api.spacetraders.io/#api-purchase_orders-NewPurchaseOrder
-	BuyGood(string, int) ([]byte, error)
+	BuyGood(context.Context, string, int) ([]byte, error)
 
 	// SellGood sends to game a sell order.
 	//
 	// https://api.spacetraders.io/#api-sell_orders-NewSellOrder
-	SellGood(string, int) ([]byte, error)
+	SellGood(context.Context, string, int) ([]byte, error)
 }
@@ -0,0 +1,180 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/otaviokr/spacetraders-ship/gameerror"
+	"github.com/otaviokr/spacetraders-ship/logging"
+	"github.com/otaviokr/spacetraders-ship/web"
+)
+
+// RetryPolicy defines how many times and how often a failed request is sent again.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one.
+	MaxAttempts int `yaml:"maxAttempts"`
+	// InitialBackoff is how long to wait before the first retry.
+	InitialBackoff time.Duration `yaml:"initialBackoff"`
+	// MaxBackoff caps the wait between attempts.
+	MaxBackoff time.Duration `yaml:"maxBackoff"`
+	// Multiplier is applied to the backoff after each attempt.
+	Multiplier float64 `yaml:"multiplier"`
+	// Jitter is the fraction (0 to 1) of the backoff that is randomized, so ships don't retry in lockstep.
+	Jitter float64 `yaml:"jitter"`
+	// RetryOrders allows buy and sell orders to be sent again when no reply arrived. The game may have processed the
+	// first order already, so this may buy or sell twice.
+	RetryOrders bool `yaml:"retryOrders"`
+	// Retryable decides which errors are worth another attempt. If nil, DefaultRetryable is used.
+	Retryable func(error) bool `yaml:"-"`
+}
+
+// DefaultRetryPolicy returns the policy used when nothing else is configured.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    5,
+		InitialBackoff: 1 * time.Second,
+		MaxBackoff:     30 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+		Retryable:      DefaultRetryable,
+	}
+}
+
+// DefaultRetryable retries when the infrastructure failed or the game asked us to slow down.
+func DefaultRetryable(err error) bool {
+	return errors.Is(err, gameerror.ErrUnavailable) || errors.Is(err, gameerror.ErrRateLimited)
+}
+
+// backoff calculates how long to wait before the given retry (starting from 1).
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	delay := float64(p.InitialBackoff) * math.Pow(p.Multiplier, float64(retry-1))
+	if p.MaxBackoff > 0 && delay > float64(p.MaxBackoff) {
+		delay = float64(p.MaxBackoff)
+	}
+
+	if p.Jitter > 0 {
+		delay += delay * p.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(delay)
+}
+
+// RetryProxy wraps another Proxy, sending the requests again when they fail with a retryable error.
+type RetryProxy struct {
+	proxy  Proxy
+	id     string
+	policy RetryPolicy
+	sleep  func(time.Duration)
+}
+
+// NewResilientProxy wraps the transport (the Kafka proxy, or a cassette being replayed) with the rate limit and, on top
+// of it, the retries, which is how the ship sends every request to the game.
+func NewResilientProxy(transport Proxy, id string, limiter *RateLimiter, policy RetryPolicy) *RetryProxy {
+	return NewRetryProxy(NewRateLimitedProxy(transport, id, limiter), id, policy)
+}
+
+// NewRetryProxy creates a new instance of RetryProxy. The id is only used to label the metrics.
+func NewRetryProxy(proxy Proxy, id string, policy RetryPolicy) *RetryProxy {
+	if policy.MaxAttempts < 1 {
+		policy.MaxAttempts = 1
+	}
+	if policy.Multiplier < 1 {
+		policy.Multiplier = 1
+	}
+	if policy.Retryable == nil {
+		policy.Retryable = DefaultRetryable
+	}
+
+	return &RetryProxy{
+		proxy:  proxy,
+		id:     id,
+		policy: policy,
+		sleep:  time.Sleep,
+	}
+}
+
+// GetShipInfo collects information about specific ship.
+func (rp *RetryProxy) GetShipInfo(ctx context.Context) ([]byte, error) {
+	return rp.do(ctx, "GetShipInfo", false, func() ([]byte, error) {
+		return rp.proxy.GetShipInfo(ctx)
+	})
+}
+
+// GetMarketplaceProducts gathers information about products available to trade in the planet where the ship is.
+func (rp *RetryProxy) GetMarketplaceProducts(ctx context.Context, location string) ([]byte, error) {
+	return rp.do(ctx, "GetMarketplaceProducts", false, func() ([]byte, error) {
+		return rp.proxy.GetMarketplaceProducts(ctx, location)
+	})
+}
+
+// SetNewFlightPlan sends to game a new destination where the ships needs to fly to.
+func (rp *RetryProxy) SetNewFlightPlan(ctx context.Context, destination string) ([]byte, error) {
+	// A flight plan sent twice is rejected by the game (the ship is in transit), so it is safe to retry.
+	return rp.do(ctx, "SetNewFlightPlan", false, func() ([]byte, error) {
+		return rp.proxy.SetNewFlightPlan(ctx, destination)
+	})
+}
+
+// GetFlightPlan retrieves information about current flight plan for specific ship, if any.
+func (rp *RetryProxy) GetFlightPlan(ctx context.Context, planId string) ([]byte, error) {
+	return rp.do(ctx, "GetFlightPlan", false, func() ([]byte, error) {
+		return rp.proxy.GetFlightPlan(ctx, planId)
+	})
+}
+
+// BuyGood sends to game a purchase order.
+func (rp *RetryProxy) BuyGood(ctx context.Context, good string, quantity int) ([]byte, error) {
+	return rp.do(ctx, "BuyGood", true, func() ([]byte, error) {
+		return rp.proxy.BuyGood(ctx, good, quantity)
+	})
+}
+
+// SellGood sends to game a sell order.
+func (rp *RetryProxy) SellGood(ctx context.Context, good string, quantity int) ([]byte, error) {
+	return rp.do(ctx, "SellGood", true, func() ([]byte, error) {
+		return rp.proxy.SellGood(ctx, good, quantity)
+	})
+}
+
+// do calls the request until it succeeds, fails with an error that cannot be retried or the attempts are over.
+//
+// Errors reported by the game in the response body are considered too, so a rate limited request is sent again.
+// If all attempts fail, the last response is returned as-is, so the caller can still decode the error from the game.
+func (rp *RetryProxy) do(ctx context.Context, action string, order bool, request func() ([]byte, error)) ([]byte, error) {
+	var data []byte
+	var err error
+	for attempt := 1; ; attempt++ {
+		web.ProxyAttempts.WithLabelValues(rp.id, action).Inc()
+
+		data, err = request()
+		failure := err
+		if failure == nil {
+			failure = gameerror.Parse(data)
+		}
+
+		if failure == nil || !rp.retryable(order, failure) {
+			return data, err
+		}
+
+		if attempt >= rp.policy.MaxAttempts {
+			logging.Error(ctx, "Giving up the request", "action", action, "attempts", attempt, "error", failure)
+			web.ProxyGiveUps.WithLabelValues(rp.id, action).Inc()
+			return data, err
+		}
+
+		delay := rp.policy.backoff(attempt)
+		logging.Warn(ctx, "Request failed, retrying", "action", action, "attempt", attempt, "delay", delay,
+			"error", failure)
+		rp.sleep(delay)
+	}
+}
+
+// retryable checks the policy, taking care of orders that may have been processed already.
+func (rp *RetryProxy) retryable(order bool, err error) bool {
+	if order && !rp.policy.RetryOrders && errors.Is(err, ErrNoReply) {
+		return false
+	}
+	return rp.policy.Retryable(err)
+}
@@ -0,0 +1,112 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/otaviokr/spacetraders-ship/gameerror"
+	"github.com/otaviokr/spacetraders-ship/mocks"
+)
+
+func TestRetryProxy(t *testing.T) {
+	useCases := map[string]map[string]interface{}{
+		"transient failure": {
+			"responses": [][]byte{nil, []byte("{\"ship\":{\"id\":\"id0001\"}}")},
+			"errors":    []error{ErrNoReply, nil},
+			"attempts":  2,
+			"fail":      false},
+		"rate limited": {
+			"responses": [][]byte{[]byte("{\"error\":{\"message\":\"Throttle limit reached.\",\"code\":42901}}"), []byte("{\"ship\":{\"id\":\"id0001\"}}")},
+			"errors":    []error{nil, nil},
+			"attempts":  2,
+			"fail":      false},
+		"give up": {
+			"responses": [][]byte{nil, nil, nil},
+			"errors":    []error{ErrNoReply, ErrNoReply, ErrNoReply},
+			"attempts":  3,
+			"fail":      true},
+		"not retryable": {
+			"responses": [][]byte{nil},
+			"errors":    []error{fmt.Errorf("decoding failed")},
+			"attempts":  1,
+			"fail":      true}}
+
+	for name, uc := range useCases {
+		ctrl := gomock.NewController(t)
+		proxy := mocks.NewMockProxy(ctrl)
+
+		responses := uc["responses"].([][]byte)
+		errs := uc["errors"].([]error)
+		calls := []*gomock.Call{}
+		for i := range responses {
+			calls = append(calls, proxy.EXPECT().GetShipInfo(gomock.Any()).Return(responses[i], errs[i]))
+		}
+		gomock.InOrder(calls...)
+
+		policy := DefaultRetryPolicy()
+		policy.MaxAttempts = 3
+		rp := NewRetryProxy(proxy, "id0001", policy)
+		sleeps := 0
+		rp.sleep = func(time.Duration) { sleeps++ }
+
+		_, err := rp.GetShipInfo(context.TODO())
+		if uc["fail"].(bool) && err == nil {
+			t.Fatalf("%s: expected error, got none", name)
+		} else if !uc["fail"].(bool) && err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+
+		if sleeps != uc["attempts"].(int)-1 {
+			t.Fatalf("%s\nACTUAL: %d retries\nEXPECT: %d retries\n", name, sleeps, uc["attempts"].(int)-1)
+		}
+		ctrl.Finish()
+	}
+}
+
+func TestRetryProxyOrders(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	proxy := mocks.NewMockProxy(ctrl)
+	proxy.EXPECT().BuyGood(gomock.Any(), "FUEL", 10).Return(nil, ErrNoReply)
+
+	rp := NewRetryProxy(proxy, "id0001", DefaultRetryPolicy())
+	rp.sleep = func(time.Duration) { t.Fatal("order without reply must not be retried") }
+
+	if _, err := rp.BuyGood(context.TODO(), "FUEL", 10); err == nil {
+		t.Fatal("expected error, got none")
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{
+		InitialBackoff: time.Second,
+		MaxBackoff:     5 * time.Second,
+		Multiplier:     2}
+
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second}
+	for i, e := range expected {
+		if actual := policy.backoff(i + 1); actual != e {
+			t.Fatalf("\nACTUAL: %s\nEXPECT: %s\n", actual, e)
+		}
+	}
+
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if actual := policy.backoff(1); actual < 500*time.Millisecond || actual > 1500*time.Millisecond {
+			t.Fatalf("backoff with jitter out of range: %s", actual)
+		}
+	}
+}
+
+func TestDefaultRetryable(t *testing.T) {
+	if !DefaultRetryable(gameerror.New(42901, "Throttle limit reached.")) {
+		t.Fatal("rate limit should be retryable")
+	}
+	if DefaultRetryable(gameerror.New(3001, "Ship has insufficient fuel for flight plan. You require 1 more FUEL")) {
+		t.Fatal("insufficient fuel should not be retryable")
+	}
+}
@@ -0,0 +1,133 @@
+package kafka
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+)
+
+// SASL mechanisms supported to authenticate with the brokers.
+const (
+	SASLPlain       = "PLAIN"
+	SASLScramSHA256 = "SCRAM-SHA-256"
+	SASLScramSHA512 = "SCRAM-SHA-512"
+)
+
+// TLSConfig defines how to encrypt the connection with the brokers.
+type TLSConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// CAFile is the PEM file with the certificate authorities to trust. If empty, the system ones are used.
+	CAFile string `yaml:"caFile"`
+	// CertFile and KeyFile are the PEM files with the client certificate, if the brokers require one.
+	CertFile string `yaml:"certFile"`
+	KeyFile  string `yaml:"keyFile"`
+	// ServerName overrides the name checked in the broker certificate.
+	ServerName string `yaml:"serverName"`
+	// InsecureSkipVerify disables the verification of the broker certificate. Only for testing!
+	InsecureSkipVerify bool `yaml:"insecureSkipVerify"`
+}
+
+// SASLConfig defines how to authenticate with the brokers. An empty mechanism disables the authentication.
+type SASLConfig struct {
+	Mechanism string `yaml:"mechanism"`
+	Username  string `yaml:"username"`
+	Password  string `yaml:"password"`
+}
+
+// tlsConfig builds the TLS configuration, or nil if TLS is disabled.
+func (c TLSConfig) tlsConfig() (*tls.Config, error) {
+	if !c.Enabled {
+		if len(c.CAFile) > 0 || len(c.CertFile) > 0 || len(c.KeyFile) > 0 {
+			return nil, fmt.Errorf("kafka tls: certificate files are set, but tls is not enabled")
+		}
+		return nil, nil
+	}
+
+	config := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+
+	if len(c.CAFile) > 0 {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("kafka tls: reading CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("kafka tls: no certificate found in CA file %s", c.CAFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if len(c.CertFile) > 0 || len(c.KeyFile) > 0 {
+		if len(c.CertFile) < 1 || len(c.KeyFile) < 1 {
+			return nil, fmt.Errorf("kafka tls: both the client certificate and key files are required")
+		}
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("kafka tls: loading client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+// mechanism builds the SASL mechanism, or nil if the authentication is disabled.
+func (c SASLConfig) mechanism() (sasl.Mechanism, error) {
+	if len(c.Mechanism) < 1 {
+		if len(c.Username) > 0 || len(c.Password) > 0 {
+			return nil, fmt.Errorf("kafka sasl: credentials are set, but no mechanism")
+		}
+		return nil, nil
+	}
+	if len(c.Username) < 1 || len(c.Password) < 1 {
+		return nil, fmt.Errorf("kafka sasl: username and password are required for %s", c.Mechanism)
+	}
+
+	switch strings.ToUpper(c.Mechanism) {
+	case SASLPlain:
+		return plain.Mechanism{Username: c.Username, Password: c.Password}, nil
+	case SASLScramSHA256:
+		return scram.Mechanism(scram.SHA256, c.Username, c.Password)
+	case SASLScramSHA512:
+		return scram.Mechanism(scram.SHA512, c.Username, c.Password)
+	}
+	return nil, fmt.Errorf("kafka sasl: unknown mechanism %q (use %s, %s or %s)",
+		c.Mechanism, SASLPlain, SASLScramSHA256, SASLScramSHA512)
+}
+
+// security builds the dialer (used to read) and the transport (used to write) with the TLS and SASL settings.
+func (c Config) security() (*kafka.Dialer, *kafka.Transport, error) {
+	tlsConfig, err := c.TLS.tlsConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	mechanism, err := c.SASL.mechanism()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dialer := &kafka.Dialer{
+		Timeout:       10 * time.Second,
+		DualStack:     true,
+		TLS:           tlsConfig,
+		SASLMechanism: mechanism,
+	}
+	transport := &kafka.Transport{
+		TLS:  tlsConfig,
+		SASL: mechanism,
+	}
+	return dialer, transport, nil
+}
@@ -0,0 +1,149 @@
+package kafka
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeCertificate creates a self-signed certificate and its key in the directory, returning their paths.
+func writeCertificate(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "kafka"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IsCA:         true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	if err = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCertificate(t, dir)
+	garbage := filepath.Join(dir, "garbage.pem")
+	if err := os.WriteFile(garbage, []byte("not a certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	useCases := map[string]map[string]interface{}{
+		"disabled":             {"config": TLSConfig{}, "error": "", "enabled": false},
+		"files without tls":    {"config": TLSConfig{CAFile: certFile}, "error": "tls is not enabled"},
+		"system CA":            {"config": TLSConfig{Enabled: true}, "error": "", "enabled": true},
+		"custom CA":            {"config": TLSConfig{Enabled: true, CAFile: certFile}, "error": "", "enabled": true},
+		"missing CA":           {"config": TLSConfig{Enabled: true, CAFile: filepath.Join(dir, "missing.pem")}, "error": "reading CA file"},
+		"invalid CA":           {"config": TLSConfig{Enabled: true, CAFile: garbage}, "error": "no certificate found"},
+		"client certificate":   {"config": TLSConfig{Enabled: true, CertFile: certFile, KeyFile: keyFile}, "error": "", "enabled": true},
+		"certificate only":     {"config": TLSConfig{Enabled: true, CertFile: certFile}, "error": "both the client certificate and key"},
+		"invalid certificate":  {"config": TLSConfig{Enabled: true, CertFile: garbage, KeyFile: keyFile}, "error": "loading client certificate"},
+		"skip verify for test": {"config": TLSConfig{Enabled: true, InsecureSkipVerify: true}, "error": "", "enabled": true}}
+
+	for name, uc := range useCases {
+		config, err := uc["config"].(TLSConfig).tlsConfig()
+		expected := uc["error"].(string)
+		if len(expected) > 0 {
+			if err == nil || !strings.Contains(err.Error(), expected) {
+				t.Fatalf("%s\nACTUAL: %v\nEXPECT: %s\n", name, err, expected)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if (config != nil) != uc["enabled"].(bool) {
+			t.Fatalf("%s\nACTUAL: %+v\nEXPECT: enabled %t\n", name, config, uc["enabled"])
+		}
+	}
+}
+
+func TestSASLMechanism(t *testing.T) {
+	useCases := map[string]map[string]interface{}{
+		"disabled":     {"config": SASLConfig{}, "expected": "", "error": ""},
+		"plain":        {"config": SASLConfig{Mechanism: "PLAIN", Username: "user", Password: "secret"}, "expected": "PLAIN", "error": ""},
+		"scram 256":    {"config": SASLConfig{Mechanism: "scram-sha-256", Username: "user", Password: "secret"}, "expected": "SCRAM-SHA-256", "error": ""},
+		"scram 512":    {"config": SASLConfig{Mechanism: "SCRAM-SHA-512", Username: "user", Password: "secret"}, "expected": "SCRAM-SHA-512", "error": ""},
+		"no password":  {"config": SASLConfig{Mechanism: "PLAIN", Username: "user"}, "error": "username and password are required"},
+		"unknown":      {"config": SASLConfig{Mechanism: "GSSAPI", Username: "user", Password: "secret"}, "error": "unknown mechanism"},
+		"no mechanism": {"config": SASLConfig{Username: "user", Password: "secret"}, "error": "no mechanism"}}
+
+	for name, uc := range useCases {
+		mechanism, err := uc["config"].(SASLConfig).mechanism()
+		expected := uc["error"].(string)
+		if len(expected) > 0 {
+			if err == nil || !strings.Contains(err.Error(), expected) {
+				t.Fatalf("%s\nACTUAL: %v\nEXPECT: %s\n", name, err, expected)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+
+		actual := ""
+		if mechanism != nil {
+			actual = mechanism.Name()
+		}
+		if actual != uc["expected"].(string) {
+			t.Fatalf("%s\nACTUAL: %s\nEXPECT: %s\n", name, actual, uc["expected"])
+		}
+	}
+}
+
+func TestNewKafkaProxyInvalidConfig(t *testing.T) {
+	valid := DefaultConfig()
+	valid.TopicRead = "replies"
+	valid.TopicWrite = "requests"
+
+	noBrokers := valid
+	noBrokers.Brokers = nil
+	noTopics := valid
+	noTopics.TopicRead = ""
+	badSASL := valid
+	badSASL.SASL = SASLConfig{Mechanism: "OAUTHBEARER", Username: "user", Password: "secret"}
+	badTLS := valid
+	badTLS.TLS = TLSConfig{Enabled: true, CAFile: filepath.Join(t.TempDir(), "missing.pem")}
+
+	useCases := map[string]map[string]interface{}{
+		"no brokers": {"config": noBrokers, "error": "no broker configured"},
+		"no topics":  {"config": noTopics, "error": "topics are required"},
+		"bad sasl":   {"config": badSASL, "error": "unknown mechanism"},
+		"bad tls":    {"config": badTLS, "error": "reading CA file"}}
+
+	for name, uc := range useCases {
+		_, err := NewKafkaProxy(context.Background(), "id0001", uc["config"].(Config))
+		if err == nil || !strings.Contains(err.Error(), uc["error"].(string)) {
+			t.Fatalf("%s\nACTUAL: %v\nEXPECT: %s\n", name, err, uc["error"])
+		}
+	}
+}
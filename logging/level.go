@@ -0,0 +1,142 @@
+package logging
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// Level is the severity of a log line. Only the lines at the level of the logger or above are written.
+type Level int32
+
+// Levels supported, from the most verbose.
+const (
+	LevelDebug Level = iota - 1
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// String returns the name of the level, as used in the log lines and in the configuration.
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	}
+	return fmt.Sprintf("level(%d)", int32(l))
+}
+
+// ParseLevel reads the name of the level, in any case. "warning" is accepted for warn.
+func ParseLevel(name string) (Level, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "debug":
+		return LevelDebug, nil
+	case "info":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	}
+	return LevelInfo, fmt.Errorf("logging: unknown level %q (use debug, info, warn or error)", name)
+}
+
+// LevelVar is a level that can be changed while the loggers use it.
+type LevelVar struct {
+	level int32
+}
+
+// NewLevelVar creates a LevelVar set to the level.
+func NewLevelVar(level Level) *LevelVar {
+	return &LevelVar{level: int32(level)}
+}
+
+// Level returns the current level.
+func (v *LevelVar) Level() Level {
+	return Level(atomic.LoadInt32(&v.level))
+}
+
+// Set changes the level of all the loggers using it.
+func (v *LevelVar) Set(level Level) {
+	atomic.StoreInt32(&v.level, int32(level))
+}
+
+// levelBody is the body of the requests and responses of the level handler.
+type levelBody struct {
+	Level string `json:"level"`
+}
+
+// Handler shows the current level on GET, and changes it on PUT or POST, with the new level in the body
+// ({"level": "debug"}) or in the "level" query parameter. Changes must carry the token ("Authorization: Bearer
+// <token>"); without a token, the level cannot be changed at all.
+func (v *LevelVar) Handler(token string) http.Handler {
+	return &levelHandler{level: v, token: token}
+}
+
+// levelHandler serves the level (see LevelVar.Handler).
+type levelHandler struct {
+	level *LevelVar
+	token string
+}
+
+func (h *levelHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	v := h.level
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPost:
+		if len(h.token) < 1 {
+			writeLevelError(w, http.StatusForbidden, errors.New("logging: changing the level is disabled, no token set"))
+			return
+		}
+		given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(given), []byte(h.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeLevelError(w, http.StatusUnauthorized, errors.New("logging: invalid token"))
+			return
+		}
+
+		name := r.URL.Query().Get("level")
+		if len(name) < 1 {
+			var body levelBody
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				writeLevelError(w, http.StatusBadRequest, fmt.Errorf("logging: invalid body: %w", err))
+				return
+			}
+			name = body.Level
+		}
+
+		level, err := ParseLevel(name)
+		if err != nil {
+			writeLevelError(w, http.StatusBadRequest, err)
+			return
+		}
+		previous := v.Level()
+		v.Set(level)
+		if previous != level {
+			Info(r.Context(), "Log level changed", "from", previous.String(), "to", level.String())
+		}
+	default:
+		w.Header().Set("Allow", "GET, PUT, POST")
+		writeLevelError(w, http.StatusMethodNotAllowed, fmt.Errorf("logging: method %s not allowed", r.Method))
+		return
+	}
+
+	json.NewEncoder(w).Encode(levelBody{Level: v.Level().String()})
+}
+
+func writeLevelError(w http.ResponseWriter, status int, err error) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
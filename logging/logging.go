@@ -0,0 +1,300 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Formats supported to write the log lines.
+const (
+	FormatJSON   = "json"
+	FormatLogfmt = "logfmt"
+)
+
+// Fields that are common to all the log lines, so they can be queried the same way everywhere.
+const (
+	FieldShipID    = "ship_id"
+	FieldRouteStop = "route_stop"
+	FieldCycle     = "cycle"
+	FieldTraceID   = "trace_id"
+	FieldSpanID    = "span_id"
+)
+
+// Logger writes structured log lines, in JSON or logfmt, if their level is enabled. The fields added with With and
+// WithContext are written in every line, followed by the trace and span IDs of the context, if any.
+type Logger struct {
+	out    *output
+	fields []interface{}
+}
+
+// output is shared by a logger and all the loggers derived from it.
+type output struct {
+	mu     sync.Mutex
+	w      io.Writer
+	format string
+	level  *LevelVar
+	now    func() time.Time
+}
+
+// New creates a logger writing to w in the format (FormatJSON or FormatLogfmt) the lines at level or above. The
+// level can be changed later, even while logging.
+func New(w io.Writer, format string, level *LevelVar) (*Logger, error) {
+	switch format {
+	case FormatJSON, FormatLogfmt:
+	default:
+		return nil, fmt.Errorf("logging: unknown format %q (use %s or %s)", format, FormatJSON, FormatLogfmt)
+	}
+	if level == nil {
+		level = NewLevelVar(LevelInfo)
+	}
+
+	return &Logger{out: &output{w: w, format: format, level: level, now: time.Now}}, nil
+}
+
+// Level returns the level of the logger, which can be changed at any time.
+func (l *Logger) Level() *LevelVar {
+	return l.out.level
+}
+
+// With returns a logger that adds the key-value pairs to every line.
+func (l *Logger) With(keyValues ...interface{}) *Logger {
+	return &Logger{
+		out:    l.out,
+		fields: append(append([]interface{}{}, l.fields...), keyValues...),
+	}
+}
+
+// Enabled tells if the lines at the level are written.
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.out.level.Level()
+}
+
+// Debug writes the message and the key-value pairs, if the debug level is enabled.
+func (l *Logger) Debug(ctx context.Context, msg string, keyValues ...interface{}) {
+	l.log(ctx, LevelDebug, msg, keyValues)
+}
+
+// Info writes the message and the key-value pairs, if the info level is enabled.
+func (l *Logger) Info(ctx context.Context, msg string, keyValues ...interface{}) {
+	l.log(ctx, LevelInfo, msg, keyValues)
+}
+
+// Warn writes the message and the key-value pairs, if the warn level is enabled.
+func (l *Logger) Warn(ctx context.Context, msg string, keyValues ...interface{}) {
+	l.log(ctx, LevelWarn, msg, keyValues)
+}
+
+// Error writes the message and the key-value pairs.
+func (l *Logger) Error(ctx context.Context, msg string, keyValues ...interface{}) {
+	l.log(ctx, LevelError, msg, keyValues)
+}
+
+// log writes the line with the fields of the logger, of the context and the given ones, in this order.
+func (l *Logger) log(ctx context.Context, level Level, msg string, keyValues []interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+
+	fields := append([]interface{}{}, l.fields...)
+	if ctx != nil {
+		fields = append(fields, contextFields(ctx)...)
+		if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+			fields = append(fields,
+				FieldTraceID, spanContext.TraceID().String(),
+				FieldSpanID, spanContext.SpanID().String())
+		}
+	}
+	fields = append(fields, keyValues...)
+
+	var line bytes.Buffer
+	switch l.out.format {
+	case FormatJSON:
+		writeJSON(&line, l.out.now(), level, msg, fields)
+	default:
+		writeLogfmt(&line, l.out.now(), level, msg, fields)
+	}
+
+	l.out.mu.Lock()
+	defer l.out.mu.Unlock()
+	l.out.w.Write(line.Bytes())
+}
+
+// pairs calls f for each key-value pair. A key without value gets "!MISSING", like a key that is not a string gets
+// "!BADKEY" as key, so nothing is lost.
+func pairs(fields []interface{}, f func(key string, value interface{})) {
+	for i := 0; i < len(fields); i += 2 {
+		key, ok := fields[i].(string)
+		if !ok {
+			f("!BADKEY", fields[i])
+			i--
+			continue
+		}
+		if i+1 >= len(fields) {
+			f(key, "!MISSING")
+			continue
+		}
+		f(key, fields[i+1])
+	}
+}
+
+func writeJSON(buf *bytes.Buffer, now time.Time, level Level, msg string, fields []interface{}) {
+	buf.WriteString(`{"time":`)
+	writeJSONValue(buf, now.UTC().Format(time.RFC3339Nano))
+	buf.WriteString(`,"level":`)
+	writeJSONValue(buf, level.String())
+	buf.WriteString(`,"msg":`)
+	writeJSONValue(buf, msg)
+	pairs(fields, func(key string, value interface{}) {
+		buf.WriteByte(',')
+		writeJSONValue(buf, key)
+		buf.WriteByte(':')
+		writeJSONValue(buf, value)
+	})
+	buf.WriteString("}\n")
+}
+
+func writeJSONValue(buf *bytes.Buffer, value interface{}) {
+	switch v := value.(type) {
+	case error:
+		value = v.Error()
+	case time.Duration:
+		value = v.String()
+	case fmt.Stringer:
+		value = v.String()
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprintf("%+v", value))
+	}
+	buf.Write(data)
+}
+
+func writeLogfmt(buf *bytes.Buffer, now time.Time, level Level, msg string, fields []interface{}) {
+	buf.WriteString("time=")
+	buf.WriteString(now.UTC().Format(time.RFC3339Nano))
+	buf.WriteString(" level=")
+	buf.WriteString(level.String())
+	buf.WriteString(" msg=")
+	writeLogfmtValue(buf, msg)
+	pairs(fields, func(key string, value interface{}) {
+		buf.WriteByte(' ')
+		buf.WriteString(key)
+		buf.WriteByte('=')
+		writeLogfmtValue(buf, value)
+	})
+	buf.WriteByte('\n')
+}
+
+func writeLogfmtValue(buf *bytes.Buffer, value interface{}) {
+	var s string
+	switch v := value.(type) {
+	case string:
+		s = v
+	case error:
+		s = v.Error()
+	case fmt.Stringer:
+		s = v.String()
+	default:
+		s = fmt.Sprintf("%+v", v)
+	}
+
+	if len(s) < 1 || strings.IndexFunc(s, func(r rune) bool {
+		return r == '=' || r == '"' || unicode.IsSpace(r) || !unicode.IsPrint(r)
+	}) >= 0 {
+		s = strconv.Quote(s)
+	}
+	buf.WriteString(s)
+}
+
+// contextKey is the key of the log fields in the context.
+type contextKey struct{}
+
+// WithContext returns a context carrying the key-value pairs, to be written in every line logged with it (or with
+// any context derived from it).
+func WithContext(ctx context.Context, keyValues ...interface{}) context.Context {
+	fields := append(append([]interface{}{}, contextFields(ctx)...), keyValues...)
+	return context.WithValue(ctx, contextKey{}, fields)
+}
+
+// contextFields returns the key-value pairs added to the context with WithContext.
+func contextFields(ctx context.Context) []interface{} {
+	fields, _ := ctx.Value(contextKey{}).([]interface{})
+	return fields
+}
+
+var (
+	defaultMu     sync.RWMutex
+	defaultLogger = mustNew(os.Stderr, FormatLogfmt, NewLevelVar(LevelInfo))
+)
+
+func mustNew(w io.Writer, format string, level *LevelVar) *Logger {
+	logger, err := New(w, format, level)
+	if err != nil {
+		panic(err)
+	}
+	return logger
+}
+
+// Default returns the logger used by the package functions: logfmt at info level to the standard error, unless
+// replaced by SetDefault.
+func Default() *Logger {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return defaultLogger
+}
+
+// SetDefault replaces the logger used by the package functions.
+func SetDefault(logger *Logger) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultLogger = logger
+}
+
+// Debug logs with the default logger.
+func Debug(ctx context.Context, msg string, keyValues ...interface{}) {
+	Default().log(ctx, LevelDebug, msg, keyValues)
+}
+
+// Info logs with the default logger.
+func Info(ctx context.Context, msg string, keyValues ...interface{}) {
+	Default().log(ctx, LevelInfo, msg, keyValues)
+}
+
+// Warn logs with the default logger.
+func Warn(ctx context.Context, msg string, keyValues ...interface{}) {
+	Default().log(ctx, LevelWarn, msg, keyValues)
+}
+
+// Error logs with the default logger.
+func Error(ctx context.Context, msg string, keyValues ...interface{}) {
+	Default().log(ctx, LevelError, msg, keyValues)
+}
+
+// Writer adapts the logger to io.Writer, logging each line written at the level. It is used to capture what is still
+// written with the standard log package, e.g., by the libraries.
+func (l *Logger) Writer(level Level) io.Writer {
+	return writerFunc(func(p []byte) (int, error) {
+		for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+			l.log(context.Background(), level, line, nil)
+		}
+		return len(p), nil
+	})
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
@@ -0,0 +1,234 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+func newTestLogger(t *testing.T, format string, level Level) (*Logger, *bytes.Buffer) {
+	var out bytes.Buffer
+	logger, err := New(&out, format, NewLevelVar(level))
+	if err != nil {
+		t.Fatalf("\nACTUAL: %v\nEXPECT: no error\n", err)
+	}
+	logger.out.now = func() time.Time { return time.Date(2022, 7, 1, 10, 0, 0, 0, time.UTC) }
+	return logger, &out
+}
+
+func TestFormats(t *testing.T) {
+	useCases := map[string]map[string]interface{}{
+		"logfmt": {
+			"format":   FormatLogfmt,
+			"expected": "time=2022-07-01T10:00:00Z level=info msg=\"Flight plan defined\" ship_id=ship-1 cycle=3 route_stop=OE-PM destination=OE-CR remaining=1m0s error=\"no fuel\" empty=\"\"\n",
+		},
+		"json": {
+			"format":   FormatJSON,
+			"expected": "{\"time\":\"2022-07-01T10:00:00Z\",\"level\":\"info\",\"msg\":\"Flight plan defined\",\"ship_id\":\"ship-1\",\"cycle\":3,\"route_stop\":\"OE-PM\",\"destination\":\"OE-CR\",\"remaining\":\"1m0s\",\"error\":\"no fuel\",\"empty\":\"\"}\n",
+		},
+	}
+
+	for name, uc := range useCases {
+		t.Run(name, func(t *testing.T) {
+			logger, out := newTestLogger(t, uc["format"].(string), LevelInfo)
+			ctx := WithContext(context.Background(), FieldCycle, 3)
+			ctx = WithContext(ctx, FieldRouteStop, "OE-PM")
+
+			logger.With(FieldShipID, "ship-1").Info(ctx, "Flight plan defined",
+				"destination", "OE-CR",
+				"remaining", time.Minute,
+				"error", errors.New("no fuel"),
+				"empty", "")
+
+			if out.String() != uc["expected"].(string) {
+				t.Fatalf("\nACTUAL: %s\nEXPECT: %s\n", out.String(), uc["expected"])
+			}
+		})
+	}
+}
+
+func TestLevels(t *testing.T) {
+	logger, out := newTestLogger(t, FormatLogfmt, LevelWarn)
+
+	logger.Debug(context.Background(), "debug")
+	logger.Info(context.Background(), "info")
+	logger.Warn(context.Background(), "warn")
+	logger.Error(context.Background(), "error")
+	if strings.Count(out.String(), "\n") != 2 || !strings.Contains(out.String(), "level=warn msg=warn") ||
+		!strings.Contains(out.String(), "level=error msg=error") {
+		t.Fatalf("\nACTUAL: %s\nEXPECT: only warn and error\n", out.String())
+	}
+
+	// Changing the level affects the derived loggers too.
+	out.Reset()
+	derived := logger.With(FieldShipID, "ship-1")
+	logger.Level().Set(LevelDebug)
+	derived.Debug(context.Background(), "debug")
+	if !strings.Contains(out.String(), "level=debug msg=debug ship_id=ship-1") {
+		t.Fatalf("\nACTUAL: %s\nEXPECT: debug line\n", out.String())
+	}
+}
+
+func TestTraceFields(t *testing.T) {
+	logger, out := newTestLogger(t, FormatLogfmt, LevelInfo)
+	traceID, _ := trace.TraceIDFromHex("0102030405060708090a0b0c0d0e0f10")
+	spanID, _ := trace.SpanIDFromHex("0102030405060708")
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+	}))
+
+	logger.Info(ctx, "traced")
+	expected := "trace_id=0102030405060708090a0b0c0d0e0f10 span_id=0102030405060708\n"
+	if !strings.HasSuffix(out.String(), expected) {
+		t.Fatalf("\nACTUAL: %s\nEXPECT: ...%s\n", out.String(), expected)
+	}
+}
+
+func TestBadKeyValues(t *testing.T) {
+	logger, out := newTestLogger(t, FormatLogfmt, LevelInfo)
+
+	logger.Info(context.Background(), "odd", 42, "value", "key", "dangling")
+	expected := "msg=odd !BADKEY=42 value=key dangling=!MISSING\n"
+	if !strings.HasSuffix(out.String(), expected) {
+		t.Fatalf("\nACTUAL: %s\nEXPECT: ...%s\n", out.String(), expected)
+	}
+}
+
+func TestUnknownFormat(t *testing.T) {
+	if _, err := New(&bytes.Buffer{}, "xml", nil); err == nil {
+		t.Fatalf("\nACTUAL: no error\nEXPECT: unknown format\n")
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	useCases := map[string]map[string]interface{}{
+		"debug":   {"level": LevelDebug, "valid": true},
+		"INFO":    {"level": LevelInfo, "valid": true},
+		"warning": {"level": LevelWarn, "valid": true},
+		"error":   {"level": LevelError, "valid": true},
+		"trace":   {"level": LevelInfo, "valid": false},
+	}
+
+	for name, uc := range useCases {
+		t.Run(name, func(t *testing.T) {
+			level, err := ParseLevel(name)
+			if (err == nil) != uc["valid"].(bool) || level != uc["level"].(Level) {
+				t.Fatalf("\nACTUAL: %s %v\nEXPECT: %s valid %v\n", level, err, uc["level"], uc["valid"])
+			}
+		})
+	}
+}
+
+func TestLevelHandler(t *testing.T) {
+	useCases := map[string]map[string]interface{}{
+		"get": {
+			"method": http.MethodGet,
+			"url":    "/admin/log-level",
+			"body":   "",
+			"status": http.StatusOK,
+			"level":  LevelInfo,
+		},
+		"put body": {
+			"method": http.MethodPut,
+			"url":    "/admin/log-level",
+			"body":   `{"level":"debug"}`,
+			"token":  "admin0001",
+			"status": http.StatusOK,
+			"level":  LevelDebug,
+		},
+		"post query": {
+			"method": http.MethodPost,
+			"url":    "/admin/log-level?level=error",
+			"body":   "",
+			"token":  "admin0001",
+			"status": http.StatusOK,
+			"level":  LevelError,
+		},
+		"unknown level": {
+			"method": http.MethodPut,
+			"url":    "/admin/log-level",
+			"body":   `{"level":"loud"}`,
+			"token":  "admin0001",
+			"status": http.StatusBadRequest,
+			"level":  LevelInfo,
+		},
+		"no token": {
+			"method": http.MethodPut,
+			"url":    "/admin/log-level",
+			"body":   `{"level":"debug"}`,
+			"status": http.StatusUnauthorized,
+			"level":  LevelInfo,
+		},
+		"wrong token": {
+			"method": http.MethodPut,
+			"url":    "/admin/log-level",
+			"body":   `{"level":"debug"}`,
+			"token":  "admin0002",
+			"status": http.StatusUnauthorized,
+			"level":  LevelInfo,
+		},
+		"token not configured": {
+			"method":     http.MethodPut,
+			"url":        "/admin/log-level",
+			"body":       `{"level":"debug"}`,
+			"token":      "",
+			"configured": "",
+			"status":     http.StatusForbidden,
+			"level":      LevelInfo,
+		},
+		"delete": {
+			"method": http.MethodDelete,
+			"url":    "/admin/log-level",
+			"body":   "",
+			"status": http.StatusMethodNotAllowed,
+			"level":  LevelInfo,
+		},
+	}
+
+	for name, uc := range useCases {
+		t.Run(name, func(t *testing.T) {
+			configured := "admin0001"
+			if c, ok := uc["configured"]; ok {
+				configured = c.(string)
+			}
+			level := NewLevelVar(LevelInfo)
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(uc["method"].(string), uc["url"].(string),
+				strings.NewReader(uc["body"].(string)))
+			if token, ok := uc["token"]; ok {
+				request.Header.Set("Authorization", "Bearer "+token.(string))
+			}
+			level.Handler(configured).ServeHTTP(recorder, request)
+
+			if recorder.Code != uc["status"].(int) || level.Level() != uc["level"].(Level) {
+				t.Fatalf("\nACTUAL: %d %s\nEXPECT: %d %s\n",
+					recorder.Code, level.Level(), uc["status"], uc["level"])
+			}
+			if recorder.Code == http.StatusOK {
+				var body levelBody
+				if err := json.NewDecoder(recorder.Body).Decode(&body); err != nil || body.Level != level.Level().String() {
+					t.Fatalf("\nACTUAL: %+v %v\nEXPECT: %s\n", body, err, level.Level())
+				}
+			}
+		})
+	}
+}
+
+func TestWriter(t *testing.T) {
+	logger, out := newTestLogger(t, FormatLogfmt, LevelInfo)
+
+	logger.Writer(LevelWarn).Write([]byte("first line\nsecond line\n"))
+	if strings.Count(out.String(), "level=warn") != 2 || !strings.Contains(out.String(), "msg=\"second line\"") {
+		t.Fatalf("\nACTUAL: %s\nEXPECT: two warn lines\n", out.String())
+	}
+}
@@ -2,24 +2,29 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
 	"os"
-	"strconv"
+	"strings"
 	"time"
 
+	"github.com/otaviokr/spacetraders-ship/backtest"
 	"github.com/otaviokr/spacetraders-ship/component"
+	"github.com/otaviokr/spacetraders-ship/config"
+	"github.com/otaviokr/spacetraders-ship/kafka"
+	"github.com/otaviokr/spacetraders-ship/logging"
+	"github.com/otaviokr/spacetraders-ship/navigation"
+	"github.com/otaviokr/spacetraders-ship/telemetry"
 	"github.com/otaviokr/spacetraders-ship/web"
 
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
-	"go.opentelemetry.io/otel/exporters/jaeger"
-	"go.opentelemetry.io/otel/sdk/resource"
-
-	traceSdk "go.opentelemetry.io/otel/sdk/trace"
-	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/trace"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -33,203 +38,514 @@ const (
 //
 // https://pace.dev/blog/2020/02/12/why-you-shouldnt-use-func-main-in-golang-by-mat-ryer.html
 func main() {
-	token := os.Getenv("USER_TOKEN")
-	shipId := os.Getenv("SHIP_ID")
-	filePath := os.Getenv("CONFIG_FILE_PATH")
-	jaegerUrl := os.Getenv("JAEGER_URL")
-
-	kafkaConnType := os.Getenv("KAFKA_CONN_TYPE")
-	kafkaConnString := os.Getenv("KAFKA_CONN_STRING")
-	kafkaTopicRead := os.Getenv("KAFKA_TOPIC_READ")
-	kafkaTopicWrite := os.Getenv("KAFKA_TOPIC_WRITE")
-	kafkaPartitionRead := 0
-	kafkaPartitionWrite := 0
-
-	tempPartition := os.Getenv("KAFKA_PARTITION_READ")
-	if len(tempPartition) > 0 {
-		var err error
-		kafkaPartitionRead, err = strconv.Atoi(tempPartition)
-		if err != nil {
-			log.Println("Error while processing Kafka Read Partition:", err)
-			kafkaPartitionRead = 0
+	if err := dispatch(os.Args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
 		}
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
 	}
+}
 
-	tempPartition = os.Getenv("KAFKA_PARTITION_WRITE")
-	if len(tempPartition) > 0 {
-		var err error
-		kafkaPartitionWrite, err = strconv.Atoi(tempPartition)
-		if err != nil {
-			log.Println("Error while processing Kafka Write Partition:", err)
-			kafkaPartitionWrite = 0
-		}
+// runShip is the run command: the ship follows the route forever (or once, in dry run).
+func runShip(args []string) error {
+	cfg, err := loadConfig(flag.NewFlagSet("run", flag.ContinueOnError), args)
+	if err != nil {
+		return err
+	}
+	if err = cfg.Validate(); err != nil {
+		return err
 	}
 
-	metricsPort := os.Getenv("METRICS_PORT")
-	if len(metricsPort) < 1 {
-		metricsPort = "9090"
+	registry, err := navigation.OpenRegistry(cfg.LocationsFile)
+	if err != nil {
+		return err
 	}
 
 	// This is function to expose the metrics to Prometheus.
-	go exposeMetrics(metricsPort)
+	go exposeMetrics(cfg.MetricsPort, logging.Default().Level(), cfg.Log.AdminToken, registry)
 
 	// The main loop is actually inside the run function.
-	if err := run(
-		token, shipId, filePath, jaegerUrl,
-		kafkaConnType, kafkaConnString,
-		kafkaTopicRead, kafkaPartitionRead,
-		kafkaTopicWrite, kafkaPartitionWrite); err != nil {
-		fmt.Fprintf(os.Stderr, "%s\n", err)
-		os.Exit(1)
+	return run(cfg, registry)
+}
+
+// setupLogging replaces the default logger by one as configured, with the ship ID in every line. What is still written
+// with the standard log package (e.g., by the libraries) goes through it too.
+func setupLogging(cfg config.Config) (*logging.Logger, error) {
+	level, err := logging.ParseLevel(cfg.Log.Level)
+	if err != nil {
+		return nil, err
 	}
+	logger, err := logging.New(os.Stderr, cfg.Log.Format, logging.NewLevelVar(level))
+	if err != nil {
+		return nil, err
+	}
+	logger = logger.With(logging.FieldShipID, cfg.ShipID)
+
+	logging.SetDefault(logger)
+	log.SetFlags(0)
+	log.SetOutput(logger.Writer(logging.LevelInfo))
+	return logger, nil
 }
 
-// run contains the main loop of the program. It will collect data from the Space Traders game and
-// expose them to Prometheus.
-func run(token, shipId, configFilePath, jaegerUrl,
-	kafkaConnType, kafkaConnString, kafkaTopicRead string, kafkaPartitionRead int,
-	kafkaTopicWrite string, kafkaPartitionWrite int) error {
-	log.Println("Instantiating Jaeger...")
-	bgCtx := context.Background()
-	exp, err := jaeger.New(jaeger.WithCollectorEndpoint(jaeger.WithEndpoint(jaegerUrl)))
+// setupTracing creates the tracer provider as configured. The returned function flushes the last spans.
+func setupTracing(ctx context.Context, cfg config.Config) (trace.Tracer, func(), error) {
+	logging.Info(ctx, "Creating the tracer provider", "exporter", cfg.Telemetry.Exporter,
+		"sampler", cfg.Telemetry.Sampler)
+	tp, err := telemetry.NewTracerProvider(ctx, cfg.Telemetry, nil)
 	if err != nil {
-		log.Fatal(err)
+		return nil, nil, err
 	}
+	otel.SetTracerProvider(tp)
+	// The trace continues through Kafka in the W3C format (see kafka.KafkaProxy).
+	otel.SetTextMapPropagator(propagation.TraceContext{})
 
-	log.Println("Creating new Tracer Provider...")
-	tp := traceSdk.NewTracerProvider(
-		traceSdk.WithBatcher(exp),
-		traceSdk.WithResource(newResource()))
-	defer func() {
-		if err := tp.Shutdown(bgCtx); err != nil {
-			log.Fatal(err)
+	shutdown := func() {
+		if err := tp.Shutdown(ctx); err != nil {
+			logging.Error(ctx, "Could not flush the traces", "error", err)
 		}
-	}()
-	otel.SetTracerProvider(tp)
-	tracer := otel.Tracer(TracerName)
+	}
+	return otel.Tracer(TracerName), shutdown, nil
+}
+
+// newProxy connects to the game through Kafka, with the decorators set in the configuration. The returned function
+// closes the connection and the record file.
+func newProxy(ctx context.Context, cfg config.Config) (kafka.Proxy, func(), error) {
+	shipId := cfg.ShipID
+	kafkaProxy, err := kafka.NewKafkaProxy(ctx, shipId, cfg.Kafka)
+	if err != nil {
+		return nil, nil, err
+	}
+	closers := []func() error{kafkaProxy.Close}
+	closeAll := func() {
+		for i := len(closers) - 1; i >= 0; i-- {
+			closers[i]()
+		}
+	}
+
+	var transport kafka.Proxy = kafkaProxy
+
+	if cfg.Chaos.Enabled() {
+		logging.Warn(ctx, "Injecting faults in the responses", "chaos", fmt.Sprintf("%+v", cfg.Chaos))
+		transport = kafka.NewChaosProxy(transport, shipId, cfg.Chaos)
+	}
+
+	if len(cfg.RecordFile) > 0 {
+		cassette, err := os.OpenFile(cfg.RecordFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			closeAll()
+			return nil, nil, fmt.Errorf("opening record file: %w", err)
+		}
+		closers = append(closers, cassette.Close)
+		logging.Info(ctx, "Recording the requests", "file", cfg.RecordFile)
+		// Recording what the game actually answered, before any retry, so the replay sees the same failures. Cassettes
+		// must be replayed through kafka.NewResilientProxy too, which retries them as here.
+		transport = kafka.NewRecorder(transport, cassette)
+	}
+
+	// The rate limit is per account, so all ships using the same token in this process share it.
+	// Cached responses don't count against the rate limit, so the cache goes on top of everything.
+	proxy := kafka.NewCachingProxy(
+		kafka.NewResilientProxy(
+			transport,
+			shipId,
+			kafka.SharedRateLimiter(cfg.Token, cfg.RateLimit.Rate, cfg.RateLimit.Burst),
+			cfg.Retry),
+		shipId,
+		cfg.Cache)
+
+	return proxy, closeAll, nil
+}
+
+// run contains the main loop of the program. It will collect data from the Space Traders game and
+// expose them to Prometheus. What the ship learns about the locations is kept in the registry.
+func run(cfg config.Config, registry *navigation.Registry) error {
+	shipId := cfg.ShipID
+	bgCtx := context.Background()
+
+	tracer, shutdown, err := setupTracing(bgCtx, cfg)
+	if err != nil {
+		return err
+	}
+	defer shutdown()
 
 	// Defining the ship we will use.
-	log.Printf("Defining ship: %s ...", shipId)
-	// ship, err := component.NewShip(bgCtx, tracer, shipId, token)
-	ship, err := component.NewShip(
-		bgCtx, tracer, shipId,
-		kafkaConnType, kafkaConnString,
-		kafkaTopicRead, kafkaPartitionRead,
-		kafkaTopicWrite, kafkaPartitionWrite)
+	logging.Info(bgCtx, "Defining the ship")
+	proxy, closeProxy, err := newProxy(bgCtx, cfg)
+	if err != nil {
+		return err
+	}
+	defer closeProxy()
+
+	if cfg.DryRun {
+		return runDryRun(bgCtx, tracer, proxy, shipId, func(ship *component.Ship) ([]component.RouteStop, error) {
+			routes, err := component.ReadRouteFile(cfg.RouteFile)
+			if err != nil {
+				return nil, err
+			}
+			explorer := backtest.NewExplorer(backtest.DefaultExploreEvery)
+			return selectStops(bgCtx, tracer, ship, routes, explorer, false), nil
+		})
+	}
+
+	ship, err := component.NewShipCustomProxy(bgCtx, tracer, proxy, shipId)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-	log.Printf("Registered new ship wth ID %s\n", shipId)
+	logging.Info(bgCtx, "Ship registered")
+	learnLocations(bgCtx, ship, registry)
 
 	if len(ship.Details.FlightPlanId) > 0 {
-		log.Println("Flight Plan already defined, checking details...")
+		logging.Info(bgCtx, "Flight plan already defined, checking the details",
+			"flight_plan_id", ship.Details.FlightPlanId)
 		flightPlan, err := ship.GetFlightPlan(bgCtx)
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
-		log.Printf("Ship is en route: %ds to reach %s (%+v)\n",
-			flightPlan.Details.TimeRemainingInSeconds,
-			flightPlan.Details.Destination,
-			flightPlan.Details.ArrivesAt)
+		logging.Info(bgCtx, "Ship is en route",
+			"destination", flightPlan.Details.Destination,
+			"remaining_seconds", flightPlan.Details.TimeRemainingInSeconds,
+			"arrives_at", flightPlan.Details.ArrivesAt)
 		time.Sleep(time.Duration(flightPlan.Details.TimeRemainingInSeconds) * time.Second)
 	}
 
-	// Trading routes are supposed to be cyclical, so we are locked in an eternal loop.
+	// Trading routes are supposed to be cyclical, so we are locked in a loop until the route (and the ones following
+	// it) is finished, which may be never.
 	// If the ship is not in the right location when we start the application, the first step
 	// is to take the ship to the right location and start from there.
 	// FIXME we need to catch Ctrl+C and other termination commands to do a clean stop!
-	for {
-		// Read the trading route from file.
-		log.Println("Reading route file...")
-		routes, err := component.ReadRouteFile(configFilePath)
-		if err != nil {
-			log.Fatal(err)
+	watcher, stopWatching, err := watchRoute(bgCtx, cfg, cfg.RouteFile)
+	if err != nil {
+		return err
+	}
+	defer func() { stopWatching() }()
+
+	routeCycles := 0
+	// finished are the routes found finished since the last cycle, to stop if they all lead to each other.
+	finished := map[string]bool{}
+	// checked is the route whose legs were last checked, to warn only once about each version.
+	checked := ""
+	// explorer remembers the candidates chosen to learn about them, not to choose the same ones every cycle.
+	explorer := backtest.NewExplorer(backtest.DefaultExploreEvery)
+	for cycle := 1; ; {
+		// The route file is checked at the start of every cycle too, in case it is not watched in the background.
+		watcher.Check()
+		routes, version := watcher.Route()
+		routeFile := watcher.Path()
+
+		now := time.Now()
+		if done, reason := routes.Finished(routeCycles, now); done {
+			finished[routeFile] = true
+			next := routes.NextRouteFile(routeFile)
+			if len(next) < 1 {
+				logging.Info(bgCtx, "Route finished, no route to follow next", "file", routeFile, "reason", reason)
+				return nil
+			}
+			if finished[next] {
+				return fmt.Errorf("route %s leads to %s, which is already finished", routeFile, next)
+			}
+
+			nextWatcher, stopNext, err := watchRoute(bgCtx, cfg, next)
+			if err != nil {
+				// The ship waits for the next route to be fixed, instead of stopping.
+				logging.Error(bgCtx, "Route finished, but the next one is not valid", "file", routeFile,
+					"next", next, "error", err)
+				web.RouteReloads.WithLabelValues(shipId, "invalid").Inc()
+				web.RouteFileValid.WithLabelValues(shipId).Set(0)
+				time.Sleep(routeRetryDelay(cfg))
+				continue
+			}
+			logging.Info(bgCtx, "Route finished, following the next one", "file", routeFile, "reason", reason,
+				"next", next)
+			stopWatching()
+			watcher, stopWatching, routeCycles = nextWatcher, stopNext, 0
+			continue
+		}
+
+		if start := routes.NextWindow(now); start.After(now) {
+			logging.Info(bgCtx, "Waiting for the time window of the route", "file", routeFile, "start", start)
+			time.Sleep(start.Sub(now))
+			continue
+		}
+
+		finished = map[string]bool{}
+		if loaded := fmt.Sprintf("%s#%d", routeFile, version); loaded != checked {
+			checkRoute(bgCtx, ship, routes, registry)
+			checked = loaded
 		}
+		routeCycles++
+		cycleCtx := logging.WithContext(bgCtx, logging.FieldCycle, cycle)
+		cycle++
 
-		totalStops := len(routes.Route)
 		rootCtx, span := tracer.Start(
-			context.Background(),
+			cycleCtx,
 			"Route",
 			trace.WithAttributes(
 				attribute.Key("ship.id").String(shipId),
-				attribute.Key("ship.route.total_stops").Int(totalStops)))
-		log.Printf("Starting new trading route cycle with %d stops\n", totalStops)
+				attribute.Key("ship.route.file").String(routeFile),
+				attribute.Key("ship.route.cycle").Int(routeCycles)))
+		stops := selectStops(rootCtx, tracer, ship, routes, explorer, true)
+		totalStops := len(stops)
+		span.SetAttributes(attribute.Key("ship.route.total_stops").Int(totalStops))
+		logging.Info(rootCtx, "Starting a new trading route cycle", "file", routeFile, "route_cycle", routeCycles,
+			"stops", totalStops)
 
 		// Each step of the route requires the same procedure:
 		//	- If we are not at location, we travel to it;
 		//	- Sell the goods;
 		// 	- Buy the goods (including FUEL).
-		for i, route := range routes.Route {
+		interrupted := false
+		for i, route := range stops {
+			if cfg.RouteReload.Apply == component.ReloadAtStop {
+				watcher.Check()
+				if _, latest := watcher.Route(); latest != version {
+					logging.Info(rootCtx, "Route changed, applying it at this stop", "file", routeFile)
+					span.AddEvent("Route changed")
+					interrupted = true
+					break
+				}
+			}
+
 			routeCtx, routeSpan := tracer.Start(
-				rootCtx,
+				logging.WithContext(rootCtx, logging.FieldRouteStop, route.Station),
 				"Sprint",
 				trace.WithAttributes(
 					attribute.Key("route.location").String(route.Station),
 					attribute.Key("route.sell").Int(len(route.Sell)),
 					attribute.Key("route.buy").Int(len(route.Buy))))
-			log.Printf("Route Step %d/%d: %s\n", i+1, totalStops, route.Station)
+			logging.Info(routeCtx, "Route step", "step", i+1, "stops", totalStops)
 
 			if err = ship.GetDetails(routeCtx); err != nil {
 				span.RecordError(err)
 				span.SetStatus(codes.Error, err.Error())
 			}
-			log.Printf("Ship current status: Flight Plan(%s) Location(%s) Cargo(%+v)\n",
-				ship.Details.FlightPlanId,
-				ship.Details.Location,
-				ship.Details.Cargo)
+			logging.Debug(routeCtx, "Ship current status",
+				"flight_plan_id", ship.Details.FlightPlanId,
+				"location", ship.Details.Location,
+				"cargo", fmt.Sprintf("%+v", ship.Details.Cargo))
+
+			if visit, reason := route.ShouldVisit(routeCycles, ship.Details, ship.KnownPrice); !visit {
+				logging.Info(routeCtx, "Skipping the stop", "reason", reason)
+				routeSpan.AddEvent("Stop skipped", trace.WithAttributes(attribute.Key("reason").String(reason)))
+				routeSpan.End()
+				continue
+			}
 
 			if ship.Details.Location != route.Station {
-				log.Printf("Setting new coordinates: %s to %s\n", ship.Details.Location, route.Station)
+				logging.Info(routeCtx, "Setting new coordinates", "from", ship.Details.Location, "to", route.Station)
 				err = ship.Fly(routeCtx, route.Station)
 				if err != nil {
-					span.RecordError(err)
-					span.SetStatus(codes.Error, err.Error())
-					panic(err)
+					// We don't give up on the route: the next stop may be reachable from where we are.
+					logging.Error(routeCtx, "Could not fly to the stop", "error", err)
+					routeSpan.RecordError(err)
+					routeSpan.SetStatus(codes.Error, err.Error())
 				}
 			}
 
 			if ship.Details.Location == route.Station {
-				log.Printf("Ship reached %s\n", ship.Details.Location)
+				logging.Info(routeCtx, "Ship reached the stop")
 				dockCtx, dockSpan := tracer.Start(
 					routeCtx,
 					"Docked",
 					trace.WithAttributes(
 						attribute.Key("Location").String(ship.Details.Location)))
-				err = ship.DoCommerce(dockCtx, route.Sell, route.Buy)
+				result, err := ship.DoCommerce(dockCtx, route.Sell, route.Buy)
+				logging.Info(dockCtx, "Commerce finished",
+					"outcome", result.Outcome(),
+					"orders", len(result.Orders),
+					"skipped", len(result.Skipped),
+					"credits", result.CreditsDelta)
 				if err != nil {
+					logging.Error(dockCtx, "Commerce failed", "error", err)
 					dockSpan.RecordError(err)
 					dockSpan.SetStatus(codes.Error, err.Error())
 				}
 				dockSpan.End()
 			}
+			learnLocations(routeCtx, ship, registry)
 			routeSpan.End()
 		}
-		log.Println("Trading route finished. Receiving new orders...")
 		span.End()
+		if interrupted {
+			// The cycle is started again with the new route: a cycle cut short does not count towards the cycles of the
+			// route, nor for the conditions of its stops.
+			routeCycles--
+			continue
+		}
+		logging.Info(rootCtx, "Trading route finished, receiving new orders")
 		web.TradeCycles.
 			WithLabelValues(shipId).
 			Inc()
 	}
 }
 
+// watchRoute reads the route file, which must be valid, and checks it for changes in the background, every
+// cfg.RouteReload.Interval. The changes are logged and exposed in the metrics; the returned function stops watching.
+func watchRoute(ctx context.Context, cfg config.Config, path string) (*component.RouteWatcher, func(), error) {
+	watcher, err := component.NewRouteWatcher(path, func(route *component.Route, err error) {
+		if err != nil {
+			logging.Error(ctx, "Route file is not valid, keeping the last valid route", "file", path, "error", err)
+			web.RouteReloads.WithLabelValues(cfg.ShipID, "invalid").Inc()
+			web.RouteFileValid.WithLabelValues(cfg.ShipID).Set(0)
+			return
+		}
+		logging.Info(ctx, "Route file changed", "file", path, "apply", cfg.RouteReload.Apply)
+		web.RouteReloads.WithLabelValues(cfg.ShipID, "applied").Inc()
+		web.RouteFileValid.WithLabelValues(cfg.ShipID).Set(1)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	web.RouteFileValid.WithLabelValues(cfg.ShipID).Set(1)
+
+	watchCtx, cancel := context.WithCancel(ctx)
+	if cfg.RouteReload.Interval > 0 {
+		go watcher.Watch(watchCtx, cfg.RouteReload.Interval)
+	}
+	return watcher, cancel, nil
+}
+
+// checkRoute warns about the stations of the route (or of its candidates) that look like typos of the known locations
+// (see navigation.Registry.CheckStations), and about the legs the ship cannot make, as far as the ship knows the
+// locations and its flights (see navigation.Map.CheckRoute).
+func checkRoute(ctx context.Context, ship *component.Ship, routes *component.Route, registry *navigation.Registry) {
+	navigator := navigation.FromObservations(ship.Observations())
+	registry.AddTo(navigator)
+	known := len(registry.Locations()) > 0
+
+	check := func(name string, stops []component.RouteStop) {
+		for _, unknown := range registry.CheckStations(stops) {
+			switch {
+			case len(unknown.Suggestion) > 0:
+				logging.Warn(ctx, "Station of the route is not a known location, it may be a typo", "route", name,
+					"stop", unknown.Stop, "station", unknown.Station, "did_you_mean", unknown.Suggestion)
+			case known:
+				logging.Info(ctx, "Station of the route was not visited yet", "route", name,
+					"stop", unknown.Stop, "station", unknown.Station)
+			}
+		}
+		for _, warning := range navigator.CheckRoute(ship.Details, stops) {
+			logging.Warn(ctx, "The ship cannot make a leg of the route", "route", name,
+				"from", warning.Leg.From, "to", warning.Leg.To, "distance", math.Round(warning.Leg.Distance),
+				"fuel", warning.Leg.Fuel, "reason", warning.Reason)
+		}
+	}
+
+	check("", routes.Route)
+	for _, candidate := range routes.Candidates {
+		check(candidate.Name, candidate.Route)
+	}
+}
+
+// learnLocations adds what the ship learned to the registry, saving it if anything changed.
+func learnLocations(ctx context.Context, ship *component.Ship, registry *navigation.Registry) {
+	if !registry.Learn(ship.Observations()) {
+		return
+	}
+	if err := registry.Save(); err != nil {
+		logging.Error(ctx, "Could not save the known locations", "error", err)
+	}
+}
+
+// routeRetryDelay is how long to wait before reading again a route file that is not valid.
+func routeRetryDelay(cfg config.Config) time.Duration {
+	if cfg.RouteReload.Interval > 0 {
+		return cfg.RouteReload.Interval
+	}
+	return time.Minute
+}
+
+// selectStops returns the stops to follow in the cycle: the ones of the route or, if it lists candidates, the ones of
+// the candidate with the best expected profit per hour, given what the ship has seen so far (see
+// backtest.Explorer). The choice is traced and, if report is set, exposed in the metrics.
+func selectStops(ctx context.Context, tracer trace.Tracer, ship *component.Ship, routes *component.Route,
+	explorer *backtest.Explorer, report bool) []component.RouteStop {
+	if len(routes.Candidates) < 1 {
+		return routes.Route
+	}
+
+	selectCtx, span := tracer.Start(ctx, "Select Route")
+	defer span.End()
+
+	snapshot := backtest.SnapshotFromObservations(ship.Details, ship.Observations(), time.Now())
+	selection := explorer.SelectRoute(snapshot, routes.Candidates)
+	for _, estimate := range selection.Estimates {
+		span.AddEvent("Candidate estimated", trace.WithAttributes(
+			attribute.Key("route.candidate").String(estimate.Name),
+			attribute.Key("route.expected_profit").Int(estimate.Profit),
+			attribute.Key("route.expected_seconds").Float64(estimate.Duration.Seconds()),
+			attribute.Key("route.expected_profit_per_hour").Float64(estimate.ProfitPerHour),
+			attribute.Key("route.unknown").StringSlice(estimate.Unknown)))
+		logging.Debug(selectCtx, "Candidate route estimated", "route", estimate.Name,
+			"profit_per_hour", estimate.ProfitPerHour, "unknown", strings.Join(estimate.Unknown, ", "))
+	}
+	if report {
+		backtest.ReportEstimates(ship.Details.Id, selection.Estimates)
+	}
+
+	span.SetAttributes(
+		attribute.Key("route.chosen").String(selection.Chosen.Name),
+		attribute.Key("route.reason").String(selection.Reason))
+	if selection.Stranded {
+		logging.Warn(selectCtx, "Route chosen, but it strands the ship", "route", selection.Chosen.Name,
+			"reason", selection.Reason)
+	} else {
+		logging.Info(selectCtx, "Route chosen", "route", selection.Chosen.Name, "reason", selection.Reason)
+	}
+	if report {
+		web.RouteSelections.WithLabelValues(ship.Details.Id, selection.Chosen.Name).Inc()
+	}
+	return selection.Chosen.Route
+}
+
+// runDryRun goes through the stops once, printing what the ship would do at each one without sending any order to
+// the game. The stops are chosen once the ship details are known, and their conditions are evaluated as in the first
+// cycle of the route.
+func runDryRun(ctx context.Context, tracer trace.Tracer, proxy kafka.Proxy, shipId string,
+	stops func(*component.Ship) ([]component.RouteStop, error)) error {
+	ship, dryRun, err := component.NewShipDryRun(ctx, tracer, proxy, shipId)
+	if err != nil {
+		return err
+	}
+
+	route, err := stops(ship)
+	if err != nil {
+		return err
+	}
+	logging.Info(ctx, "Starting the dry run", "stops", len(route))
+
+	for _, stop := range route {
+		stopCtx := logging.WithContext(ctx, logging.FieldRouteStop, stop.Station)
+		if visit, reason := stop.ShouldVisit(1, ship.Details, ship.KnownPrice); !visit {
+			logging.Info(stopCtx, "Stop would be skipped", "reason", reason)
+			continue
+		}
+
+		dryRun.BeginStop(stop.Station)
+		if ship.Details.Location != stop.Station {
+			if err = ship.Fly(ctx, stop.Station); err != nil {
+				return err
+			}
+		}
+
+		if _, err = ship.DoCommerce(ctx, stop.Sell, stop.Buy); err != nil {
+			logging.Warn(stopCtx, "Commerce would fail", "error", err)
+		}
+	}
+
+	dryRun.Print(os.Stdout)
+	return nil
+}
+
 // exposeMetrics is a very simple web server that Prometheus can access to collect the metrics.
 //
-// port is the port where the web server is listening.
-func exposeMetrics(port string) {
+// port is the port where the web server is listening. The log level can be changed at runtime in /admin/log-level,
+// and the locations known by the ship are listed in /locations.
+func exposeMetrics(port string, level *logging.LevelVar, adminToken string, registry *navigation.Registry) {
 	http.Handle("/metrics", promhttp.Handler())
-	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%s", port), nil))
-}
-
-// newResource returns a resource describing this application to be used in the traces for Jaeger.
-func newResource() *resource.Resource {
-	r, _ := resource.Merge(
-		resource.Default(),
-		resource.NewWithAttributes(
-			semconv.SchemaURL,
-			semconv.ServiceNameKey.String("spacetraders-ship"),
-			semconv.ServiceVersionKey.String("v0.1.0"),
-			attribute.String("environment", "demo"),
-		),
-	)
-	return r
+	http.Handle("/admin/log-level", level.Handler(adminToken))
+	http.Handle("/locations", registry)
+	err := http.ListenAndServe(fmt.Sprintf(":%s", port), nil)
+	logging.Error(context.Background(), "Metrics server stopped", "port", port, "error", err)
+	os.Exit(1)
 }
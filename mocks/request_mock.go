@@ -5,6 +5,7 @@
 package mocks
 
 import (
+	context "context"
 	reflect "reflect"
 
 	gomock "github.com/golang/mock/gomock"
@@ -34,91 +35,91 @@ func (m *MockProxy) EXPECT() *MockProxyMockRecorder {
 }
 
 // BuyGood mocks base method.
-func (m *MockProxy) BuyGood(arg0 string, arg1 int) ([]byte, error) {
+func (m *MockProxy) BuyGood(arg0 context.Context, arg1 string, arg2 int) ([]byte, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "BuyGood", arg0, arg1)
+	ret := m.ctrl.Call(m, "BuyGood", arg0, arg1, arg2)
 	ret0, _ := ret[0].([]byte)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // BuyGood indicates an expected call of BuyGood.
-func (mr *MockProxyMockRecorder) BuyGood(arg0, arg1 interface{}) *gomock.Call {
+func (mr *MockProxyMockRecorder) BuyGood(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BuyGood", reflect.TypeOf((*MockProxy)(nil).BuyGood), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BuyGood", reflect.TypeOf((*MockProxy)(nil).BuyGood), arg0, arg1, arg2)
 }
 
 // GetFlightPlan mocks base method.
-func (m *MockProxy) GetFlightPlan(arg0 string) ([]byte, error) {
+func (m *MockProxy) GetFlightPlan(arg0 context.Context, arg1 string) ([]byte, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetFlightPlan", arg0)
+	ret := m.ctrl.Call(m, "GetFlightPlan", arg0, arg1)
 	ret0, _ := ret[0].([]byte)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetFlightPlan indicates an expected call of GetFlightPlan.
-func (mr *MockProxyMockRecorder) GetFlightPlan(arg0 interface{}) *gomock.Call {
+func (mr *MockProxyMockRecorder) GetFlightPlan(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetFlightPlan", reflect.TypeOf((*MockProxy)(nil).GetFlightPlan), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetFlightPlan", reflect.TypeOf((*MockProxy)(nil).GetFlightPlan), arg0, arg1)
 }
 
 // GetMarketplaceProducts mocks base method.
-func (m *MockProxy) GetMarketplaceProducts(arg0 string) ([]byte, error) {
+func (m *MockProxy) GetMarketplaceProducts(arg0 context.Context, arg1 string) ([]byte, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetMarketplaceProducts", arg0)
+	ret := m.ctrl.Call(m, "GetMarketplaceProducts", arg0, arg1)
 	ret0, _ := ret[0].([]byte)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetMarketplaceProducts indicates an expected call of GetMarketplaceProducts.
-func (mr *MockProxyMockRecorder) GetMarketplaceProducts(arg0 interface{}) *gomock.Call {
+func (mr *MockProxyMockRecorder) GetMarketplaceProducts(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMarketplaceProducts", reflect.TypeOf((*MockProxy)(nil).GetMarketplaceProducts), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMarketplaceProducts", reflect.TypeOf((*MockProxy)(nil).GetMarketplaceProducts), arg0, arg1)
 }
 
 // GetShipInfo mocks base method.
-func (m *MockProxy) GetShipInfo() ([]byte, error) {
+func (m *MockProxy) GetShipInfo(arg0 context.Context) ([]byte, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetShipInfo")
+	ret := m.ctrl.Call(m, "GetShipInfo", arg0)
 	ret0, _ := ret[0].([]byte)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetShipInfo indicates an expected call of GetShipInfo.
-func (mr *MockProxyMockRecorder) GetShipInfo() *gomock.Call {
+func (mr *MockProxyMockRecorder) GetShipInfo(arg0 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetShipInfo", reflect.TypeOf((*MockProxy)(nil).GetShipInfo))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetShipInfo", reflect.TypeOf((*MockProxy)(nil).GetShipInfo), arg0)
 }
 
 // SellGood mocks base method.
-func (m *MockProxy) SellGood(arg0 string, arg1 int) ([]byte, error) {
+func (m *MockProxy) SellGood(arg0 context.Context, arg1 string, arg2 int) ([]byte, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "SellGood", arg0, arg1)
+	ret := m.ctrl.Call(m, "SellGood", arg0, arg1, arg2)
 	ret0, _ := ret[0].([]byte)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // SellGood indicates an expected call of SellGood.
-func (mr *MockProxyMockRecorder) SellGood(arg0, arg1 interface{}) *gomock.Call {
+func (mr *MockProxyMockRecorder) SellGood(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SellGood", reflect.TypeOf((*MockProxy)(nil).SellGood), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SellGood", reflect.TypeOf((*MockProxy)(nil).SellGood), arg0, arg1, arg2)
 }
 
 // SetNewFlightPlan mocks base method.
-func (m *MockProxy) SetNewFlightPlan(arg0 string) ([]byte, error) {
+func (m *MockProxy) SetNewFlightPlan(arg0 context.Context, arg1 string) ([]byte, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "SetNewFlightPlan", arg0)
+	ret := m.ctrl.Call(m, "SetNewFlightPlan", arg0, arg1)
 	ret0, _ := ret[0].([]byte)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // SetNewFlightPlan indicates an expected call of SetNewFlightPlan.
-func (mr *MockProxyMockRecorder) SetNewFlightPlan(arg0 interface{}) *gomock.Call {
+func (mr *MockProxyMockRecorder) SetNewFlightPlan(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetNewFlightPlan", reflect.TypeOf((*MockProxy)(nil).SetNewFlightPlan), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetNewFlightPlan", reflect.TypeOf((*MockProxy)(nil).SetNewFlightPlan), arg0, arg1)
 }
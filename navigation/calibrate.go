@@ -0,0 +1,74 @@
+package navigation
+
+import (
+	"math"
+
+	"github.com/otaviokr/spacetraders-ship/component"
+)
+
+// Calibrate fits the model to the observed flights, all made with the same type of ship. The fuel is fitted against
+// the distance, and the time against the distance divided by the speed, with least squares. With flights of a single
+// distance, only the part per distance is fitted, keeping the base values of the model given.
+func Calibrate(model FlightModel, flights []component.ObservedFlight) FlightModel {
+	var fuel, durations []point
+	for _, flight := range flights {
+		if flight.Distance < 1 {
+			continue
+		}
+		fuel = append(fuel, point{x: float64(flight.Distance), y: float64(flight.Fuel)})
+		if flight.Speed > 0 && flight.Duration > 0 {
+			perSpeed := float64(flight.Distance) / float64(flight.Speed)
+			durations = append(durations, point{x: perSpeed, y: flight.Duration.Seconds()})
+		}
+	}
+
+	if base, slope, ok := fit(fuel, model.FuelBase); ok {
+		model.FuelBase, model.FuelPerDistance = round(base), round(slope)
+	}
+	if base, slope, ok := fit(durations, float64(model.DockingSeconds)); ok {
+		model.DockingSeconds, model.SecondsPerDistance = int(math.Round(base)), round(slope)
+	}
+	return model
+}
+
+// point is an observation of y for x.
+type point struct {
+	x float64
+	y float64
+}
+
+// fit returns the line y = base + slope*x closest to the points. If the points do not tell the base (e.g., a single
+// one), the given one is kept. It is not ok if there are no points, or the result makes no sense (a negative slope
+// or base).
+func fit(points []point, base float64) (float64, float64, bool) {
+	if len(points) < 1 {
+		return 0, 0, false
+	}
+
+	var n, sumX, sumY, sumXX, sumXY float64
+	for _, p := range points {
+		n++
+		sumX += p.x
+		sumY += p.y
+		sumXX += p.x * p.x
+		sumXY += p.x * p.y
+	}
+
+	var slope float64
+	if variance := n*sumXX - sumX*sumX; variance > 1e-9 {
+		slope = (n*sumXY - sumX*sumY) / variance
+		base = (sumY - slope*sumX) / n
+	} else {
+		slope = (sumY - n*base) / sumX
+	}
+
+	if slope <= 0 || base < 0 {
+		return 0, 0, false
+	}
+	return base, slope, true
+}
+
+// round keeps three decimals, which is as precise as the game values allow.
+func round(value float64) float64 {
+	return math.Round(value*1000) / 1000
+}
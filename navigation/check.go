@@ -0,0 +1,117 @@
+package navigation
+
+import (
+	"fmt"
+
+	"github.com/otaviokr/spacetraders-ship/component"
+)
+
+// Warning is a leg of the route the ship cannot make.
+type Warning struct {
+	Leg    Leg
+	Reason string
+}
+
+// CheckRoute estimates every leg of the stops, from where the ship is to the first stop and back from the last stop
+// to the first (routes are cyclical), and returns the legs the ship cannot make. The fuel is carried in the cargo and
+// bought where the leg departs from, so a leg is impossible if it needs more fuel than the ship can hold, or if it
+// departs from a marketplace not trading FUEL with less fuel left than it needs (counting the FUEL the stops buy).
+// Legs between locations not known yet are not checked, and a marketplace not known yet is taken as trading FUEL.
+func (m *Map) CheckRoute(ship component.ShipDetails, stops []component.RouteStop) []Warning {
+	var warnings []Warning
+
+	// fuel is what the ship holds when leaving, if known: it is not after a leg that cannot be estimated.
+	fuel, known := 0, true
+	for _, cargo := range ship.Cargo {
+		if cargo.Good == "FUEL" {
+			fuel += cargo.Quantity
+		}
+	}
+	previous := ship.Location
+	for _, d := range m.departures(ship, stops) {
+		leg := d.leg
+		if leg.From != previous {
+			known = false
+		}
+		previous = leg.To
+
+		trades, ok := m.FuelMarkets[leg.From]
+		if ok && !trades {
+			if known && fuel < leg.Fuel {
+				warnings = append(warnings, Warning{
+					Leg: leg,
+					Reason: fmt.Sprintf("needs %d fuel, but only %d would be left and %s does not trade FUEL",
+						leg.Fuel, fuel, leg.From),
+				})
+			}
+			if fuel -= leg.Fuel; fuel < 0 {
+				fuel = 0
+			}
+			continue
+		}
+
+		if ship.MaxCargo > 0 && leg.Fuel > ship.MaxCargo {
+			warnings = append(warnings, Warning{
+				Leg:    leg,
+				Reason: fmt.Sprintf("needs %d fuel, but the ship holds at most %d", leg.Fuel, ship.MaxCargo),
+			})
+		}
+		// The FUEL missing for the leg is bought before leaving.
+		if fuel += d.bought; !known || fuel < leg.Fuel {
+			fuel, known = maximum(d.bought, leg.Fuel), true
+		}
+		fuel -= leg.Fuel
+	}
+	return warnings
+}
+
+// Legs returns the estimates of the legs of the stops, from where the ship is to the first stop and then including the
+// one back from the last stop to the first, except the ones between the same location or with a location not known
+// yet.
+func (m *Map) Legs(ship component.ShipDetails, stops []component.RouteStop) []Leg {
+	var legs []Leg
+	for _, d := range m.departures(ship, stops) {
+		legs = append(legs, d.leg)
+	}
+	return legs
+}
+
+// departure is a leg of the route, with the FUEL bought at the stop it departs from.
+type departure struct {
+	leg    Leg
+	bought int
+}
+
+// departures lists the legs of the stops, as described in Legs.
+func (m *Map) departures(ship component.ShipDetails, stops []component.RouteStop) []departure {
+	if len(stops) < 1 {
+		return nil
+	}
+
+	var departures []departure
+	add := func(from, to string, bought int) {
+		if from == to {
+			return
+		}
+		if leg, err := m.Estimate(from, to, ship); err == nil {
+			departures = append(departures, departure{leg: leg, bought: bought})
+		}
+	}
+
+	add(ship.Location, stops[0].Station, 0)
+	for i, stop := range stops {
+		add(stop.Station, stops[(i+1)%len(stops)].Station, stop.Buy["FUEL"])
+	}
+	return departures
+}
+
+// maximum returns the largest of the values.
+func maximum(values ...int) int {
+	largest := values[0]
+	for _, value := range values[1:] {
+		if value > largest {
+			largest = value
+		}
+	}
+	return largest
+}
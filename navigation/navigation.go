@@ -0,0 +1,129 @@
+// Package navigation estimates the flights of the ship: where the locations are, and how much distance, time and fuel
+// each leg of a route takes, calibrated with the flights the ship already made.
+package navigation
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/otaviokr/spacetraders-ship/component"
+)
+
+// FlightModel estimates how much fuel and time a flight takes, given its distance.
+type FlightModel struct {
+	FuelBase           float64 `yaml:"fuelBase"`
+	FuelPerDistance    float64 `yaml:"fuelPerDistance"`
+	SecondsPerDistance float64 `yaml:"secondsPerDistance"`
+	DockingSeconds     int     `yaml:"dockingSeconds"`
+}
+
+// DefaultFlightModel returns the values observed in the game for the most common ships.
+func DefaultFlightModel() FlightModel {
+	return FlightModel{
+		FuelBase:           1,
+		FuelPerDistance:    0.25,
+		SecondsPerDistance: 2,
+		DockingSeconds:     30,
+	}
+}
+
+// Fuel returns the fuel spent to fly the distance.
+func (m FlightModel) Fuel(distance float64) int {
+	return int(math.Round(m.FuelBase + distance*m.FuelPerDistance))
+}
+
+// Duration returns how long a ship with the speed takes to fly the distance, docking included.
+func (m FlightModel) Duration(distance float64, speed int) time.Duration {
+	if speed < 1 {
+		speed = 1
+	}
+	seconds := distance*m.SecondsPerDistance/float64(speed) + float64(m.DockingSeconds)
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// Distance returns the distance between the coordinates, as the game computes it for a flight plan.
+func Distance(from, to component.Coordinates) float64 {
+	return math.Hypot(float64(to.X-from.X), float64(to.Y-from.Y))
+}
+
+// Leg is the estimate of a flight from one location to another.
+type Leg struct {
+	From     string
+	To       string
+	Distance float64
+	Fuel     int
+	Duration time.Duration
+}
+
+// Map is what is known to navigate: where the locations are, and the flight model of each type of ship.
+type Map struct {
+	Locations map[string]component.Coordinates
+	// Models are calibrated with the flights observed, by ship type; the other types use DefaultFlightModel.
+	Models map[string]FlightModel
+	// FuelMarkets tells, for each location whose marketplace is known, if it trades FUEL.
+	FuelMarkets map[string]bool
+}
+
+// NewMap creates an empty Map.
+func NewMap() *Map {
+	return &Map{
+		Locations:   map[string]component.Coordinates{},
+		Models:      map[string]FlightModel{},
+		FuelMarkets: map[string]bool{},
+	}
+}
+
+// FromObservations builds the map from what the ship learned while flying (see component.Ship.Observations): the
+// locations it visited, the marketplaces trading FUEL, and a flight model for each type of ship calibrated with its
+// flights.
+func FromObservations(observations component.Observations) *Map {
+	m := NewMap()
+	for station, coordinates := range observations.Locations {
+		m.Locations[station] = coordinates
+	}
+	for station, market := range observations.Markets {
+		_, fuel := market.Products["FUEL"]
+		m.FuelMarkets[station] = fuel
+	}
+
+	flights := map[string][]component.ObservedFlight{}
+	for _, flight := range observations.Flights {
+		flights[flight.ShipType] = append(flights[flight.ShipType], flight)
+	}
+	for shipType, observed := range flights {
+		m.Models[shipType] = Calibrate(DefaultFlightModel(), observed)
+	}
+	return m
+}
+
+// Model returns the flight model of the type of ship.
+func (m *Map) Model(shipType string) FlightModel {
+	if model, ok := m.Models[shipType]; ok {
+		return model
+	}
+	return DefaultFlightModel()
+}
+
+// Estimate returns the distance, time and fuel of a flight between the locations, for the ship. It fails if any of
+// the locations is unknown.
+func (m *Map) Estimate(from, to string, ship component.ShipDetails) (Leg, error) {
+	start, ok := m.Locations[from]
+	if !ok {
+		return Leg{}, fmt.Errorf("unknown location %s", from)
+	}
+	end, ok := m.Locations[to]
+	if !ok {
+		return Leg{}, fmt.Errorf("unknown location %s", to)
+	}
+
+	model := m.Model(ship.Type)
+	distance := Distance(start, end)
+	return Leg{
+		From:     from,
+		To:       to,
+		Distance: distance,
+		Fuel:     model.Fuel(distance),
+		Duration: model.Duration(distance, ship.Speed),
+	}, nil
+}
@@ -0,0 +1,178 @@
+package navigation_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/otaviokr/spacetraders-ship/component"
+	"github.com/otaviokr/spacetraders-ship/navigation"
+)
+
+func TestEstimate(t *testing.T) {
+	m := navigation.NewMap()
+	m.Locations["A"] = component.Coordinates{X: 0, Y: 0}
+	m.Locations["B"] = component.Coordinates{X: 30, Y: 40}
+	m.Models["FAST"] = navigation.FlightModel{FuelBase: 2, FuelPerDistance: 0.5, SecondsPerDistance: 1, DockingSeconds: 10}
+
+	useCases := map[string]map[string]interface{}{
+		"default model": {
+			"ship":     component.ShipDetails{Type: "SLOW", Speed: 2},
+			"to":       "B",
+			"expected": navigation.Leg{From: "A", To: "B", Distance: 50, Fuel: 14, Duration: 80 * time.Second},
+		},
+		"calibrated model": {
+			"ship":     component.ShipDetails{Type: "FAST", Speed: 5},
+			"to":       "B",
+			"expected": navigation.Leg{From: "A", To: "B", Distance: 50, Fuel: 27, Duration: 20 * time.Second},
+		},
+		"unknown location": {
+			"ship":  component.ShipDetails{Type: "FAST", Speed: 5},
+			"to":    "C",
+			"error": "unknown location C",
+		},
+	}
+
+	for name, uc := range useCases {
+		leg, err := m.Estimate("A", uc["to"].(string), uc["ship"].(component.ShipDetails))
+		if expected, ok := uc["error"]; ok {
+			if err == nil || err.Error() != expected {
+				t.Fatalf("\nACTUAL: %s: %v\nEXPECT: %s\n", name, err, expected)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(leg, uc["expected"]) {
+			t.Fatalf("\nACTUAL: %s: %+v (%v)\nEXPECT: %+v\n", name, leg, err, uc["expected"])
+		}
+	}
+}
+
+func TestCalibrate(t *testing.T) {
+	flight := func(distance, fuel, speed int, seconds int) component.ObservedFlight {
+		return component.ObservedFlight{ShipType: "JW-MK-I", Distance: distance, Fuel: fuel, Speed: speed,
+			Duration: time.Duration(seconds) * time.Second}
+	}
+
+	useCases := map[string]map[string]interface{}{
+		"no flights": {
+			"flights":  []component.ObservedFlight{},
+			"expected": navigation.DefaultFlightModel(),
+		},
+		"one flight": {
+			"flights": []component.ObservedFlight{flight(40, 21, 2, 90)},
+			"expected": navigation.FlightModel{FuelBase: 1, FuelPerDistance: 0.5, SecondsPerDistance: 3,
+				DockingSeconds: 30},
+		},
+		"many flights": {
+			"flights": []component.ObservedFlight{flight(10, 5, 1, 30), flight(30, 11, 1, 70), flight(60, 20, 3, 50)},
+			"expected": navigation.FlightModel{FuelBase: 2, FuelPerDistance: 0.3, SecondsPerDistance: 2,
+				DockingSeconds: 10},
+		},
+		"nonsense ignored": {
+			"flights":  []component.ObservedFlight{flight(10, 5, 0, 0), flight(30, 1, 1, 0)},
+			"expected": navigation.DefaultFlightModel(),
+		},
+	}
+
+	for name, uc := range useCases {
+		model := navigation.Calibrate(navigation.DefaultFlightModel(), uc["flights"].([]component.ObservedFlight))
+		if model != uc["expected"] {
+			t.Fatalf("\nACTUAL: %s: %+v\nEXPECT: %+v\n", name, model, uc["expected"])
+		}
+	}
+}
+
+func TestFromObservations(t *testing.T) {
+	observations := component.Observations{
+		Locations: map[string]component.Coordinates{"A": {X: 0, Y: 0}, "B": {X: 0, Y: 40}},
+		Markets: map[string]component.ObservedMarket{
+			"A": {Products: map[string]component.Product{"FUEL": {}}},
+			"B": {Products: map[string]component.Product{"DRONES": {}}}},
+		Flights: []component.ObservedFlight{
+			{ShipType: "JW-MK-I", Distance: 40, Fuel: 21, Speed: 2, Duration: 90 * time.Second}},
+	}
+
+	m := navigation.FromObservations(observations)
+	if len(m.Locations) != 2 || m.Model("JW-MK-I").FuelPerDistance != 0.5 ||
+		m.Model("GR-MK-II").FuelPerDistance != 0.25 ||
+		!reflect.DeepEqual(m.FuelMarkets, map[string]bool{"A": true, "B": false}) {
+		t.Fatalf("\nACTUAL: %+v\nEXPECT: 2 locations, FUEL traded at A only, a model calibrated for JW-MK-I only\n", m)
+	}
+}
+
+func TestCheckRoute(t *testing.T) {
+	m := navigation.NewMap()
+	m.Locations["A"] = component.Coordinates{X: 0, Y: 0}
+	m.Locations["B"] = component.Coordinates{X: 0, Y: 40}
+	m.Locations["FAR"] = component.Coordinates{X: 0, Y: 400}
+	m.FuelMarkets["A"] = true
+
+	useCases := map[string]map[string]interface{}{
+		"reachable": {
+			"stops":    []string{"A", "B"},
+			"warnings": []string{},
+		},
+		"too far": {
+			"stops":    []string{"A", "B", "FAR"},
+			"warnings": []string{"B-FAR", "FAR-A"},
+		},
+		"unknown not checked": {
+			"stops":    []string{"A", "C", "FAR"},
+			"warnings": []string{"FAR-A"},
+		},
+		"no fuel to leave": {
+			"location": "A",
+			"stops":    []string{"A", "B"},
+			"noFuelAt": "B",
+			"warnings": []string{"B-A"},
+		},
+		"fuel carried": {
+			"location":   "A",
+			"stops":      []string{"A", "B"},
+			"noFuelAt":   "B",
+			"fuelBought": 30,
+			"warnings":   []string{},
+		},
+		"no fuel to reach the route": {
+			"location": "B",
+			"stops":    []string{"A"},
+			"noFuelAt": "B",
+			"warnings": []string{"B-A"},
+		},
+		"enough fuel to reach the route": {
+			"location": "B",
+			"fuel":     20,
+			"stops":    []string{"A"},
+			"noFuelAt": "B",
+			"warnings": []string{},
+		},
+	}
+
+	for name, uc := range useCases {
+		ship := component.ShipDetails{Type: "JW-MK-I", Speed: 1, MaxCargo: 50}
+		ship.Location, _ = uc["location"].(string)
+		if fuel, ok := uc["fuel"].(int); ok {
+			ship.Cargo = []component.ShipCargo{{Good: "FUEL", Quantity: fuel, TotalVolume: fuel}}
+		}
+		var stops []component.RouteStop
+		for _, station := range uc["stops"].([]string) {
+			stop := component.RouteStop{Station: station}
+			if bought, ok := uc["fuelBought"].(int); ok && station == "A" {
+				stop.Buy = map[string]int{"FUEL": bought}
+			}
+			stops = append(stops, stop)
+		}
+		delete(m.FuelMarkets, "B")
+		if station, ok := uc["noFuelAt"].(string); ok {
+			m.FuelMarkets[station] = false
+		}
+
+		warnings := []string{}
+		for _, warning := range m.CheckRoute(ship, stops) {
+			warnings = append(warnings, warning.Leg.From+"-"+warning.Leg.To)
+		}
+		if !reflect.DeepEqual(warnings, uc["warnings"]) {
+			t.Fatalf("\nACTUAL: %s: %v\nEXPECT: %v\n", name, warnings, uc["warnings"])
+		}
+	}
+}
@@ -0,0 +1,291 @@
+package navigation
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/otaviokr/spacetraders-ship/component"
+	"gopkg.in/yaml.v3"
+)
+
+// KnownLocation is what the ship learned about a location. A location the ship only flew from or to, but never was
+// seen at, has no coordinates yet.
+type KnownLocation struct {
+	Symbol         string    `yaml:"symbol" json:"symbol"`
+	X              int       `yaml:"x" json:"x"`
+	Y              int       `yaml:"y" json:"y"`
+	HasCoordinates bool      `yaml:"hasCoordinates" json:"hasCoordinates"`
+	Marketplace    bool      `yaml:"marketplace" json:"marketplace"`
+	Goods          []string  `yaml:"goods,omitempty" json:"goods,omitempty"`
+	LastVisit      time.Time `yaml:"lastVisit,omitempty" json:"lastVisit,omitempty"`
+}
+
+// Registry is every location the ship has visited or flown to, kept in a file so it survives restarts. It is safe to
+// use from the HTTP handler while the ship learns.
+type Registry struct {
+	// path is the file where the registry is kept; if empty, it is only kept in memory.
+	path string
+
+	mu        sync.Mutex
+	locations map[string]KnownLocation
+}
+
+// OpenRegistry reads the registry kept in the file, if it exists yet. If the path is empty, the registry is only kept
+// in memory.
+func OpenRegistry(path string) (*Registry, error) {
+	registry := &Registry{path: path, locations: map[string]KnownLocation{}}
+	if len(path) < 1 {
+		return registry, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return registry, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("registry: %w", err)
+	}
+
+	var locations []KnownLocation
+	if err = yaml.Unmarshal(data, &locations); err != nil {
+		return nil, fmt.Errorf("registry: reading %s: %w", path, err)
+	}
+	for _, location := range locations {
+		registry.locations[location.Symbol] = location
+	}
+	return registry, nil
+}
+
+// Learn adds what the ship observed (see component.Ship.Observations) to the registry: where it has been and when,
+// the goods traded in the marketplaces it saw, and the locations it flew from and to. It tells if anything changed.
+func (r *Registry) Learn(observations component.Observations) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	changed := false
+	update := func(symbol string, change func(location *KnownLocation)) {
+		location, ok := r.locations[symbol]
+		if !ok {
+			location = KnownLocation{Symbol: symbol}
+		}
+		before := location
+		change(&location)
+		if !ok || !reflect.DeepEqual(location, before) {
+			r.locations[symbol] = location
+			changed = true
+		}
+	}
+
+	for symbol, coordinates := range observations.Locations {
+		update(symbol, func(location *KnownLocation) {
+			location.X, location.Y, location.HasCoordinates = coordinates.X, coordinates.Y, true
+			if at := observations.Visits[symbol]; at.After(location.LastVisit) {
+				location.LastVisit = at
+			}
+		})
+	}
+	for symbol, market := range observations.Markets {
+		goods := make([]string, 0, len(market.Products))
+		for good := range market.Products {
+			goods = append(goods, good)
+		}
+		sort.Strings(goods)
+		update(symbol, func(location *KnownLocation) {
+			location.Marketplace = true
+			location.Goods = goods
+		})
+	}
+	for _, flight := range observations.Flights {
+		for _, symbol := range []string{flight.Departure, flight.Destination} {
+			if len(symbol) > 0 {
+				update(symbol, func(*KnownLocation) {})
+			}
+		}
+	}
+	return changed
+}
+
+// Locations returns every known location, by symbol.
+func (r *Registry) Locations() []KnownLocation {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	locations := make([]KnownLocation, 0, len(r.locations))
+	for _, location := range r.locations {
+		locations = append(locations, location)
+	}
+	sort.Slice(locations, func(i, j int) bool { return locations[i].Symbol < locations[j].Symbol })
+	return locations
+}
+
+// Location returns what is known about the location, if anything.
+func (r *Registry) Location(symbol string) (KnownLocation, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	location, ok := r.locations[symbol]
+	return location, ok
+}
+
+// AddTo adds the coordinates of the known locations, and whether their marketplaces trade FUEL, to the map, if it does
+// not know them yet.
+func (r *Registry) AddTo(m *Map) {
+	for _, location := range r.Locations() {
+		if _, ok := m.Locations[location.Symbol]; !ok && location.HasCoordinates {
+			m.Locations[location.Symbol] = component.Coordinates{X: location.X, Y: location.Y}
+		}
+		if _, ok := m.FuelMarkets[location.Symbol]; !ok && location.Marketplace {
+			m.FuelMarkets[location.Symbol] = false
+			for _, good := range location.Goods {
+				if good == "FUEL" {
+					m.FuelMarkets[location.Symbol] = true
+				}
+			}
+		}
+	}
+}
+
+// Save writes the registry to its file, replacing it at once so a crash never leaves it half written.
+func (r *Registry) Save() error {
+	if len(r.path) < 1 {
+		return nil
+	}
+
+	var buffer bytes.Buffer
+	encoder := yaml.NewEncoder(&buffer)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(r.Locations()); err != nil {
+		return fmt.Errorf("registry: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return fmt.Errorf("registry: %w", err)
+	}
+
+	temporary, err := os.CreateTemp(filepath.Dir(r.path), filepath.Base(r.path)+".*")
+	if err != nil {
+		return fmt.Errorf("registry: %w", err)
+	}
+	defer os.Remove(temporary.Name())
+	if _, err = temporary.Write(buffer.Bytes()); err != nil {
+		temporary.Close()
+		return fmt.Errorf("registry: %w", err)
+	}
+	if err = temporary.Close(); err != nil {
+		return fmt.Errorf("registry: %w", err)
+	}
+	if err = os.Rename(temporary.Name(), r.path); err != nil {
+		return fmt.Errorf("registry: %w", err)
+	}
+	return nil
+}
+
+// UnknownStation is a station of a route that is not in the registry, with the known location it is probably a typo
+// of, if there is one close enough.
+type UnknownStation struct {
+	Stop       int
+	Station    string
+	Suggestion string
+}
+
+// CheckStations lists the stops whose station is not known (the first stop is 1). A new station is not necessarily a
+// mistake, but one that differs from a known location by a character or two most likely is.
+func (r *Registry) CheckStations(stops []component.RouteStop) []UnknownStation {
+	var unknown []UnknownStation
+	for i, stop := range stops {
+		if _, ok := r.Location(stop.Station); ok || len(stop.Station) < 1 {
+			continue
+		}
+		suggestion, _ := r.Suggest(stop.Station)
+		unknown = append(unknown, UnknownStation{Stop: i + 1, Station: stop.Station, Suggestion: suggestion})
+	}
+	return unknown
+}
+
+// Suggest returns the known location closest to the symbol, if it differs by at most 2 characters (added, removed or
+// replaced), and by less than half of them. If many are as close, the first one by symbol is returned.
+func (r *Registry) Suggest(symbol string) (string, bool) {
+	best, bestDistance := "", 3
+	for _, location := range r.Locations() {
+		distance := editDistance(symbol, location.Symbol)
+		if distance < bestDistance && distance*2 < len(symbol) {
+			best, bestDistance = location.Symbol, distance
+		}
+	}
+	return best, len(best) > 0
+}
+
+// editDistance is how many characters must be added, removed or replaced to turn a into b (Levenshtein distance).
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = minimum(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+// minimum returns the smallest of the values.
+func minimum(values ...int) int {
+	smallest := values[0]
+	for _, value := range values[1:] {
+		if value < smallest {
+			smallest = value
+		}
+	}
+	return smallest
+}
+
+// ServeHTTP lists the known locations as JSON on GET or, with the "symbol" query parameter, only that location. An
+// unknown symbol is not found, with the closest known one suggested, if any.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if req.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeRegistryError(w, http.StatusMethodNotAllowed, fmt.Sprintf("method %s not allowed", req.Method), "")
+		return
+	}
+
+	symbol := req.URL.Query().Get("symbol")
+	if len(symbol) < 1 {
+		_ = json.NewEncoder(w).Encode(r.Locations())
+		return
+	}
+
+	location, ok := r.Location(symbol)
+	if !ok {
+		suggestion, _ := r.Suggest(symbol)
+		writeRegistryError(w, http.StatusNotFound, fmt.Sprintf("unknown location %s", symbol), suggestion)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(location)
+}
+
+// registryError is the body of the error responses of the registry.
+type registryError struct {
+	Error      string `json:"error"`
+	Suggestion string `json:"suggestion,omitempty"`
+}
+
+func writeRegistryError(w http.ResponseWriter, status int, message, suggestion string) {
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(registryError{Error: message, Suggestion: suggestion})
+}
@@ -0,0 +1,139 @@
+package navigation_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/otaviokr/spacetraders-ship/component"
+	"github.com/otaviokr/spacetraders-ship/navigation"
+)
+
+func TestRegistryLearn(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "locations.yml")
+	registry, err := navigation.OpenRegistry(path)
+	if err != nil {
+		t.Fatalf("\nACTUAL: %v\nEXPECT: no error\n", err)
+	}
+
+	visit := time.Date(2022, 7, 1, 10, 0, 0, 0, time.UTC)
+	observations := component.Observations{
+		Locations: map[string]component.Coordinates{"OE-PM": {X: 20, Y: -25}},
+		Visits:    map[string]time.Time{"OE-PM": visit},
+		Markets: map[string]component.ObservedMarket{
+			"OE-PM": {SeenAt: visit, Products: map[string]component.Product{"FUEL": {}, "DRONES": {}}}},
+		Flights: []component.ObservedFlight{{Departure: "OE-PM", Destination: "OE-CR", Distance: 10}},
+	}
+	if changed := registry.Learn(observations); !changed {
+		t.Fatalf("\nACTUAL: changed %t\nEXPECT: true\n", changed)
+	}
+	if changed := registry.Learn(observations); changed {
+		t.Fatalf("\nACTUAL: changed %t the second time\nEXPECT: false\n", changed)
+	}
+	if err = registry.Save(); err != nil {
+		t.Fatalf("\nACTUAL: %v\nEXPECT: no error\n", err)
+	}
+
+	reopened, err := navigation.OpenRegistry(path)
+	if err != nil {
+		t.Fatalf("\nACTUAL: %v\nEXPECT: no error\n", err)
+	}
+	expected := []navigation.KnownLocation{
+		{Symbol: "OE-CR"},
+		{Symbol: "OE-PM", X: 20, Y: -25, HasCoordinates: true, Marketplace: true, Goods: []string{"DRONES", "FUEL"},
+			LastVisit: visit},
+	}
+	if locations := reopened.Locations(); !reflect.DeepEqual(locations, expected) {
+		t.Fatalf("\nACTUAL: %+v\nEXPECT: %+v\n", locations, expected)
+	}
+
+	m := navigation.NewMap()
+	reopened.AddTo(m)
+	if len(m.Locations) != 1 || m.Locations["OE-PM"] != (component.Coordinates{X: 20, Y: -25}) {
+		t.Fatalf("\nACTUAL: %+v\nEXPECT: only OE-PM, with coordinates\n", m.Locations)
+	}
+	if !reflect.DeepEqual(m.FuelMarkets, map[string]bool{"OE-PM": true}) {
+		t.Fatalf("\nACTUAL: %+v\nEXPECT: only OE-PM, trading FUEL\n", m.FuelMarkets)
+	}
+}
+
+func TestRegistryCheckStations(t *testing.T) {
+	registry, _ := navigation.OpenRegistry("")
+	registry.Learn(component.Observations{Locations: map[string]component.Coordinates{
+		"OE-PM": {}, "OE-PM-TR": {}, "OE-CR": {}, "XV-BN": {}}})
+
+	useCases := map[string]map[string]interface{}{
+		"known": {
+			"station":  "OE-PM-TR",
+			"expected": []navigation.UnknownStation(nil),
+		},
+		"typo": {
+			"station":  "OE-PN",
+			"expected": []navigation.UnknownStation{{Stop: 2, Station: "OE-PN", Suggestion: "OE-PM"}},
+		},
+		"missing character": {
+			"station":  "OE-PMTR",
+			"expected": []navigation.UnknownStation{{Stop: 2, Station: "OE-PMTR", Suggestion: "OE-PM-TR"}},
+		},
+		"new station": {
+			"station":  "ZZ-KO-XY",
+			"expected": []navigation.UnknownStation{{Stop: 2, Station: "ZZ-KO-XY"}},
+		},
+	}
+
+	for name, uc := range useCases {
+		stops := []component.RouteStop{{Station: "OE-CR"}, {Station: uc["station"].(string)}}
+		if unknown := registry.CheckStations(stops); !reflect.DeepEqual(unknown, uc["expected"]) {
+			t.Fatalf("\nACTUAL: %s: %+v\nEXPECT: %+v\n", name, unknown, uc["expected"])
+		}
+	}
+}
+
+func TestRegistryServeHTTP(t *testing.T) {
+	registry, _ := navigation.OpenRegistry("")
+	registry.Learn(component.Observations{Locations: map[string]component.Coordinates{
+		"OE-PM": {X: 20, Y: -25}, "OE-CR": {X: 1, Y: 2}}})
+
+	useCases := map[string]map[string]interface{}{
+		"all": {
+			"method": http.MethodGet,
+			"url":    "/locations",
+			"status": http.StatusOK,
+			"body":   `[{"symbol":"OE-CR","x":1,"y":2,"hasCoordinates":true,"marketplace":false,"lastVisit":"0001-01-01T00:00:00Z"},{"symbol":"OE-PM","x":20,"y":-25,"hasCoordinates":true,"marketplace":false,"lastVisit":"0001-01-01T00:00:00Z"}]`,
+		},
+		"one": {
+			"method": http.MethodGet,
+			"url":    "/locations?symbol=OE-PM",
+			"status": http.StatusOK,
+			"body":   `{"symbol":"OE-PM","x":20,"y":-25,"hasCoordinates":true,"marketplace":false,"lastVisit":"0001-01-01T00:00:00Z"}`,
+		},
+		"unknown": {
+			"method": http.MethodGet,
+			"url":    "/locations?symbol=OE-PN",
+			"status": http.StatusNotFound,
+			"body":   `{"error":"unknown location OE-PN","suggestion":"OE-PM"}`,
+		},
+		"not allowed": {
+			"method": http.MethodPost,
+			"url":    "/locations",
+			"status": http.StatusMethodNotAllowed,
+			"body":   `{"error":"method POST not allowed"}`,
+		},
+	}
+
+	for name, uc := range useCases {
+		recorder := httptest.NewRecorder()
+		registry.ServeHTTP(recorder, httptest.NewRequest(uc["method"].(string), uc["url"].(string), nil))
+
+		var actual, expected interface{}
+		_ = json.Unmarshal(recorder.Body.Bytes(), &actual)
+		_ = json.Unmarshal([]byte(uc["body"].(string)), &expected)
+		if recorder.Code != uc["status"].(int) || !reflect.DeepEqual(actual, expected) {
+			t.Fatalf("\nACTUAL: %s: %d %s\nEXPECT: %d %s\n", name, recorder.Code, recorder.Body, uc["status"], uc["body"])
+		}
+	}
+}
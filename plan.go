@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/otaviokr/spacetraders-ship/backtest"
+	"github.com/otaviokr/spacetraders-ship/component"
+)
+
+// runPlan shows what the ship would do at one stop of the route, without sending any order to the game. By default,
+// the stop is where the ship is (or the first one, if the ship is not at any stop of the route). If the route lists
+// candidates, the stops are the ones of the candidate the ship would choose now.
+func runPlan(args []string) error {
+	flags := flag.NewFlagSet("plan", flag.ContinueOnError)
+	stopNumber := flags.Int("stop", 0, "number of the stop in the route (1 is the first), instead of where the ship is")
+	cfg, err := loadConfig(flags, args)
+	if err != nil {
+		return err
+	}
+	if err = cfg.Validate(); err != nil {
+		return err
+	}
+
+	routes, err := component.ReadRouteFile(cfg.RouteFile)
+	if err != nil {
+		return err
+	}
+	if err = routes.Validate(); err != nil {
+		return err
+	}
+	if *stopNumber < 0 || (len(routes.Candidates) < 1 && *stopNumber > len(routes.Route)) {
+		return fmt.Errorf("plan: stop must be between 1 and %d, got %d", len(routes.Route), *stopNumber)
+	}
+
+	ctx := context.Background()
+	tracer, shutdown, err := setupTracing(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer shutdown()
+
+	proxy, closeProxy, err := newProxy(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer closeProxy()
+
+	return runDryRun(ctx, tracer, proxy, cfg.ShipID, func(ship *component.Ship) ([]component.RouteStop, error) {
+		explorer := backtest.NewExplorer(backtest.DefaultExploreEvery)
+		stops := selectStops(ctx, tracer, ship, routes, explorer, false)
+		if *stopNumber > len(stops) {
+			return nil, fmt.Errorf("plan: stop must be between 1 and %d, got %d", len(stops), *stopNumber)
+		}
+		if *stopNumber > 0 {
+			return stops[*stopNumber-1 : *stopNumber], nil
+		}
+		for i, stop := range stops {
+			if stop.Station == ship.Details.Location {
+				return stops[i : i+1], nil
+			}
+		}
+		return stops[:1], nil
+	})
+}
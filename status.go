@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/otaviokr/spacetraders-ship/component"
+)
+
+// runStatus shows where the ship is, its cargo and flight plan, without changing anything in the game.
+func runStatus(args []string) error {
+	cfg, err := loadConfig(flag.NewFlagSet("status", flag.ContinueOnError), args)
+	if err != nil {
+		return err
+	}
+	if err = cfg.ValidateWithoutRoute(); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	tracer, shutdown, err := setupTracing(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer shutdown()
+
+	proxy, closeProxy, err := newProxy(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer closeProxy()
+
+	ship, err := component.NewShipCustomProxy(ctx, tracer, proxy, cfg.ShipID)
+	if err != nil {
+		return err
+	}
+
+	var flightPlan *component.FlightPlan
+	if len(ship.Details.FlightPlanId) > 0 {
+		if flightPlan, err = ship.GetFlightPlan(ctx); err != nil {
+			return err
+		}
+	}
+
+	printStatus(os.Stdout, ship.Details, flightPlan)
+	return nil
+}
+
+// printStatus writes the ship details and the flight plan, if any.
+func printStatus(w io.Writer, details component.ShipDetails, flightPlan *component.FlightPlan) {
+	fmt.Fprintf(w, "Ship:     %s (%s %s, %s)\n", details.Id, details.Manufacturer, details.Class, details.Type)
+	if flightPlan != nil {
+		fmt.Fprintf(w, "Flying:   %s -> %s, %ds remaining (arrives at %s)\n",
+			flightPlan.Details.Departure,
+			flightPlan.Details.Destination,
+			flightPlan.Details.TimeRemainingInSeconds,
+			flightPlan.Details.ArrivesAt)
+	} else {
+		fmt.Fprintf(w, "Location: %s (%d, %d)\n", details.Location, details.X, details.Y)
+	}
+	fmt.Fprintf(w, "Cargo:    %d/%d used\n", details.MaxCargo-details.SpaceAvailable, details.MaxCargo)
+	for _, cargo := range details.Cargo {
+		fmt.Fprintf(w, "  %-20s %6d (volume %d)\n", cargo.Good, cargo.Quantity, cargo.TotalVolume)
+	}
+}
@@ -0,0 +1,273 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"runtime/debug"
+	"sort"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/jaeger"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	traceSdk "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+)
+
+// Exporters supported to send the spans.
+const (
+	ExporterOTLPGRPC = "otlp-grpc"
+	ExporterOTLPHTTP = "otlp-http"
+	ExporterJaeger   = "jaeger"
+	ExporterStdout   = "stdout"
+	ExporterNone     = "none"
+)
+
+// Samplers supported to decide which traces are kept.
+const (
+	// SamplerAlways keeps every trace.
+	SamplerAlways = "always"
+	// SamplerNever drops every trace.
+	SamplerNever = "never"
+	// SamplerRatio keeps a fraction of the traces, given by SampleRatio.
+	SamplerRatio = "ratio"
+	// SamplerParentRatio follows the decision of the parent span, if any, or keeps a fraction of the new traces.
+	SamplerParentRatio = "parentbased_ratio"
+)
+
+// ServiceName is the name of the service in the traces, unless configured otherwise.
+const ServiceName = "spacetraders-ship"
+
+// Config defines where the spans are sent, how many of them and how the ship is identified in them.
+type Config struct {
+	Exporter string `yaml:"exporter"`
+	// Endpoint is where the exporter sends the spans: host:port for OTLP, the collector URL for Jaeger. If empty, the
+	// default of each exporter is used.
+	Endpoint string `yaml:"endpoint"`
+	// Insecure disables TLS for the OTLP exporters.
+	Insecure bool `yaml:"insecure"`
+	// Headers are sent with every OTLP export, e.g. for authentication.
+	Headers map[string]string `yaml:"headers,omitempty"`
+
+	Sampler     string  `yaml:"sampler"`
+	SampleRatio float64 `yaml:"sampleRatio"`
+
+	ServiceName string `yaml:"serviceName"`
+	Environment string `yaml:"environment"`
+	ShipID      string `yaml:"-"`
+	// Attributes are added to the resource, as-is.
+	Attributes map[string]string `yaml:"attributes,omitempty"`
+}
+
+// DefaultConfig returns the configuration used when nothing else is set: every trace is kept, but not sent anywhere.
+func DefaultConfig() Config {
+	return Config{
+		Exporter:    ExporterNone,
+		Sampler:     SamplerParentRatio,
+		SampleRatio: 1,
+		ServiceName: ServiceName,
+		Environment: "demo",
+	}
+}
+
+// Validate checks that the exporter and the sampler are known and the ratio makes sense.
+func (c Config) Validate() error {
+	switch c.Exporter {
+	case ExporterOTLPGRPC, ExporterOTLPHTTP, ExporterStdout, ExporterNone:
+	case ExporterJaeger:
+		if len(c.Endpoint) < 1 {
+			return fmt.Errorf("telemetry: the jaeger exporter requires the collector endpoint")
+		}
+	default:
+		return fmt.Errorf("telemetry: unknown exporter %q (use %s, %s, %s, %s or %s)",
+			c.Exporter, ExporterOTLPGRPC, ExporterOTLPHTTP, ExporterJaeger, ExporterStdout, ExporterNone)
+	}
+
+	switch c.Sampler {
+	case SamplerAlways, SamplerNever:
+	case SamplerRatio, SamplerParentRatio:
+		if c.SampleRatio < 0 || c.SampleRatio > 1 {
+			return fmt.Errorf("telemetry: the sample ratio must be between 0 and 1, got %v", c.SampleRatio)
+		}
+	default:
+		return fmt.Errorf("telemetry: unknown sampler %q (use %s, %s, %s or %s)",
+			c.Sampler, SamplerAlways, SamplerNever, SamplerRatio, SamplerParentRatio)
+	}
+
+	return nil
+}
+
+// NewTracerProvider creates the tracer provider with the configured exporter, sampler and resource. The stdout
+// exporter writes to w (os.Stdout if nil). The provider must be shut down to flush the last spans.
+func NewTracerProvider(ctx context.Context, config Config, w io.Writer) (*traceSdk.TracerProvider, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	res, err := NewResource(config)
+	if err != nil {
+		return nil, err
+	}
+
+	options := []traceSdk.TracerProviderOption{
+		traceSdk.WithSampler(config.sampler()),
+		traceSdk.WithResource(res),
+	}
+
+	exporter, err := config.exporter(ctx, w)
+	if err != nil {
+		return nil, err
+	}
+	if exporter != nil {
+		options = append(options, traceSdk.WithBatcher(exporter))
+	}
+
+	return traceSdk.NewTracerProvider(options...), nil
+}
+
+// exporter creates the configured exporter, or nil if the spans are not sent anywhere.
+func (c Config) exporter(ctx context.Context, w io.Writer) (traceSdk.SpanExporter, error) {
+	var exporter traceSdk.SpanExporter
+	var err error
+
+	switch c.Exporter {
+	case ExporterOTLPGRPC:
+		options := []otlptracegrpc.Option{otlptracegrpc.WithHeaders(c.Headers)}
+		if len(c.Endpoint) > 0 {
+			options = append(options, otlptracegrpc.WithEndpoint(c.Endpoint))
+		}
+		if c.Insecure {
+			options = append(options, otlptracegrpc.WithInsecure())
+		}
+		exporter, err = otlptracegrpc.New(ctx, options...)
+	case ExporterOTLPHTTP:
+		options := []otlptracehttp.Option{otlptracehttp.WithHeaders(c.Headers)}
+		if len(c.Endpoint) > 0 {
+			options = append(options, otlptracehttp.WithEndpoint(c.Endpoint))
+		}
+		if c.Insecure {
+			options = append(options, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(ctx, options...)
+	case ExporterJaeger:
+		exporter, err = jaeger.New(jaeger.WithCollectorEndpoint(jaeger.WithEndpoint(c.Endpoint)))
+	case ExporterStdout:
+		if w == nil {
+			w = os.Stdout
+		}
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(w))
+	case ExporterNone:
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("telemetry: creating %s exporter: %w", c.Exporter, err)
+	}
+	return exporter, nil
+}
+
+// sampler creates the configured sampler.
+func (c Config) sampler() traceSdk.Sampler {
+	switch c.Sampler {
+	case SamplerAlways:
+		return traceSdk.AlwaysSample()
+	case SamplerNever:
+		return traceSdk.NeverSample()
+	case SamplerRatio:
+		return traceSdk.TraceIDRatioBased(c.SampleRatio)
+	default:
+		return traceSdk.ParentBased(traceSdk.TraceIDRatioBased(c.SampleRatio))
+	}
+}
+
+// NewResource describes the ship in the traces: service name and version, environment, ship ID and any extra
+// attributes from the configuration.
+func NewResource(config Config) (*resource.Resource, error) {
+	serviceName := config.ServiceName
+	if len(serviceName) < 1 {
+		serviceName = ServiceName
+	}
+
+	attributes := []attribute.KeyValue{
+		semconv.ServiceNameKey.String(serviceName),
+		semconv.ServiceVersionKey.String(Version()),
+	}
+	if len(config.Environment) > 0 {
+		attributes = append(attributes,
+			semconv.DeploymentEnvironmentKey.String(config.Environment),
+			// Kept for the searches and dashboards created before the semantic conventions were adopted.
+			attribute.String("environment", config.Environment))
+	}
+	if len(config.ShipID) > 0 {
+		attributes = append(attributes, attribute.String("ship.id", config.ShipID))
+	}
+
+	keys := make([]string, 0, len(config.Attributes))
+	for key := range config.Attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		attributes = append(attributes, attribute.String(key, config.Attributes[key]))
+	}
+
+	return resource.Merge(
+		resource.Default(),
+		resource.NewWithAttributes(semconv.SchemaURL, attributes...))
+}
+
+// Version returns the version of the binary from the build information: the module version if built from a tagged
+// release, or the VCS revision (with "-dirty" for uncommitted changes) otherwise.
+func Version() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	if len(info.Main.Version) > 0 && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+
+	revision := ""
+	modified := false
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.modified":
+			modified = setting.Value == "true"
+		}
+	}
+	if len(revision) < 1 {
+		return "(devel)"
+	}
+	if len(revision) > 12 {
+		revision = revision[:12]
+	}
+	if modified {
+		revision += "-dirty"
+	}
+	return "devel-" + revision
+}
+
+// ParseAttributes reads the attributes in the key1=value1,key2=value2 format (the same used by
+// OTEL_RESOURCE_ATTRIBUTES).
+func ParseAttributes(value string) (map[string]string, error) {
+	attributes := map[string]string{}
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if len(pair) < 1 {
+			continue
+		}
+		key, val, found := strings.Cut(pair, "=")
+		if !found || len(strings.TrimSpace(key)) < 1 {
+			return nil, fmt.Errorf("telemetry: invalid attribute %q, expected key=value", pair)
+		}
+		attributes[strings.TrimSpace(key)] = strings.TrimSpace(val)
+	}
+	return attributes, nil
+}
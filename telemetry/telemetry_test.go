@@ -0,0 +1,178 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestValidate(t *testing.T) {
+	useCases := map[string]map[string]interface{}{
+		"default": {
+			"config": DefaultConfig(),
+			"valid":  true,
+		},
+		"otlp grpc without endpoint": {
+			"config": Config{Exporter: ExporterOTLPGRPC, Sampler: SamplerAlways},
+			"valid":  true,
+		},
+		"jaeger without endpoint": {
+			"config": Config{Exporter: ExporterJaeger, Sampler: SamplerAlways},
+			"valid":  false,
+		},
+		"jaeger": {
+			"config": Config{Exporter: ExporterJaeger, Endpoint: "http://jaeger:14268/api/traces", Sampler: SamplerNever},
+			"valid":  true,
+		},
+		"unknown exporter": {
+			"config": Config{Exporter: "zipkin", Sampler: SamplerAlways},
+			"valid":  false,
+		},
+		"unknown sampler": {
+			"config": Config{Exporter: ExporterNone, Sampler: "sometimes"},
+			"valid":  false,
+		},
+		"ratio too high": {
+			"config": Config{Exporter: ExporterNone, Sampler: SamplerRatio, SampleRatio: 1.5},
+			"valid":  false,
+		},
+		"negative ratio": {
+			"config": Config{Exporter: ExporterNone, Sampler: SamplerParentRatio, SampleRatio: -0.1},
+			"valid":  false,
+		},
+	}
+
+	for name, uc := range useCases {
+		t.Run(name, func(t *testing.T) {
+			err := uc["config"].(Config).Validate()
+			if (err == nil) != uc["valid"].(bool) {
+				t.Fatalf("\nACTUAL: %v\nEXPECT: valid %v\n", err, uc["valid"])
+			}
+		})
+	}
+}
+
+func TestSampler(t *testing.T) {
+	useCases := map[string]map[string]interface{}{
+		"always": {
+			"config":      Config{Sampler: SamplerAlways},
+			"description": "AlwaysOnSampler",
+		},
+		"never": {
+			"config":      Config{Sampler: SamplerNever},
+			"description": "AlwaysOffSampler",
+		},
+		"ratio": {
+			"config":      Config{Sampler: SamplerRatio, SampleRatio: 0.25},
+			"description": "TraceIDRatioBased{0.25}",
+		},
+		"parent based": {
+			"config":      Config{Sampler: SamplerParentRatio, SampleRatio: 0.5},
+			"description": "ParentBased{root:TraceIDRatioBased{0.5}",
+		},
+	}
+
+	for name, uc := range useCases {
+		t.Run(name, func(t *testing.T) {
+			description := uc["config"].(Config).sampler().Description()
+			if !strings.HasPrefix(description, uc["description"].(string)) {
+				t.Fatalf("\nACTUAL: %s\nEXPECT: %s\n", description, uc["description"])
+			}
+		})
+	}
+}
+
+func TestNewResource(t *testing.T) {
+	config := DefaultConfig()
+	config.Environment = "production"
+	config.ShipID = "ship-1"
+	config.Attributes = map[string]string{"team": "traders"}
+
+	res, err := NewResource(config)
+	if err != nil {
+		t.Fatalf("\nACTUAL: %v\nEXPECT: no error\n", err)
+	}
+
+	expected := map[attribute.Key]string{
+		"service.name":           ServiceName,
+		"service.version":        Version(),
+		"deployment.environment": "production",
+		"environment":            "production",
+		"ship.id":                "ship-1",
+		"team":                   "traders",
+	}
+	actual := map[attribute.Key]string{}
+	for _, kv := range res.Attributes() {
+		actual[kv.Key] = kv.Value.Emit()
+	}
+	for key, value := range expected {
+		if actual[key] != value {
+			t.Fatalf("\nACTUAL: %s=%q\nEXPECT: %s=%q\n", key, actual[key], key, value)
+		}
+	}
+}
+
+func TestNewTracerProviderStdout(t *testing.T) {
+	var out bytes.Buffer
+	config := DefaultConfig()
+	config.Exporter = ExporterStdout
+	config.ShipID = "ship-1"
+
+	tp, err := NewTracerProvider(context.TODO(), config, &out)
+	if err != nil {
+		t.Fatalf("\nACTUAL: %v\nEXPECT: no error\n", err)
+	}
+	_, span := tp.Tracer("test").Start(context.TODO(), "Fly")
+	span.End()
+	if err = tp.Shutdown(context.TODO()); err != nil {
+		t.Fatalf("\nACTUAL: %v\nEXPECT: no error\n", err)
+	}
+
+	if !strings.Contains(out.String(), `"Name":"Fly"`) || !strings.Contains(out.String(), "ship-1") {
+		t.Fatalf("\nACTUAL: %s\nEXPECT: span Fly of ship-1\n", out.String())
+	}
+}
+
+func TestNewTracerProviderNever(t *testing.T) {
+	config := DefaultConfig()
+	config.Sampler = SamplerNever
+
+	tp, err := NewTracerProvider(context.TODO(), config, nil)
+	if err != nil {
+		t.Fatalf("\nACTUAL: %v\nEXPECT: no error\n", err)
+	}
+	defer tp.Shutdown(context.TODO())
+
+	_, span := tp.Tracer("test").Start(context.TODO(), "Fly")
+	defer span.End()
+	if span.SpanContext().TraceFlags() != trace.TraceFlags(0) {
+		t.Fatalf("\nACTUAL: %v\nEXPECT: not sampled\n", span.SpanContext().TraceFlags())
+	}
+}
+
+func TestNewTracerProviderInvalid(t *testing.T) {
+	config := DefaultConfig()
+	config.Exporter = "zipkin"
+
+	if _, err := NewTracerProvider(context.TODO(), config, nil); err == nil {
+		t.Fatalf("\nACTUAL: no error\nEXPECT: unknown exporter\n")
+	}
+}
+
+func TestParseAttributes(t *testing.T) {
+	attributes, err := ParseAttributes("team=traders, region = eu ,")
+	if err != nil {
+		t.Fatalf("\nACTUAL: %v\nEXPECT: no error\n", err)
+	}
+	if len(attributes) != 2 || attributes["team"] != "traders" || attributes["region"] != "eu" {
+		t.Fatalf("\nACTUAL: %v\nEXPECT: map[region:eu team:traders]\n", attributes)
+	}
+
+	if _, err = ParseAttributes("team"); err == nil {
+		t.Fatalf("\nACTUAL: no error\nEXPECT: invalid attribute\n")
+	}
+}
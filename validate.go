@@ -0,0 +1,76 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/otaviokr/spacetraders-ship/component"
+	"github.com/otaviokr/spacetraders-ship/navigation"
+)
+
+// runValidateRoute checks the route files given as arguments (or the configured one), without connecting to the game.
+// The routes they lead to (see component.Route.Then) must exist, but are only validated if given as well. If the
+// locations file is set, the stations that look like typos of the known locations are listed too, without failing.
+func runValidateRoute(args []string) error {
+	flags := flag.NewFlagSet("validate-route", flag.ContinueOnError)
+	cfg, err := loadConfig(flags, args)
+	if err != nil {
+		return err
+	}
+	registry, err := navigation.OpenRegistry(cfg.LocationsFile)
+	if err != nil {
+		return err
+	}
+
+	paths := flags.Args()
+	if len(paths) < 1 && len(cfg.RouteFile) > 0 {
+		paths = []string{cfg.RouteFile}
+	}
+	if len(paths) < 1 {
+		return fmt.Errorf("validate-route: no route file given")
+	}
+
+	failed := 0
+	for _, path := range paths {
+		routes, err := component.ReadRouteFile(path)
+		if err == nil {
+			err = routes.Validate()
+		}
+		if err == nil && len(routes.Then) > 0 {
+			// The next route is only read when this one is finished, which is too late to find it is missing.
+			if _, statErr := os.Stat(routes.NextRouteFile(path)); statErr != nil {
+				err = fmt.Errorf("the route to follow next cannot be read: %w", statErr)
+			}
+		}
+		if err != nil {
+			fmt.Printf("%s: %v\n", path, err)
+			failed++
+			continue
+		}
+		printTypos(path, registry, "", routes.Route)
+		for _, candidate := range routes.Candidates {
+			printTypos(path, registry, fmt.Sprintf("candidate %s, ", candidate.Name), candidate.Route)
+		}
+		if len(routes.Candidates) > 0 {
+			fmt.Printf("%s: OK, %d candidate routes\n", path, len(routes.Candidates))
+			continue
+		}
+		fmt.Printf("%s: OK, %d stops\n", path, len(routes.Route))
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("validate-route: %d of %d route files are invalid", failed, len(paths))
+	}
+	return nil
+}
+
+// printTypos prints the stations of the stops that are not known, but close to a known location.
+func printTypos(path string, registry *navigation.Registry, prefix string, stops []component.RouteStop) {
+	for _, unknown := range registry.CheckStations(stops) {
+		if len(unknown.Suggestion) > 0 {
+			fmt.Printf("%s: warning: %sstop %d: unknown location %s, did you mean %s?\n",
+				path, prefix, unknown.Stop, unknown.Station, unknown.Suggestion)
+		}
+	}
+}
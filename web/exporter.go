@@ -57,4 +57,93 @@ var (
 			Help:      "Products bought",
 		},
 		[]string{"ship_id", "good", "location"})
+
+	ProxyAttempts = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "proxy_attempts",
+			Help:      "How many requests have been sent to the game, including retries",
+		},
+		[]string{"ship_id", "action"})
+
+	ProxyGiveUps = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "proxy_give_ups",
+			Help:      "How many requests failed even after all retries",
+		},
+		[]string{"ship_id", "action"})
+
+	ProxyQueueSeconds = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "proxy_queue_seconds",
+			Help:      "How long requests waited in the rate limiter before being sent",
+			Buckets:   []float64{0, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+		},
+		[]string{"ship_id", "action"})
+
+	ProxyRateLimited = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "proxy_rate_limited",
+			Help:      "How many requests were rate limited by the game",
+		},
+		[]string{"ship_id", "action"})
+
+	CommerceStops = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "commerce_stops",
+			Help:      "Stops where the starship traded, by outcome (success, partial, failed or idle)",
+		},
+		[]string{"ship_id", "location", "outcome"})
+
+	ChaosFaults = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "chaos_faults",
+			Help:      "How many faults have been injected in the responses, by fault (delay, drop, malformed, error or reorder)",
+		},
+		[]string{"ship_id", "action", "fault"})
+
+	ProxyCacheRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "proxy_cache_requests",
+			Help:      "How many read requests were answered from the cache (hit) or sent to the game (miss)",
+		},
+		[]string{"ship_id", "action", "result"})
+
+	RouteReloads = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "route_reloads",
+			Help:      "How many times the route file changed, by result (applied or invalid)",
+		},
+		[]string{"ship_id", "result"})
+
+	RouteFileValid = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "route_file_valid",
+			Help:      "Whether the last version of the route file is valid (1) or the ship kept the previous one (0)",
+		},
+		[]string{"ship_id"})
+
+	RouteSelections = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "route_selections",
+			Help:      "How many cycles each candidate route was chosen for",
+		},
+		[]string{"ship_id", "route"})
+
+	RouteExpectedProfitPerHour = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "route_expected_profit_per_hour",
+			Help:      "Profit per hour expected from each candidate route not stranding the ship, when the last route was chosen",
+		},
+		[]string{"ship_id", "route"})
 )